@@ -0,0 +1,492 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dacruz/mancala/game"
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	apiPrefix = "/api/v1"
+
+	defaultPageSize int = 20
+	maxPageSize     int = 100
+)
+
+// openAPI describes the /api/v1 routes.
+//
+//go:embed openapi.yaml
+var openAPI []byte
+
+type NewMatchRequest struct {
+	// empty to play whoever joins next, or bot
+	Opponent string `json:"opponent"`
+}
+
+type MoveRequest struct {
+	Pit *int `json:"pit"`
+}
+
+type SeriesRequest struct {
+	BestOf int `json:"best_of"`
+}
+
+// SeriesResponse leaves the players out, as their ids are also their
+// credentials.
+type SeriesResponse struct {
+	Id     string `json:"id"`
+	BestOf int    `json:"best_of"`
+	Status string `json:"status"`
+	// of the player who created the series, then of the one who joined
+	Wins  [2]int `json:"wins"`
+	Draws int    `json:"draws"`
+	// oldest first
+	Matches []string `json:"matches"`
+	// index in wins of the player asking, absent for others
+	Me *int `json:"me,omitempty"`
+	// index in wins of the winner, once the series is over
+	Winner *int `json:"winner,omitempty"`
+}
+
+type PlayerResponse struct {
+	Id string `json:"id"`
+	// how leaderboards list the player
+	Alias            string  `json:"alias"`
+	Played           int     `json:"played"`
+	Wins             int     `json:"wins"`
+	Losses           int     `json:"losses"`
+	Draws            int     `json:"draws"`
+	AverageMargin    float64 `json:"average_margin"`
+	LongestWinStreak int     `json:"longest_win_streak"`
+	// null until the player makes a move
+	FavoriteOpening *int             `json:"favorite_opening"`
+	Rating          int              `json:"rating"`
+	RatingHistory   []RatingResponse `json:"rating_history"`
+}
+
+type RatingResponse struct {
+	Match      string    `json:"match"`
+	Rating     int       `json:"rating"`
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+type PlayerMatchesResponse struct {
+	Matches []PlayerMatchResponse `json:"matches"`
+	Total   int                   `json:"total"`
+	Offset  int                   `json:"offset"`
+	Limit   int                   `json:"limit"`
+}
+
+// PlayerMatchResponse leaves the opponent out, as player ids are also
+// their credentials.
+type PlayerMatchResponse struct {
+	Id         string    `json:"match"`
+	FinishedAt time.Time `json:"finished_at"`
+	// win, loss or draw
+	Result        string `json:"result"`
+	Score         int    `json:"score"`
+	OpponentScore int    `json:"opponent_score"`
+	Opening       *int   `json:"opening"`
+	// after the match, absent if it was not rated
+	Rating int `json:"rating,omitempty"`
+}
+
+type LeaderboardResponse struct {
+	By     string `json:"by"`
+	Period string `json:"period"`
+	// month or ISO week of the period, all for all time
+	Window string `json:"window"`
+	// stones per pit, null for every variant
+	Variant *int                       `json:"variant"`
+	Entries []LeaderboardEntryResponse `json:"entries"`
+	Total   int                        `json:"total"`
+	Offset  int                        `json:"offset"`
+	Limit   int                        `json:"limit"`
+}
+
+type LeaderboardEntryResponse struct {
+	Rank   int    `json:"rank"`
+	Player string `json:"player"`
+	Score  int    `json:"score"`
+}
+
+func newAPIRouter(h Handler) *httprouter.Router {
+	router := httprouter.New()
+	router.GET(apiPrefix+"/openapi.yaml", h.openAPI)
+	router.POST(apiPrefix+"/matches", route(apiPrefix+"/matches", h.createMatch))
+	router.GET(apiPrefix+"/matches/:matchId", route(apiPrefix+"/matches/:matchId", h.getMatch))
+	router.POST(apiPrefix+"/matches/:matchId/moves", route(apiPrefix+"/matches/:matchId/moves", h.createMove))
+	router.GET(apiPrefix+"/matches/:matchId/events", route(apiPrefix+"/matches/:matchId/events", h.matchEvents))
+	router.POST(apiPrefix+"/matches/:matchId/rematch", route(apiPrefix+"/matches/:matchId/rematch", h.createRematch))
+	router.POST(apiPrefix+"/series", route(apiPrefix+"/series", h.createSeries))
+	router.GET(apiPrefix+"/series/:seriesId", route(apiPrefix+"/series/:seriesId", h.getSeries))
+	router.POST(apiPrefix+"/series/:seriesId/players", route(apiPrefix+"/series/:seriesId/players", h.joinSeries))
+	router.GET(apiPrefix+"/players/:playerId", route(apiPrefix+"/players/:playerId", h.getPlayer))
+	router.GET(apiPrefix+"/players/:playerId/matches", route(apiPrefix+"/players/:playerId/matches", h.listPlayerMatches))
+	router.GET(apiPrefix+"/leaderboards/:by", route(apiPrefix+"/leaderboards/:by", h.getLeaderboard))
+
+	return router
+}
+
+func (h Handler) openAPI(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Write(openAPI)
+}
+
+func (h Handler) createMatch(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	defer handle5xx(r.Context(), w)
+	setContectType(w)
+
+	req := NewMatchRequest{}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(r.Context(), fmt.Errorf("%w: %v", errInvalidRequest, err), map[string]interface{}{"reason": err.Error()}, w)
+			return
+		}
+	}
+
+	h.join(r.Context(), req.Opponent, http.StatusCreated, w)
+}
+
+func (h Handler) createMove(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	defer handle5xx(r.Context(), w)
+	setContectType(w)
+
+	req := MoveRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Pit == nil {
+		details := map[string]interface{}{"reason": "a pit is required"}
+		if err != nil {
+			details["reason"] = err.Error()
+		}
+		writeError(r.Context(), fmt.Errorf("%w: %v", errInvalidRequest, details["reason"]), details, w)
+		return
+	}
+
+	matchId := ps.ByName("matchId")
+	ctx, err := h.makeMove(r, matchId, *req.Pit, w)
+	if err != nil {
+		h.writeMoveError(ctx, err, matchId, *req.Pit, w)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// createRematch offers a rematch of the match, or accepts the one the
+// opponent offered, starting the next match.
+func (h Handler) createRematch(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	defer handle5xx(r.Context(), w)
+	setContectType(w)
+
+	matchId := ps.ByName("matchId")
+	ctx := withLogFields(r.Context(), "match_id", matchId)
+
+	playerId, err := player(r, w)
+	if err != nil {
+		writeError(ctx, err, nil, w)
+		return
+	}
+	ctx = withLogFields(ctx, "player_id", playerId)
+
+	rematch, err := h.dealer.Rematch(ctx, matchId, playerId)
+	if err != nil {
+		writeError(ctx, err, map[string]interface{}{"match": matchId}, w)
+		return
+	}
+
+	bs, _ := json.Marshal(newRematchResponse(*rematch, playerId))
+	if rematch.NextMatchId == "" {
+		w.WriteHeader(http.StatusAccepted)
+	} else {
+		w.Header().Set("Location", apiPrefix+"/matches/"+rematch.NextMatchId)
+		w.WriteHeader(http.StatusCreated)
+	}
+	w.Write(bs)
+}
+
+func newRematchResponse(r Rematch, playerId string) *RematchResponse {
+	return &RematchResponse{Mine: r.OfferedBy == playerId, NextMatch: r.NextMatchId}
+}
+
+// createSeries makes the player asking the first player of a new series.
+func (h Handler) createSeries(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	defer handle5xx(r.Context(), w)
+	setContectType(w)
+
+	req := SeriesRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(r.Context(), fmt.Errorf("%w: %v", errInvalidRequest, err), map[string]interface{}{"reason": err.Error()}, w)
+		return
+	}
+
+	s, playerId, err := h.referee.CreateSeries(r.Context(), req.BestOf)
+	if err != nil {
+		writeError(r.Context(), err, map[string]interface{}{"best_of": req.BestOf}, w)
+		return
+	}
+
+	writeSeries(s, playerId, http.StatusCreated, w)
+}
+
+func (h Handler) getSeries(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	defer handle5xx(r.Context(), w)
+	setContectType(w)
+
+	seriesId := ps.ByName("seriesId")
+	ctx := withLogFields(r.Context(), "series_id", seriesId)
+
+	s, err := h.referee.GetSeries(ctx, seriesId)
+	if err != nil {
+		writeError(ctx, err, map[string]interface{}{"series": seriesId}, w)
+		return
+	}
+
+	playerId := ""
+	if c, err := r.Cookie(playerCookieConst); err == nil {
+		playerId = c.Value
+	}
+	bs, _ := json.Marshal(newSeriesResponse(s, playerId))
+	w.Write(bs)
+}
+
+// joinSeries makes the player asking the second player of the series,
+// which starts its first game.
+func (h Handler) joinSeries(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	defer handle5xx(r.Context(), w)
+	setContectType(w)
+
+	seriesId := ps.ByName("seriesId")
+	ctx := withLogFields(r.Context(), "series_id", seriesId)
+
+	s, playerId, err := h.referee.JoinSeries(ctx, seriesId)
+	if err != nil {
+		writeError(ctx, err, map[string]interface{}{"series": seriesId}, w)
+		return
+	}
+
+	writeSeries(s, playerId, http.StatusCreated, w)
+}
+
+// writeSeries hands playerId out in the player cookie, which they keep
+// for every game of the series.
+func writeSeries(s *Series, playerId string, status int, w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{Name: playerCookieConst, Value: playerId})
+	w.Header().Set("Location", apiPrefix+"/series/"+s.Id)
+
+	bs, _ := json.Marshal(newSeriesResponse(s, playerId))
+	w.WriteHeader(status)
+	w.Write(bs)
+}
+
+func newSeriesResponse(s *Series, playerId string) SeriesResponse {
+	response := SeriesResponse{
+		Id:      s.Id,
+		BestOf:  s.BestOf,
+		Status:  s.Status,
+		Wins:    s.Wins,
+		Draws:   s.Draws,
+		Matches: append([]string{}, s.MatchIds...),
+	}
+	for i, p := range s.Players {
+		if playerId != "" && p == playerId {
+			i := i
+			response.Me = &i
+		}
+	}
+	if winner := s.winner(); winner >= 0 {
+		response.Winner = &winner
+	}
+	return response
+}
+
+func (h Handler) getPlayer(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	defer handle5xx(r.Context(), w)
+	setContectType(w)
+
+	// unlike the other handlers, the id is not logged, since it comes in the
+	// path and is the player's credential
+	playerId := ps.ByName("playerId")
+	ctx := r.Context()
+
+	p, err := h.scorekeeper.GetProfile(ctx, playerId)
+	if err != nil {
+		writeError(ctx, err, map[string]interface{}{"player": playerId}, w)
+		return
+	}
+
+	response := PlayerResponse{
+		Id:               p.PlayerId,
+		Alias:            alias(p.PlayerId),
+		Played:           p.Played,
+		Wins:             p.Wins,
+		Losses:           p.Losses,
+		Draws:            p.Draws,
+		AverageMargin:    p.AverageMargin,
+		LongestWinStreak: p.LongestWinStreak,
+		FavoriteOpening:  p.FavoriteOpening,
+		Rating:           p.Rating,
+		RatingHistory:    []RatingResponse{},
+	}
+	for _, c := range p.RatingHistory {
+		response.RatingHistory = append(response.RatingHistory, RatingResponse{Match: c.MatchId, Rating: c.Rating, FinishedAt: c.FinishedAt})
+	}
+
+	bs, _ := json.Marshal(response)
+	w.Write(bs)
+}
+
+func (h Handler) listPlayerMatches(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	defer handle5xx(r.Context(), w)
+	setContectType(w)
+
+	playerId := ps.ByName("playerId")
+	ctx := r.Context()
+
+	offset, limit, err := page(r)
+	if err != nil {
+		writeError(ctx, err, map[string]interface{}{"reason": err.Error()}, w)
+		return
+	}
+
+	matches, total, err := h.scorekeeper.GetMatches(ctx, playerId, offset, limit)
+	if err != nil {
+		writeError(ctx, err, map[string]interface{}{"player": playerId}, w)
+		return
+	}
+
+	response := PlayerMatchesResponse{Matches: []PlayerMatchResponse{}, Total: total, Offset: offset, Limit: limit}
+	for _, m := range matches {
+		response.Matches = append(response.Matches, newPlayerMatchResponse(m, playerId))
+	}
+
+	bs, _ := json.Marshal(response)
+	w.Write(bs)
+}
+
+func newPlayerMatchResponse(m Match, playerId string) PlayerMatchResponse {
+	side := m.side(playerId)
+	response := PlayerMatchResponse{
+		Id:            m.Id,
+		Score:         game.Score(game.Board(m.Board), side),
+		OpponentScore: game.Score(game.Board(m.Board), 1-side),
+	}
+	if m.FinishedAt != nil {
+		response.FinishedAt = *m.FinishedAt
+	}
+
+	switch result(m.Board, side) {
+	case 1:
+		response.Result = "win"
+	case 0:
+		response.Result = "loss"
+	default:
+		response.Result = "draw"
+	}
+
+	if side < len(m.Openings) {
+		response.Opening = &m.Openings[side]
+	}
+	if len(m.Ratings) == 2 {
+		response.Rating = m.Ratings[side]
+	}
+	return response
+}
+
+// getLeaderboard answers the leaderboard of the period holding date, today
+// if there is none.
+func (h Handler) getLeaderboard(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	defer handle5xx(r.Context(), w)
+	setContectType(w)
+
+	ctx := r.Context()
+	q := r.URL.Query()
+
+	offset, limit, err := page(r)
+	if err != nil {
+		writeError(ctx, err, map[string]interface{}{"reason": err.Error()}, w)
+		return
+	}
+
+	variant := allVariants
+	if v := q.Get("variant"); v != "" {
+		if variant, err = strconv.Atoi(v); err != nil || variant < 1 {
+			err = fmt.Errorf("%w: variant must be a number of stones, 1 or more", errInvalidRequest)
+			writeError(ctx, err, map[string]interface{}{"reason": err.Error()}, w)
+			return
+		}
+	}
+
+	at := time.Now()
+	if v := q.Get("date"); v != "" {
+		if at, err = time.Parse(time.DateOnly, v); err != nil {
+			err = fmt.Errorf("%w: date must be formatted as YYYY-MM-DD", errInvalidRequest)
+			writeError(ctx, err, map[string]interface{}{"reason": err.Error()}, w)
+			return
+		}
+	}
+
+	period := q.Get("period")
+	if period == "" {
+		period = AllTimePeriod
+	}
+
+	b, err := newLeaderboard(ps.ByName("by"), variant, period, at)
+	if err != nil {
+		writeError(ctx, err, map[string]interface{}{"by": ps.ByName("by"), "period": period}, w)
+		return
+	}
+
+	entries, total, err := h.scorekeeper.GetLeaderboard(ctx, b, offset, limit)
+	if err != nil {
+		writeError(ctx, err, nil, w)
+		return
+	}
+
+	response := LeaderboardResponse{By: b.By, Period: period, Window: b.Window, Entries: []LeaderboardEntryResponse{}, Total: total, Offset: offset, Limit: limit}
+	if variant != allVariants {
+		response.Variant = &variant
+	}
+	for _, e := range entries {
+		response.Entries = append(response.Entries, LeaderboardEntryResponse{Rank: e.Rank, Player: e.Alias, Score: e.Score})
+	}
+
+	bs, _ := json.Marshal(response)
+	w.Write(bs)
+}
+
+// page reads the offset and limit query parameters of paginated routes.
+func page(r *http.Request) (int, int, error) {
+	offset, limit := 0, defaultPageSize
+
+	q := r.URL.Query()
+	if v := q.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return 0, 0, fmt.Errorf("%w: offset must be a number, 0 or more", errInvalidRequest)
+		}
+		offset = n
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPageSize {
+			return 0, 0, fmt.Errorf("%w: limit must be between 1 and %v", errInvalidRequest, maxPageSize)
+		}
+		limit = n
+	}
+	return offset, limit, nil
+}
+
+// deprecated points clients of the original routes to their successor.
+func deprecated(successor string, h httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", "<"+successor+`>; rel="successor-version"`)
+		h(w, r, ps)
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+)
+
+func TestCreateMatch(t *testing.T) {
+	res := doJSONRequest("POST", "http://localhost:8080/api/v1/matches", "", t)
+
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("expected 201, but got status code %v", res.StatusCode)
+	}
+	if res.Header.Get("Location") != "/api/v1/matches/"+testMatch.Id {
+		t.Fatalf("expected the match location but got %q", res.Header.Get("Location"))
+	}
+
+	bs, _ := ioutil.ReadAll(res.Body)
+	match := MatchResponse{}
+	json.Unmarshal(bs, &match)
+	if match.Id != testMatch.Id {
+		t.Fatalf("wrong match. expected %v but got %v", testMatch.Id, match.Id)
+	}
+
+	if getCookieByName(playerCookieConst, res.Cookies()) == nil {
+		t.Fatal("player cookie not set")
+	}
+}
+
+func TestCreateMatchWithUnknownOpponent(t *testing.T) {
+	res := doJSONRequest("POST", "http://localhost:8080/api/v1/matches", `{"opponent": "grandmaster"}`, t)
+
+	if res.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400, but got status code %v", res.StatusCode)
+	}
+}
+
+func TestGetMatchV1(t *testing.T) {
+	url := fmt.Sprintf("http://localhost:8080/api/v1/matches/%v", testMatch.Id)
+
+	cookie := http.Cookie{Name: playerCookieConst, Value: testMatch.P1}
+	res := execute2xxRequest("GET", url, t, &cookie)
+
+	bs, _ := ioutil.ReadAll(res.Body)
+	match := MatchResponse{}
+	json.Unmarshal(bs, &match)
+	if match.Id != testMatch.Id {
+		t.Fatalf("wrong match. expected %v but got %v", testMatch.Id, match.Id)
+	}
+}
+
+func TestCreateMove(t *testing.T) {
+	url := fmt.Sprintf("http://localhost:8080/api/v1/matches/%v/moves", testMatch.Id)
+
+	cookie := http.Cookie{Name: playerCookieConst, Value: testMatch.P1}
+	res := doJSONRequest("POST", url, `{"pit": 1}`, t, &cookie)
+
+	if res.StatusCode != http.StatusAccepted {
+		t.Fatalf("expected 202, but got status code %v", res.StatusCode)
+	}
+}
+
+func TestCreateMoveNotMyTurn(t *testing.T) {
+	url := fmt.Sprintf("http://localhost:8080/api/v1/matches/%v/moves", testMatch.Id)
+
+	cookie := http.Cookie{Name: playerCookieConst, Value: testMatch.P2}
+	res := doJSONRequest("POST", url, `{"pit": 1}`, t, &cookie)
+
+	if res.StatusCode != http.StatusConflict {
+		t.Fatalf("expected 409, but got status code %v", res.StatusCode)
+	}
+
+	body := ErrorMessage{}
+	json.NewDecoder(res.Body).Decode(&body)
+	if body.Code != "not_your_turn" || body.Details["match"] != testMatch.Id || body.Details["pit"] != 1.0 {
+		t.Fatalf("wrong error: %+v", body)
+	}
+}
+
+func TestCreateMoveOutOfRange(t *testing.T) {
+	url := fmt.Sprintf("http://localhost:8080/api/v1/matches/%v/moves", testMatch.Id)
+
+	cookie := http.Cookie{Name: playerCookieConst, Value: testMatch.P1}
+	res := doJSONRequest("POST", url, `{"pit": -1}`, t, &cookie)
+
+	body := ErrorMessage{}
+	json.NewDecoder(res.Body).Decode(&body)
+	if res.StatusCode != http.StatusBadRequest || body.Code != "pit_out_of_range" {
+		t.Fatalf("expected 400 pit_out_of_range, but got %v %+v", res.StatusCode, body)
+	}
+}
+
+func TestCreateMoveInOtherPlayersMatch(t *testing.T) {
+	url := fmt.Sprintf("http://localhost:8080/api/v1/matches/%v/moves", testMatch.Id)
+
+	cookie := http.Cookie{Name: playerCookieConst, Value: uuid.NewString()}
+	res := doJSONRequest("POST", url, `{"pit": 1}`, t, &cookie)
+
+	body := ErrorMessage{}
+	json.NewDecoder(res.Body).Decode(&body)
+	if res.StatusCode != http.StatusForbidden || body.Code != "not_participant" {
+		t.Fatalf("expected 403 not_participant, but got %v %+v", res.StatusCode, body)
+	}
+}
+
+func TestCreateMoveWithoutPit(t *testing.T) {
+	url := fmt.Sprintf("http://localhost:8080/api/v1/matches/%v/moves", testMatch.Id)
+
+	cookie := http.Cookie{Name: playerCookieConst, Value: testMatch.P1}
+	for _, body := range []string{"", "{}", `{"pit": "one"}`} {
+		res := doJSONRequest("POST", url, body, t, &cookie)
+
+		msg := ErrorMessage{}
+		json.NewDecoder(res.Body).Decode(&msg)
+		if res.StatusCode != http.StatusBadRequest || msg.Code != "invalid_request" {
+			t.Fatalf("expected 400 invalid_request for %q, but got %v %+v", body, res.StatusCode, msg)
+		}
+	}
+}
+
+func TestOfferRematch(t *testing.T) {
+	url := fmt.Sprintf("http://localhost:8080/api/v1/matches/%v/rematch", testMatch.Id)
+
+	cookie := http.Cookie{Name: playerCookieConst, Value: testMatch.P2}
+	res := doJSONRequest("POST", url, "", t, &cookie)
+
+	rematch := RematchResponse{}
+	json.NewDecoder(res.Body).Decode(&rematch)
+	if res.StatusCode != http.StatusAccepted || !rematch.Mine || rematch.NextMatch != "" {
+		t.Fatalf("expected 202 with the pending offer, but got %v %+v", res.StatusCode, rematch)
+	}
+}
+
+func TestAcceptRematch(t *testing.T) {
+	url := fmt.Sprintf("http://localhost:8080/api/v1/matches/%v/rematch", testMatch.Id)
+
+	cookie := http.Cookie{Name: playerCookieConst, Value: testMatch.P1}
+	res := doJSONRequest("POST", url, "", t, &cookie)
+
+	rematch := RematchResponse{}
+	json.NewDecoder(res.Body).Decode(&rematch)
+	if res.StatusCode != http.StatusCreated || rematch.Mine || rematch.NextMatch != testNextMatchId {
+		t.Fatalf("expected 201 with the next match, but got %v %+v", res.StatusCode, rematch)
+	}
+	if location := res.Header.Get("Location"); location != "/api/v1/matches/"+testNextMatchId {
+		t.Fatalf("expected the location of the next match, but got %v", location)
+	}
+}
+
+func TestRematchInOtherPlayersMatch(t *testing.T) {
+	url := fmt.Sprintf("http://localhost:8080/api/v1/matches/%v/rematch", testMatch.Id)
+
+	cookie := http.Cookie{Name: playerCookieConst, Value: uuid.NewString()}
+	res := doJSONRequest("POST", url, "", t, &cookie)
+
+	if res.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403, but got status code %v", res.StatusCode)
+	}
+}
+
+func TestGetMatchShowsTheRematchOffer(t *testing.T) {
+	cookie := http.Cookie{Name: playerCookieConst, Value: testMatch.P1}
+	res := execute2xxRequest("GET", "http://localhost:8080/api/v1/matches/"+testMatch.Id, t, &cookie)
+
+	match := MatchResponse{}
+	json.NewDecoder(res.Body).Decode(&match)
+	if match.Rematch == nil || match.Rematch.Mine {
+		t.Fatalf("expected the offer of the opponent, but got %+v", match.Rematch)
+	}
+}
+
+func TestOpenAPIDocumentsTheRoutes(t *testing.T) {
+	res := execute2xxRequest("GET", "http://localhost:8080/api/v1/openapi.yaml", t)
+
+	doc := struct {
+		OpenAPI string                 `yaml:"openapi"`
+		Paths   map[string]interface{} `yaml:"paths"`
+	}{}
+	if err := yaml.NewDecoder(res.Body).Decode(&doc); err != nil {
+		t.Fatalf("invalid OpenAPI document: %v", err)
+	}
+
+	for _, path := range []string{"/matches", "/matches/{id}", "/matches/{id}/moves", "/matches/{id}/events", "/matches/{id}/rematch", "/series", "/series/{id}", "/series/{id}/players", "/players/{id}", "/players/{id}/matches", "/leaderboards/{by}"} {
+		if doc.Paths[path] == nil {
+			t.Fatalf("%v is not documented", path)
+		}
+	}
+}
+
+func TestLegacyRoutesPointToTheirSuccessor(t *testing.T) {
+	res := execute2xxRequest("GET", "http://localhost:8080", t)
+
+	if res.Header.Get("Deprecation") != "true" || !strings.Contains(res.Header.Get("Link"), "/api/v1/matches") {
+		t.Fatalf("expected deprecation headers but got %v", res.Header)
+	}
+}
+
+func doJSONRequest(method string, url string, body string, t *testing.T, cookies ...*http.Cookie) *http.Response {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal("failed to create http request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal("failed to execute http request")
+	}
+	return res
+}
@@ -0,0 +1,107 @@
+package arena
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+
+	"github.com/dacruz/mancala/game"
+)
+
+// State is what an agent observes before choosing a pit. The board is
+// always seen from the agent's side: Board[0] holds the agent's pits.
+type State struct {
+	Board game.Board
+	Legal []int
+	Moves int
+}
+
+type Agent interface {
+	// Choose returns the pit to play. Returning an illegal pit or an error
+	// forfeits the game.
+	Choose(State) (int, error)
+}
+
+// Player creates a new Agent for every game it plays, so agents can keep
+// per game state and games can run in parallel. Agents implementing
+// io.Closer are closed once the game is over.
+type Player struct {
+	Name string
+	New  func(seed int64) (Agent, error)
+}
+
+type RandomAgent struct {
+	rnd *rand.Rand
+}
+
+func (a *RandomAgent) Choose(s State) (int, error) {
+	return s.Legal[a.rnd.Intn(len(s.Legal))], nil
+}
+
+// FirstAgent always plays the leftmost pit with stones.
+type FirstAgent struct{}
+
+func (a FirstAgent) Choose(s State) (int, error) {
+	return s.Legal[0], nil
+}
+
+// GreedyAgent plays the pit that puts most stones in its store, breaking
+// ties at random.
+type GreedyAgent struct {
+	rnd *rand.Rand
+}
+
+func (a *GreedyAgent) Choose(s State) (int, error) {
+	best := []int{}
+	bestStore := -1
+	for _, pit := range s.Legal {
+		b, err := game.Play(s.Board, 0, pit)
+		if err != nil {
+			continue
+		}
+
+		switch {
+		case b[0][game.Store] > bestStore:
+			bestStore = b[0][game.Store]
+			best = []int{pit}
+		case b[0][game.Store] == bestStore:
+			best = append(best, pit)
+		}
+	}
+
+	if len(best) == 0 {
+		return s.Legal[0], nil
+	}
+	return best[a.rnd.Intn(len(best))], nil
+}
+
+var builtins = map[string]func(seed int64) (Agent, error){
+	"random": func(seed int64) (Agent, error) {
+		return &RandomAgent{rnd: rand.New(rand.NewSource(seed))}, nil
+	},
+	"first": func(seed int64) (Agent, error) {
+		return FirstAgent{}, nil
+	},
+	"greedy": func(seed int64) (Agent, error) {
+		return &GreedyAgent{rnd: rand.New(rand.NewSource(seed))}, nil
+	},
+}
+
+// Builtin returns the Player for one of the agents shipped with the arena.
+func Builtin(name string) (Player, error) {
+	newAgent, ok := builtins[name]
+	if !ok {
+		return Player{}, fmt.Errorf("unknown agent %q, available: %v", name, strings.Join(BuiltinNames(), ", "))
+	}
+	return Player{Name: name, New: newAgent}, nil
+}
+
+func BuiltinNames() []string {
+	names := []string{}
+	for name := range builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
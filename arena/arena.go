@@ -0,0 +1,278 @@
+// Package arena plays mancala games between agents in-process, using the
+// same rules as the server, and runs tournaments between them.
+package arena
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"runtime"
+	"sort"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/dacruz/mancala/game"
+	"github.com/dacruz/mancala/pairing"
+)
+
+const (
+	maxMoves int = 1000
+)
+
+type Format string
+
+const (
+	RoundRobin Format = "roundrobin"
+	Swiss      Format = "swiss"
+)
+
+type GameResult struct {
+	Players [2]string
+	Scores  [2]int
+	Moves   int
+	// index of the player that forfeited the game, -1 if none did
+	Forfeit int
+	Err     error
+}
+
+// Winner returns the index of the winning player, or -1 on a draw.
+func (r GameResult) Winner() int {
+	if r.Forfeit >= 0 {
+		return 1 - r.Forfeit
+	}
+
+	switch {
+	case r.Scores[0] > r.Scores[1]:
+		return 0
+	case r.Scores[1] > r.Scores[0]:
+		return 1
+	}
+	return -1
+}
+
+// PlayGame plays a single game. players[0] moves first.
+func PlayGame(players [2]Player, seed int64) GameResult {
+	r := GameResult{Players: [2]string{players[0].Name, players[1].Name}, Forfeit: -1}
+	rnd := rand.New(rand.NewSource(seed))
+
+	agents := [2]Agent{}
+	for i, p := range players {
+		a, err := p.New(rnd.Int63())
+		if err != nil {
+			r.Forfeit = i
+			r.Err = fmt.Errorf("%v: %w", p.Name, err)
+			closeAgents(agents)
+			return r
+		}
+		agents[i] = a
+	}
+	defer closeAgents(agents)
+
+	b := game.NewBoard()
+	side := 0
+	for ; r.Moves < maxMoves && !game.Over(b); r.Moves++ {
+		view := game.Board{b[side], b[1-side]}.Copy()
+		s := State{Board: view, Legal: game.LegalMoves(view, 0), Moves: r.Moves}
+
+		pit, err := agents[side].Choose(s)
+		if err == nil {
+			b, err = game.Play(b, side, pit)
+		}
+		if err != nil {
+			r.Forfeit = side
+			r.Err = fmt.Errorf("%v: %w", players[side].Name, err)
+			break
+		}
+
+		side = 1 - side
+	}
+
+	r.Scores[0] = game.Score(b, 0)
+	r.Scores[1] = game.Score(b, 1)
+	return r
+}
+
+func closeAgents(agents [2]Agent) {
+	for _, a := range agents {
+		if c, ok := a.(io.Closer); ok {
+			c.Close()
+		}
+	}
+}
+
+type Tournament struct {
+	Players []Player
+	Format  Format
+	// number of rounds of a Swiss tournament
+	Rounds int
+	// games per pairing, each one played once with each player moving first
+	Games   int
+	Seed    int64
+	Workers int
+}
+
+type Standing struct {
+	Name     string
+	Played   int
+	Wins     int
+	Draws    int
+	Losses   int
+	Byes     int
+	Forfeits int
+	margin   int
+	moves    int
+}
+
+func (s Standing) Points() float64 {
+	return float64(s.Wins+s.Byes) + float64(s.Draws)/2
+}
+
+func (s Standing) AvgMargin() float64 {
+	if s.Played == 0 {
+		return 0
+	}
+	return float64(s.margin) / float64(s.Played)
+}
+
+func (s Standing) AvgLength() float64 {
+	if s.Played == 0 {
+		return 0
+	}
+	return float64(s.moves) / float64(s.Played)
+}
+
+// Run plays the tournament and returns the standings, best player first.
+func (t Tournament) Run() []Standing {
+	rnd := rand.New(rand.NewSource(t.Seed))
+	standings := make([]Standing, len(t.Players))
+	for i, p := range t.Players {
+		standings[i].Name = p.Name
+	}
+
+	switch t.Format {
+	case Swiss:
+		played := map[[2]int]bool{}
+		hadBye := map[int]bool{}
+		for round := 0; round < t.Rounds; round++ {
+			pairings, bye := swissPairings(standings, played, hadBye)
+			if bye >= 0 {
+				standings[bye].Byes++
+				hadBye[bye] = true
+			}
+			for _, p := range pairings {
+				played[p] = true
+				played[[2]int{p[1], p[0]}] = true
+			}
+			t.play(pairings, standings, rnd)
+		}
+	default:
+		pairings := [][2]int{}
+		for i := range t.Players {
+			for j := i + 1; j < len(t.Players); j++ {
+				pairings = append(pairings, [2]int{i, j})
+			}
+		}
+		t.play(pairings, standings, rnd)
+	}
+
+	sorted := append([]Standing{}, standings...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Points() != sorted[j].Points() {
+			return sorted[i].Points() > sorted[j].Points()
+		}
+		return sorted[i].AvgMargin() > sorted[j].AvgMargin()
+	})
+	return sorted
+}
+
+type scheduledGame struct {
+	players [2]int
+	seed    int64
+}
+
+func (t Tournament) play(pairings [][2]int, standings []Standing, rnd *rand.Rand) {
+	// seeds are drawn up front so results do not depend on scheduling
+	games := []scheduledGame{}
+	for _, p := range pairings {
+		for g := 0; g < t.Games; g++ {
+			games = append(games, scheduledGame{players: p, seed: rnd.Int63()})
+			games = append(games, scheduledGame{players: [2]int{p[1], p[0]}, seed: rnd.Int63()})
+		}
+	}
+
+	workers := t.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	in := make(chan scheduledGame)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for g := range in {
+				r := PlayGame([2]Player{t.Players[g.players[0]], t.Players[g.players[1]]}, g.seed)
+				mu.Lock()
+				record(r, g.players, standings)
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, g := range games {
+		in <- g
+	}
+	close(in)
+	wg.Wait()
+}
+
+func record(r GameResult, players [2]int, standings []Standing) {
+	winner := r.Winner()
+	for side, i := range players {
+		s := &standings[i]
+		s.Played++
+		s.margin += r.Scores[side] - r.Scores[1-side]
+		s.moves += r.Moves
+
+		switch winner {
+		case -1:
+			s.Draws++
+		case side:
+			s.Wins++
+		default:
+			s.Losses++
+		}
+
+		if r.Forfeit == side {
+			s.Forfeits++
+		}
+	}
+}
+
+// swissPairings ranks players by points and pairs them with
+// pairing.Swiss.
+func swissPairings(standings []Standing, played map[[2]int]bool, hadBye map[int]bool) ([][2]int, int) {
+	ranking := make([]int, len(standings))
+	for i := range ranking {
+		ranking[i] = i
+	}
+	sort.SliceStable(ranking, func(i, j int) bool {
+		return standings[ranking[i]].Points() > standings[ranking[j]].Points()
+	})
+
+	return pairing.Swiss(ranking,
+		func(a, b int) bool { return played[[2]int{a, b}] },
+		func(p int) bool { return hadBye[p] })
+}
+
+func WriteTable(w io.Writer, standings []Standing) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "#\tagent\tplayed\twins\tdraws\tlosses\tpoints\tavg margin\tavg length\tforfeits\t")
+	for i, s := range standings {
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\t%v\t%.1f\t%.2f\t%.1f\t%v\t\n",
+			i+1, s.Name, s.Played, s.Wins, s.Draws, s.Losses, s.Points(), s.AvgMargin(), s.AvgLength(), s.Forfeits)
+	}
+	return tw.Flush()
+}
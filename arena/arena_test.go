@@ -0,0 +1,111 @@
+package arena
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type failingAgent struct{}
+
+func (a failingAgent) Choose(s State) (int, error) {
+	return 0, errors.New("boom")
+}
+
+func builtin(name string, t *testing.T) Player {
+	p, err := Builtin(name)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return p
+}
+
+func TestPlayGameEnds(t *testing.T) {
+	r := PlayGame([2]Player{builtin("random", t), builtin("greedy", t)}, 42)
+
+	if r.Err != nil {
+		t.Fatalf("unexpected error: %v", r.Err)
+	}
+
+	if r.Moves == 0 || r.Moves >= maxMoves {
+		t.Fatalf("unexpected game length: %v", r.Moves)
+	}
+
+	if r.Scores[0]+r.Scores[1] != 72 {
+		t.Fatalf("stones were lost: %v", r.Scores)
+	}
+}
+
+func TestPlayGameIsReproducible(t *testing.T) {
+	players := [2]Player{builtin("random", t), builtin("random", t)}
+
+	first := PlayGame(players, 7)
+	second := PlayGame(players, 7)
+
+	if !reflect.DeepEqual(first, second) {
+		t.Fatalf("same seed, different games: %v and %v", first, second)
+	}
+}
+
+func TestFailingAgentForfeits(t *testing.T) {
+	failing := Player{Name: "failing", New: func(int64) (Agent, error) { return failingAgent{}, nil }}
+
+	r := PlayGame([2]Player{failing, builtin("first", t)}, 1)
+
+	if r.Forfeit != 0 || r.Winner() != 1 {
+		t.Fatalf("failing agent should forfeit: %+v", r)
+	}
+}
+
+func TestRoundRobin(t *testing.T) {
+	tournament := Tournament{
+		Players: []Player{builtin("random", t), builtin("greedy", t), builtin("first", t)},
+		Format:  RoundRobin,
+		Games:   2,
+		Seed:    3,
+	}
+
+	standings := tournament.Run()
+
+	for _, s := range standings {
+		// 2 opponents, 2 games per side
+		if s.Played != 8 {
+			t.Fatalf("%v expected to play 8 games but played %v", s.Name, s.Played)
+		}
+		if s.Wins+s.Draws+s.Losses != s.Played {
+			t.Fatalf("results do not add up: %+v", s)
+		}
+	}
+
+	if !reflect.DeepEqual(standings, tournament.Run()) {
+		t.Fatal("tournament is not reproducible")
+	}
+}
+
+func TestSwissGivesByeWithOddPlayers(t *testing.T) {
+	tournament := Tournament{
+		Players: []Player{builtin("random", t), builtin("greedy", t), builtin("first", t)},
+		Format:  Swiss,
+		Rounds:  3,
+		Games:   1,
+		Seed:    3,
+	}
+
+	byes := 0
+	for _, s := range tournament.Run() {
+		byes += s.Byes
+		if s.Byes > 1 {
+			t.Fatalf("%v had more than one bye", s.Name)
+		}
+	}
+
+	if byes != 3 {
+		t.Fatalf("expected one bye per round but got %v", byes)
+	}
+}
+
+func TestUnknownBuiltin(t *testing.T) {
+	if _, err := Builtin("unknown"); err == nil {
+		t.Fatal("error expected")
+	}
+}
@@ -0,0 +1,226 @@
+package bot
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dacruz/mancala/arena"
+)
+
+const (
+	startTimeout time.Duration = 5 * time.Second
+	// time given on top of movetime for the answer to reach the host
+	moveGrace time.Duration = 100 * time.Millisecond
+)
+
+var (
+	ErrTimeout = errors.New("bot did not answer in time")
+	ErrCrashed = errors.New("bot process exited")
+)
+
+// Process is an arena.Agent backed by an external bot process. If the bot
+// crashes or runs out of time it is stopped, Choose returns an error and
+// the next call to Choose starts a new process.
+type Process struct {
+	Command  []string
+	MoveTime time.Duration
+	Name     string
+
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	lines chan string
+}
+
+// Start runs the bot command and waits for it to be ready.
+func Start(command []string, moveTime time.Duration) (*Process, error) {
+	p := &Process{Command: command, MoveTime: moveTime}
+	if err := p.start(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Player returns an arena player that starts a new bot process for every
+// game.
+func Player(name string, command []string, moveTime time.Duration) arena.Player {
+	return arena.Player{
+		Name: name,
+		New: func(seed int64) (arena.Agent, error) {
+			return Start(command, moveTime)
+		},
+	}
+}
+
+func (p *Process) start() error {
+	if len(p.Command) == 0 {
+		return errors.New("empty bot command")
+	}
+
+	cmd := exec.Command(p.Command[0], p.Command[1:]...)
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		s := bufio.NewScanner(stdout)
+		for s.Scan() {
+			lines <- s.Text()
+		}
+	}()
+
+	p.cmd, p.stdin, p.lines = cmd, stdin, lines
+
+	if err := p.send("mancala"); err != nil {
+		return err
+	}
+	reply, err := p.await("mancalaok", startTimeout)
+	if err != nil {
+		return err
+	}
+	p.Name = reply.name
+
+	if err := p.send("newgame"); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (p *Process) Choose(s arena.State) (int, error) {
+	if p.cmd == nil {
+		if err := p.start(); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := p.send(formatPosition(s.Board)); err != nil {
+		return 0, err
+	}
+	if err := p.send(fmt.Sprintf("go movetime %v", p.MoveTime.Milliseconds())); err != nil {
+		return 0, err
+	}
+
+	reply, err := p.await("bestmove", p.MoveTime+moveGrace)
+	if err != nil {
+		return 0, err
+	}
+	return reply.pit, nil
+}
+
+// Close asks the bot to quit and stops the process.
+func (p *Process) Close() error {
+	if p.cmd == nil {
+		return nil
+	}
+	p.send("quit")
+	p.stop()
+	return nil
+}
+
+type reply struct {
+	name string
+	pit  int
+}
+
+// await reads lines until one starting with keyword arrives. Any failure
+// stops the process.
+func (p *Process) await(keyword string, timeout time.Duration) (reply, error) {
+	r := reply{}
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	for {
+		select {
+		case line, ok := <-p.lines:
+			if !ok {
+				p.stop()
+				return r, ErrCrashed
+			}
+
+			fields := strings.Fields(line)
+			if len(fields) == 0 {
+				continue
+			}
+
+			switch {
+			case fields[0] == "id" && len(fields) > 2 && fields[1] == "name":
+				r.name = strings.Join(fields[2:], " ")
+			case fields[0] != keyword:
+				continue
+			case keyword == "bestmove":
+				if len(fields) < 2 {
+					p.stop()
+					return r, fmt.Errorf("invalid answer %q", line)
+				}
+				pit, err := strconv.Atoi(fields[1])
+				if err != nil {
+					p.stop()
+					return r, fmt.Errorf("invalid answer %q", line)
+				}
+				r.pit = pit
+				return r, nil
+			default:
+				return r, nil
+			}
+
+		case <-deadline.C:
+			p.stop()
+			return r, ErrTimeout
+		}
+	}
+}
+
+func (p *Process) send(line string) error {
+	if _, err := fmt.Fprintln(p.stdin, line); err != nil {
+		p.stop()
+		return ErrCrashed
+	}
+	return nil
+}
+
+func (p *Process) stop() {
+	if p.cmd == nil {
+		return
+	}
+
+	// keep the reader from blocking on lines nobody is waiting for
+	go func(lines chan string) {
+		for range lines {
+		}
+	}(p.lines)
+
+	p.stdin.Close()
+	done := make(chan struct{})
+	go func() {
+		p.cmd.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(moveGrace):
+		p.cmd.Process.Kill()
+		<-done
+	}
+
+	p.cmd = nil
+}
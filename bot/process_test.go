@@ -0,0 +1,120 @@
+package bot
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dacruz/mancala/arena"
+	"github.com/dacruz/mancala/game"
+)
+
+const (
+	helperEnv = "MANCALA_TEST_BOT"
+)
+
+// TestMain turns the test binary into a bot when helperEnv is set, so the
+// tests can start it as an external process.
+func TestMain(m *testing.M) {
+	switch os.Getenv(helperEnv) {
+	case "":
+		os.Exit(m.Run())
+	case "first":
+		Serve("first", arena.FirstAgent{}, os.Stdin, os.Stdout)
+	case "slow":
+		Serve("slow", slowAgent{}, os.Stdin, os.Stdout)
+	case "crash":
+		// answers the handshake and dies when asked for a move
+		s := bufio.NewScanner(os.Stdin)
+		for s.Scan() {
+			switch {
+			case s.Text() == "mancala":
+				fmt.Println("mancalaok")
+			case strings.HasPrefix(s.Text(), "go"):
+				os.Exit(1)
+			}
+		}
+	}
+	os.Exit(0)
+}
+
+type slowAgent struct{}
+
+func (a slowAgent) Choose(s arena.State) (int, error) {
+	time.Sleep(time.Second)
+	return s.Legal[0], nil
+}
+
+func helperCommand(t *testing.T, mode string) []string {
+	os.Setenv(helperEnv, mode)
+	t.Cleanup(func() { os.Unsetenv(helperEnv) })
+	return []string{os.Args[0]}
+}
+
+func testState() arena.State {
+	b := game.NewBoard()
+	return arena.State{Board: b, Legal: game.LegalMoves(b, 0)}
+}
+
+func TestProcessPlays(t *testing.T) {
+	p, err := Start(helperCommand(t, "first"), 100*time.Millisecond)
+	if err != nil {
+		t.Fatalf("failed to start bot: %v", err)
+	}
+	defer p.Close()
+
+	if p.Name != "first" {
+		t.Fatalf("expected bot name first but got %v", p.Name)
+	}
+
+	pit, err := p.Choose(testState())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if pit != 0 {
+		t.Fatalf("expected pit 0 but got %v", pit)
+	}
+}
+
+func TestProcessTimeout(t *testing.T) {
+	p, err := Start(helperCommand(t, "slow"), 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("failed to start bot: %v", err)
+	}
+	defer p.Close()
+
+	_, err = p.Choose(testState())
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected ErrTimeout but got %v", err)
+	}
+}
+
+func TestProcessCrash(t *testing.T) {
+	p, err := Start(helperCommand(t, "crash"), 100*time.Millisecond)
+	if err != nil {
+		t.Fatalf("failed to start bot: %v", err)
+	}
+	defer p.Close()
+
+	_, err = p.Choose(testState())
+	if !errors.Is(err, ErrCrashed) {
+		t.Fatalf("expected ErrCrashed but got %v", err)
+	}
+}
+
+func TestProcessInArena(t *testing.T) {
+	players := [2]arena.Player{Player("bot", helperCommand(t, "first"), 100*time.Millisecond), {
+		Name: "first",
+		New:  func(int64) (arena.Agent, error) { return arena.FirstAgent{}, nil },
+	}}
+
+	r := arena.PlayGame(players, 1)
+	if r.Err != nil {
+		t.Fatalf("unexpected error: %v", r.Err)
+	}
+}
@@ -0,0 +1,105 @@
+// Package bot lets mancala bots written in any language play in the arena
+// or against players on the server, by talking a line based protocol over
+// the bot's stdin and stdout, loosely modeled after UCI:
+//
+//	host                          bot
+//	mancala                       id name <name>     (optional)
+//	                              mancalaok
+//	isready                       readyok
+//	newgame
+//	position <14 numbers>
+//	go movetime <milliseconds>    bestmove <pit>
+//	quit
+//
+// position holds the board from the bot's point of view: its 6 pits and its
+// store, then the opponent's 6 pits and store. Pits are numbered from 0 to 5.
+// The bot has movetime milliseconds to answer a go command, otherwise it is
+// stopped. Lines that are not understood are ignored on both sides, so bots
+// can print "info ..." lines for debugging.
+package bot
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/dacruz/mancala/arena"
+	"github.com/dacruz/mancala/game"
+)
+
+func formatPosition(b game.Board) string {
+	fields := []string{"position"}
+	for _, side := range b {
+		for _, stones := range side {
+			fields = append(fields, strconv.Itoa(stones))
+		}
+	}
+	return strings.Join(fields, " ")
+}
+
+func parsePosition(fields []string) (game.Board, error) {
+	if len(fields) != 2*(game.Pits+1) {
+		return nil, fmt.Errorf("expected %v numbers but got %v", 2*(game.Pits+1), len(fields))
+	}
+
+	l := make([]int, len(fields))
+	for i, f := range fields {
+		n, err := strconv.Atoi(f)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid number of stones %q", f)
+		}
+		l[i] = n
+	}
+	return game.FromLinear(l, 0), nil
+}
+
+// Serve speaks the bot side of the protocol on r and w, choosing moves with
+// agent. It is what a Go bot needs to be run as an external process.
+func Serve(name string, agent arena.Agent, r io.Reader, w io.Writer) error {
+	s := bufio.NewScanner(r)
+	var board game.Board
+
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		var err error
+		switch fields[0] {
+		case "mancala":
+			_, err = fmt.Fprintf(w, "id name %v\nmancalaok\n", name)
+		case "isready":
+			_, err = fmt.Fprintln(w, "readyok")
+		case "newgame":
+			board = nil
+		case "position":
+			board, err = parsePosition(fields[1:])
+			if err != nil {
+				fmt.Fprintf(w, "info error %v\n", err)
+				err = nil
+			}
+		case "go":
+			if board == nil {
+				fmt.Fprintln(w, "info error no position")
+				continue
+			}
+			var pit int
+			pit, err = agent.Choose(arena.State{Board: board, Legal: game.LegalMoves(board, 0)})
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprintf(w, "bestmove %v\n", pit)
+		case "quit":
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.Err()
+}
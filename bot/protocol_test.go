@@ -0,0 +1,36 @@
+package bot
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/dacruz/mancala/arena"
+)
+
+func TestServe(t *testing.T) {
+	in := strings.NewReader("mancala\nisready\nnewgame\nposition 0 0 3 0 0 0 0 6 6 6 6 6 6 0\ngo movetime 100\nquit\n")
+	out := bytes.Buffer{}
+
+	if err := Serve("first", arena.FirstAgent{}, in, &out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := "id name first\nmancalaok\nreadyok\nbestmove 2\n"
+	if out.String() != expected {
+		t.Fatalf("expected %q but got %q", expected, out.String())
+	}
+}
+
+func TestServeIgnoresInvalidPosition(t *testing.T) {
+	in := strings.NewReader("position 1 2 3\ngo movetime 100\n")
+	out := bytes.Buffer{}
+
+	if err := Serve("first", arena.FirstAgent{}, in, &out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if strings.Contains(out.String(), "bestmove") {
+		t.Fatalf("no move expected without a valid position: %q", out.String())
+	}
+}
@@ -0,0 +1,334 @@
+// Package client is a Go client for the mancala server HTTP API.
+//
+// A Client plays as a single player: the player_id cookie handed out when
+// joining a match is kept in the client's cookie jar and sent on every
+// following request.
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	playerCookie = "player_id"
+	apiPrefix    = "/api/v1"
+)
+
+var (
+	ErrUnauthorized = errors.New("not your match")
+	ErrNotFound     = errors.New("match not found")
+	ErrInvalidMove  = errors.New("invalid move")
+	// the match does not allow the move now, it may be over
+	ErrConflict = errors.New("move not allowed now")
+	ErrServer   = errors.New("server error")
+)
+
+// Match is the view of a match from the point of view of the player.
+// Board[0] is always the player's side and Board[1] the opponent's.
+type Match struct {
+	Id     string  `json:"match"`
+	Board  [][]int `json:"board"`
+	MyTurn bool    `json:"my_turn"`
+	// LegalMoves are the pits of Board[0] the player can sow now.
+	LegalMoves []int `json:"legal_moves"`
+	// LastMove is nil until the first move of the match is made.
+	LastMove *LastMove `json:"last_move"`
+	// PreviousMatch is the match this one is a rematch of, if any.
+	PreviousMatch string `json:"previous_match"`
+	// Rematch is nil until a player of the finished match offers one.
+	Rematch *Rematch `json:"rematch"`
+	// Series is nil for matches outside best-of series.
+	Series *Series `json:"series"`
+}
+
+// Series is the score of the series of a match from the player's side.
+type Series struct {
+	Id     string `json:"id"`
+	BestOf int    `json:"best_of"`
+	// Game is the number of the match in the series, from 1.
+	Game   int    `json:"game"`
+	Wins   int    `json:"wins"`
+	Losses int    `json:"losses"`
+	Draws  int    `json:"draws"`
+	Status string `json:"status"`
+	// NextMatch is empty until the match is over, and for the last game.
+	NextMatch string `json:"next_match"`
+}
+
+type LastMove struct {
+	Pit int `json:"pit"`
+	// Mine tells if the player made it, or else their opponent.
+	Mine bool `json:"mine"`
+}
+
+type Rematch struct {
+	// Mine tells if the player offered it, or else their opponent.
+	Mine bool `json:"mine"`
+	// NextMatch is empty until the rematch is accepted.
+	NextMatch string `json:"next_match"`
+}
+
+// Error is returned for every non 2xx response. It wraps one of the
+// Err* values so callers can use errors.Is.
+type Error struct {
+	StatusCode int
+	// Code is the server's machine readable reason, like "pit_empty".
+	Code    string
+	Message string
+	Details map[string]interface{}
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("mancala: %v (status %v)", e.Message, e.StatusCode)
+}
+
+func (e *Error) Unwrap() error {
+	switch {
+	case e.StatusCode == http.StatusUnauthorized, e.StatusCode == http.StatusForbidden:
+		return ErrUnauthorized
+	case e.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case e.StatusCode == http.StatusBadRequest, e.StatusCode == http.StatusUnprocessableEntity:
+		return ErrInvalidMove
+	case e.StatusCode == http.StatusConflict:
+		return ErrConflict
+	case e.StatusCode >= 500:
+		return ErrServer
+	}
+	return nil
+}
+
+type Client struct {
+	baseURL *url.URL
+	http    *http.Client
+}
+
+func New(baseURL string) (*Client, error) {
+	return NewWithHTTPClient(baseURL, &http.Client{})
+}
+
+// NewWithHTTPClient uses hc for all requests. A cookie jar is added to hc
+// if it does not have one yet.
+func NewWithHTTPClient(baseURL string, hc *http.Client) (*Client, error) {
+	u, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+	if err != nil {
+		return nil, err
+	}
+
+	if hc.Jar == nil {
+		jar, err := cookiejar.New(nil)
+		if err != nil {
+			return nil, err
+		}
+		hc.Jar = jar
+	}
+
+	return &Client{baseURL: u, http: hc}, nil
+}
+
+// PlayerId returns the id assigned by the server on Join, or an empty
+// string if the client has not joined a match yet.
+func (c *Client) PlayerId() string {
+	// the server sets it for the path of the API
+	u, _ := url.Parse(c.baseURL.String() + apiPrefix + "/matches")
+	for _, ck := range c.http.Jar.Cookies(u) {
+		if ck.Name == playerCookie {
+			return ck.Value
+		}
+	}
+	return ""
+}
+
+// Join joins a waiting match or creates a new one.
+func (c *Client) Join(ctx context.Context) (*Match, error) {
+	m := Match{}
+	if err := c.do(ctx, http.MethodPost, apiPrefix+"/matches", nil, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (c *Client) Get(ctx context.Context, matchId string) (*Match, error) {
+	m := Match{}
+	path := fmt.Sprintf("%v/matches/%v", apiPrefix, url.PathEscape(matchId))
+	if err := c.do(ctx, http.MethodGet, path, nil, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// Move plays the given pit. It returns false if the server did not accept
+// the move, which happens when it is not the player's turn or another move
+// is still being processed.
+func (c *Client) Move(ctx context.Context, matchId string, pit int) (bool, error) {
+	path := fmt.Sprintf("%v/matches/%v/moves", apiPrefix, url.PathEscape(matchId))
+	err := c.do(ctx, http.MethodPost, path, map[string]int{"pit": pit}, nil)
+
+	var apiErr *Error
+	if errors.As(err, &apiErr) && (apiErr.Code == "not_your_turn" || apiErr.Code == "conflict") {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Rematch offers a rematch of the finished match, or accepts the one the
+// opponent offered. The player keeps their id in the next match.
+func (c *Client) Rematch(ctx context.Context, matchId string) (*Rematch, error) {
+	r := Rematch{}
+	path := fmt.Sprintf("%v/matches/%v/rematch", apiPrefix, url.PathEscape(matchId))
+	if err := c.do(ctx, http.MethodPost, path, nil, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// WaitTurn polls the match every interval until it is the player's turn or
+// ctx is done.
+func (c *Client) WaitTurn(ctx context.Context, matchId string, interval time.Duration) (*Match, error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		m, err := c.Get(ctx, matchId)
+		if err != nil {
+			return nil, err
+		}
+		if m.MyTurn {
+			return m, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Watch calls f with the match every time it changes, from the server's
+// event stream, until the server ends the stream once the match is over.
+// It stops early with the error of f or when ctx is done.
+func (c *Client) Watch(ctx context.Context, matchId string, f func(*Match) error) error {
+	path := fmt.Sprintf("%v/matches/%v/events", apiPrefix, url.PathEscape(matchId))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL.String()+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	// the timeout of the client is meant for single requests
+	hc := *c.http
+	hc.Timeout = 0
+	res, err := hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return readError(res)
+	}
+
+	event, data := "", ""
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data += strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		case line == "":
+			if event == "match" {
+				m := Match{}
+				if err := json.Unmarshal([]byte(data), &m); err != nil {
+					return fmt.Errorf("mancala: invalid event: %w", err)
+				}
+				if err := f(&m); err != nil {
+					return err
+				}
+			}
+			event, data = "", ""
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return scanner.Err()
+}
+
+// do sends in, if not nil, as the JSON body of the request and decodes the
+// response into out.
+func (c *Client) do(ctx context.Context, method string, path string, in interface{}, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		bs, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(bs)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL.String()+path, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return readError(res)
+	}
+
+	if out == nil || res.StatusCode == http.StatusNoContent {
+		io.Copy(io.Discard, res.Body)
+		return nil
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		return fmt.Errorf("mancala: invalid response: %w", err)
+	}
+	return nil
+}
+
+// readError reads the error body of the server, or of older servers which
+// only sent the message in "error".
+func readError(res *http.Response) error {
+	body := struct {
+		Code          string                 `json:"code"`
+		Message       string                 `json:"message"`
+		Details       map[string]interface{} `json:"details"`
+		LegacyMessage string                 `json:"error"`
+	}{}
+	bs, _ := io.ReadAll(res.Body)
+	json.Unmarshal(bs, &body)
+
+	if body.Message == "" {
+		body.Message = body.LegacyMessage
+	}
+	if body.Message == "" {
+		body.Message = http.StatusText(res.StatusCode)
+	}
+	return &Error{StatusCode: res.StatusCode, Code: body.Code, Message: body.Message, Details: body.Details}
+}
@@ -0,0 +1,280 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testMatchId  = "a-match"
+	testPlayerId = "a-player"
+)
+
+func newTestServer() *httptest.Server {
+	turns := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/matches", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		http.SetCookie(w, &http.Cookie{Name: playerCookie, Value: testPlayerId})
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"match":"a-match","board":[[6,6,6,6,6,6,0],[6,6,6,6,6,6,0]],"my_turn":false}`))
+	})
+	mux.HandleFunc("/api/v1/matches/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if ck, err := r.Cookie(playerCookie); err != nil || ck.Value != testPlayerId {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"code":"unauthorized","message":"not your match"}`))
+			return
+		}
+
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v1/matches/"), "/")
+		if parts[0] != testMatchId {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"code":"match_not_found","message":"match ` + parts[0] + ` not found"}`))
+			return
+		}
+
+		switch {
+		case r.Method == http.MethodPost && len(parts) == 2 && parts[1] == "moves":
+			move := struct{ Pit int }{}
+			json.NewDecoder(r.Body).Decode(&move)
+			switch move.Pit {
+			case 1:
+				w.WriteHeader(http.StatusAccepted)
+			case 2:
+				w.WriteHeader(http.StatusConflict)
+				w.Write([]byte(`{"code":"not_your_turn","message":"not your turn"}`))
+			case 3:
+				w.WriteHeader(http.StatusConflict)
+				w.Write([]byte(`{"code":"match_finished","message":"match is over"}`))
+			case 0:
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				w.Write([]byte(`{"code":"pit_empty","message":"pit is empty","details":{"pit":0},"error":"pit is empty"}`))
+			default:
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"code":"pit_out_of_range","message":"pit out of range"}`))
+			}
+		case r.Method == http.MethodPost && len(parts) == 2 && parts[1] == "rematch":
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"mine":false,"next_match":"next-match"}`))
+		case r.Method == http.MethodGet && len(parts) == 2 && parts[1] == "events":
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("event: match\ndata: {\"match\":\"a-match\",\"board\":[[6,6,6,6,6,6,0],[6,6,6,6,6,6,0]],\"my_turn\":true}\n\n"))
+			w.Write([]byte(": keep-alive\n\n"))
+			w.Write([]byte("event: match\ndata: {\"match\":\"a-match\",\"board\":[[0,7,7,7,7,7,1],[6,6,6,6,6,6,0]],\"last_move\":{\"pit\":0,\"mine\":true}}\n\n"))
+		case r.Method == http.MethodGet && len(parts) == 1:
+			turns++
+			if turns > 2 {
+				w.Write([]byte(`{"match":"a-match","board":[[6,6,6,6,6,6,0],[6,6,6,6,6,6,0]],"my_turn":true}`))
+				return
+			}
+			w.Write([]byte(`{"match":"a-match","board":[[6,6,6,6,6,6,0],[6,6,6,6,6,6,0]],"my_turn":false}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	return httptest.NewServer(mux)
+}
+
+func newTestClient(t *testing.T) (*Client, *httptest.Server) {
+	s := newTestServer()
+	c, err := New(s.URL)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	return c, s
+}
+
+func TestJoinKeepsPlayerCookie(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	m, err := c.Join(context.Background())
+	if err != nil {
+		t.Fatalf("failed to join: %v", err)
+	}
+
+	if m.Id != testMatchId {
+		t.Fatalf("wrong match. expected %v but got %v", testMatchId, m.Id)
+	}
+
+	if c.PlayerId() != testPlayerId {
+		t.Fatalf("wrong player. expected %v but got %v", testPlayerId, c.PlayerId())
+	}
+
+	if _, err := c.Get(context.Background(), m.Id); err != nil {
+		t.Fatalf("player cookie was not sent: %v", err)
+	}
+}
+
+func TestGetWithoutJoinIsUnauthorized(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	_, err := c.Get(context.Background(), testMatchId)
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("expected ErrUnauthorized but got %v", err)
+	}
+
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.Message != "not your match" {
+		t.Fatalf("expected server message but got %v", err)
+	}
+}
+
+func TestGetUnknownMatch(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	c.Join(context.Background())
+	_, err := c.Get(context.Background(), "unknown")
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound but got %v", err)
+	}
+}
+
+func TestMove(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	c.Join(context.Background())
+
+	accepted, err := c.Move(context.Background(), testMatchId, 1)
+	if err != nil || !accepted {
+		t.Fatalf("expected move to be accepted but got %v, %v", accepted, err)
+	}
+
+	accepted, err = c.Move(context.Background(), testMatchId, 2)
+	if err != nil || accepted {
+		t.Fatalf("expected move to not be accepted but got %v, %v", accepted, err)
+	}
+
+	_, err = c.Move(context.Background(), testMatchId, 3)
+	if !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected ErrConflict but got %v", err)
+	}
+
+	_, err = c.Move(context.Background(), testMatchId, -1)
+	if !errors.Is(err, ErrInvalidMove) {
+		t.Fatalf("expected ErrInvalidMove but got %v", err)
+	}
+}
+
+func TestMoveErrorCode(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	c.Join(context.Background())
+
+	_, err := c.Move(context.Background(), testMatchId, 0)
+	if !errors.Is(err, ErrInvalidMove) {
+		t.Fatalf("expected ErrInvalidMove but got %v", err)
+	}
+
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.Code != "pit_empty" || apiErr.Message != "pit is empty" || apiErr.Details["pit"] != 0.0 {
+		t.Fatalf("expected the server's error but got %+v", apiErr)
+	}
+}
+
+func TestWaitTurn(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	c.Join(context.Background())
+
+	m, err := c.WaitTurn(context.Background(), testMatchId, time.Millisecond)
+	if err != nil {
+		t.Fatalf("failed to wait for turn: %v", err)
+	}
+
+	if !m.MyTurn {
+		t.Fatal("it should be my turn")
+	}
+}
+
+func TestWaitTurnCancelled(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	c.Join(context.Background())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := c.WaitTurn(ctx, testMatchId, time.Hour)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled but got %v", err)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+	c.Join(context.Background())
+
+	matches := []*Match{}
+	err := c.Watch(context.Background(), testMatchId, func(m *Match) error {
+		matches = append(matches, m)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(matches) != 2 || !matches[0].MyTurn || matches[1].LastMove == nil || !matches[1].LastMove.Mine {
+		t.Fatalf("expected both events of the stream but got %+v", matches)
+	}
+}
+
+func TestWatchStopsWithF(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+	c.Join(context.Background())
+
+	stop := errors.New("stop")
+	calls := 0
+	err := c.Watch(context.Background(), testMatchId, func(m *Match) error {
+		calls++
+		return stop
+	})
+	if err != stop || calls != 1 {
+		t.Fatalf("expected to stop after the first event, got %v after %v calls", err, calls)
+	}
+}
+
+func TestRematch(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+	c.Join(context.Background())
+
+	r, err := c.Rematch(context.Background(), testMatchId)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if r.Mine || r.NextMatch != "next-match" {
+		t.Fatalf("expected the accepted rematch but got %+v", r)
+	}
+}
+
+func TestWatchWithoutJoinIsUnauthorized(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	err := c.Watch(context.Background(), testMatchId, func(m *Match) error { return nil })
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("expected ErrUnauthorized but got %v", err)
+	}
+}
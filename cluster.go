@@ -0,0 +1,364 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+const (
+	clusterSlots int = 16384
+	// a command gives up after following this many MOVED or ASK replies
+	maxRedirects int = 5
+)
+
+var errUnboundTransaction = errors.New("cluster transactions must WATCH one of their keys first")
+
+// redisCluster routes every command to the node serving the slot of its
+// first key. Keys with the same hash tag, the part between { and }, are in
+// the same slot, which lets a transaction use more than one of them.
+type redisCluster struct {
+	config   RedisConfig
+	dial     func(string) (redis.Conn, error)
+	startup  []string
+	pools    map[string]*redis.Pool
+	poolsMut sync.Mutex
+
+	// node address serving each slot, empty until the first refresh
+	slots    []string
+	slotsMut sync.RWMutex
+}
+
+func newRedisCluster(c RedisConfig, dial func(string) (redis.Conn, error)) *redisCluster {
+	cl := &redisCluster{config: c, dial: dial, startup: c.Cluster, pools: map[string]*redis.Pool{}}
+	if err := cl.refresh(context.Background()); err != nil {
+		logger(context.Background()).Warn("redis cluster slots unknown", "error", err)
+	}
+	return cl
+}
+
+// GetContext returns a connection that is not tied to a node until it
+// starts a transaction.
+func (cl *redisCluster) GetContext(ctx context.Context) (redis.Conn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return &clusterConn{cluster: cl}, nil
+}
+
+func (cl *redisCluster) Close() error {
+	cl.poolsMut.Lock()
+	defer cl.poolsMut.Unlock()
+
+	var errs []error
+	for _, p := range cl.pools {
+		errs = append(errs, p.Close())
+	}
+	return errors.Join(errs...)
+}
+
+func (cl *redisCluster) pool(address string) *redis.Pool {
+	cl.poolsMut.Lock()
+	defer cl.poolsMut.Unlock()
+
+	p, ok := cl.pools[address]
+	if !ok {
+		p = newPool(cl.config, func() (redis.Conn, error) { return cl.dial(address) }, ping)
+		cl.pools[address] = p
+	}
+	return p
+}
+
+// refresh reads the slots of every node from the first node to answer.
+func (cl *redisCluster) refresh(ctx context.Context) error {
+	nodes := append([]string{}, cl.startup...)
+	cl.poolsMut.Lock()
+	for address := range cl.pools {
+		nodes = append(nodes, address)
+	}
+	cl.poolsMut.Unlock()
+
+	var errs []error
+	for _, address := range nodes {
+		slots, err := cl.readSlots(ctx, address)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%v: %w", address, err))
+			continue
+		}
+
+		cl.slotsMut.Lock()
+		cl.slots = slots
+		cl.slotsMut.Unlock()
+		return nil
+	}
+	return errors.Join(errs...)
+}
+
+func (cl *redisCluster) readSlots(ctx context.Context, address string) ([]string, error) {
+	conn, err := cl.pool(address).GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	ranges, err := redis.Values(redis.DoContext(conn, ctx, "CLUSTER", "SLOTS"))
+	if err != nil {
+		return nil, err
+	}
+
+	slots := make([]string, clusterSlots)
+	for _, r := range ranges {
+		// start, end, then the master and its replicas as host, port, id
+		fields, err := redis.Values(r, nil)
+		if err != nil || len(fields) < 3 {
+			return nil, fmt.Errorf("unexpected CLUSTER SLOTS reply %v", r)
+		}
+		start, _ := redis.Int(fields[0], nil)
+		end, _ := redis.Int(fields[1], nil)
+		master, _ := redis.Values(fields[2], nil)
+		if len(master) < 2 || start < 0 || end >= clusterSlots {
+			return nil, fmt.Errorf("unexpected CLUSTER SLOTS reply %v", r)
+		}
+
+		host, _ := redis.String(master[0], nil)
+		port, _ := redis.Int(master[1], nil)
+		if host == "" {
+			// the node we asked
+			host, _, _ = net.SplitHostPort(address)
+		}
+		for s := start; s <= end; s++ {
+			slots[s] = net.JoinHostPort(host, strconv.Itoa(port))
+		}
+	}
+	return slots, nil
+}
+
+// node returns the address serving key, or any node if it is not known.
+func (cl *redisCluster) node(key string) string {
+	cl.slotsMut.RLock()
+	defer cl.slotsMut.RUnlock()
+
+	if cl.slots != nil && key != "" {
+		if address := cl.slots[slot(key)]; address != "" {
+			return address
+		}
+	}
+	return cl.startup[rand.Intn(len(cl.startup))]
+}
+
+func (cl *redisCluster) moved(s int, address string) {
+	cl.slotsMut.Lock()
+	defer cl.slotsMut.Unlock()
+
+	if cl.slots == nil {
+		cl.slots = make([]string, clusterSlots)
+	}
+	cl.slots[s] = address
+}
+
+// do runs a command on the node serving key, following the cluster when it
+// redirects it. The connection used is returned open.
+func (cl *redisCluster) do(ctx context.Context, key string, commandName string, args ...interface{}) (redis.Conn, interface{}, error) {
+	address := cl.node(key)
+	asking := false
+	refreshed := false
+
+	for i := 0; i <= maxRedirects; i++ {
+		conn, reply, err := cl.try(ctx, address, asking, commandName, args...)
+
+		if redirect, ok := parseRedirect(err); ok {
+			conn.Close()
+			address, asking = redirect.address, redirect.ask
+			if !redirect.ask {
+				cl.moved(redirect.slot, redirect.address)
+			}
+			continue
+		}
+
+		// the node may be gone after a failover
+		if err != nil && (conn == nil || conn.Err() != nil) && ctx.Err() == nil && !refreshed {
+			if conn != nil {
+				conn.Close()
+			}
+			refreshed = true
+			if cl.refresh(ctx) == nil {
+				address, asking = cl.node(key), false
+				continue
+			}
+		}
+		return conn, reply, err
+	}
+
+	return nil, nil, fmt.Errorf("%v %v: too many cluster redirects", commandName, key)
+}
+
+func (cl *redisCluster) try(ctx context.Context, address string, asking bool, commandName string, args ...interface{}) (redis.Conn, interface{}, error) {
+	conn, err := cl.pool(address).GetContext(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if asking {
+		if _, err := redis.DoContext(conn, ctx, "ASKING"); err != nil {
+			return conn, nil, err
+		}
+	}
+	reply, err := redis.DoContext(conn, ctx, commandName, args...)
+	return conn, reply, err
+}
+
+type redirect struct {
+	ask     bool
+	slot    int
+	address string
+}
+
+// parseRedirect reads "MOVED <slot> <address>" and "ASK <slot> <address>"
+// errors.
+func parseRedirect(err error) (redirect, bool) {
+	var redisErr redis.Error
+	if !errors.As(err, &redisErr) {
+		return redirect{}, false
+	}
+
+	fields := strings.Fields(string(redisErr))
+	if len(fields) != 3 || (fields[0] != "MOVED" && fields[0] != "ASK") {
+		return redirect{}, false
+	}
+
+	s, err := strconv.Atoi(fields[1])
+	if err != nil || s < 0 || s >= clusterSlots {
+		return redirect{}, false
+	}
+	return redirect{ask: fields[0] == "ASK", slot: s, address: fields[2]}, true
+}
+
+// slot returns the cluster slot of key, hashing only its hash tag if it has
+// one.
+func slot(key string) int {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	return int(crc16(key)) % clusterSlots
+}
+
+// crc16 is the CRC-16/XMODEM checksum Redis Cluster hashes keys with.
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for b := 0; b < 8; b++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// clusterConn sends every command to the node of its key until WATCH binds
+// it to one node, so the transaction that follows runs there.
+type clusterConn struct {
+	cluster *redisCluster
+	bound   redis.Conn
+}
+
+func (c *clusterConn) Close() error {
+	if c.bound == nil {
+		return nil
+	}
+	return c.bound.Close()
+}
+
+func (c *clusterConn) Err() error {
+	if c.bound == nil {
+		return nil
+	}
+	return c.bound.Err()
+}
+
+func (c *clusterConn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	return c.DoContext(context.Background(), commandName, args...)
+}
+
+func (c *clusterConn) DoContext(ctx context.Context, commandName string, args ...interface{}) (interface{}, error) {
+	if c.bound != nil {
+		return redis.DoContext(c.bound, ctx, commandName, args...)
+	}
+
+	switch strings.ToUpper(commandName) {
+	case "MULTI":
+		return nil, errUnboundTransaction
+	case "WATCH":
+		conn, reply, err := c.cluster.do(ctx, commandKey(commandName, args), commandName, args...)
+		c.bound = conn
+		return reply, err
+	}
+
+	conn, reply, err := c.cluster.do(ctx, commandKey(commandName, args), commandName, args...)
+	if conn != nil {
+		conn.Close()
+	}
+	return reply, err
+}
+
+func (c *clusterConn) Send(commandName string, args ...interface{}) error {
+	if c.bound == nil {
+		return errUnboundTransaction
+	}
+	return c.bound.Send(commandName, args...)
+}
+
+func (c *clusterConn) Flush() error {
+	if c.bound == nil {
+		return nil
+	}
+	return c.bound.Flush()
+}
+
+func (c *clusterConn) Receive() (interface{}, error) {
+	return c.ReceiveContext(context.Background())
+}
+
+func (c *clusterConn) ReceiveContext(ctx context.Context) (interface{}, error) {
+	if c.bound == nil {
+		return nil, errUnboundTransaction
+	}
+	return redis.ReceiveContext(c.bound, ctx)
+}
+
+// commandKey returns the first key of a command, the first argument but for
+// scripts.
+func commandKey(commandName string, args []interface{}) string {
+	switch strings.ToUpper(commandName) {
+	case "EVAL", "EVALSHA":
+		// script, number of keys, keys
+		if len(args) < 3 {
+			return ""
+		}
+		args = args[2:]
+	}
+
+	if len(args) == 0 {
+		return ""
+	}
+	switch k := args[0].(type) {
+	case string:
+		return k
+	case []byte:
+		return string(k)
+	default:
+		return fmt.Sprint(k)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/google/uuid"
+	"github.com/rafaeljusto/redigomock"
+)
+
+func TestSlot(t *testing.T) {
+	if crc16("123456789") != 0x31c3 {
+		t.Fatalf("unexpected checksum %x", crc16("123456789"))
+	}
+
+	for _, key := range []string{"foo", "{foo}bar", "bar{foo}"} {
+		if slot(key) != 12182 {
+			t.Fatalf("expected %v in slot 12182 but got %v", key, slot(key))
+		}
+	}
+	if slot("foo{}{bar}") == slot("bar") {
+		t.Fatal("an empty hash tag should hash the whole key")
+	}
+	if slot("foo{{bar}}") != slot("{bar") {
+		t.Fatal("the hash tag should end at the first }")
+	}
+
+	id := uuid.NewString()
+	if slot(matchKey(id)) != slot(lockKey(id)) {
+		t.Fatal("a match and its lock should be in the same slot")
+	}
+}
+
+// testCluster has node a serving slots 0-8191 and node b the rest. "bar"
+// hashes to a and "foo" to b.
+func testCluster() (*redisCluster, *redigomock.Conn, *redigomock.Conn) {
+	a := redigomock.NewConn()
+	b := redigomock.NewConn()
+	for _, node := range []*redigomock.Conn{a, b} {
+		node.Command("PING").Expect("PONG")
+		node.Command("CLUSTER", "SLOTS").Expect([]interface{}{
+			[]interface{}{int64(0), int64(8191), []interface{}{[]byte("a"), int64(7000), []byte("ida")}},
+			[]interface{}{int64(8192), int64(16383), []interface{}{[]byte("b"), int64(7001), []byte("idb")}},
+		})
+	}
+
+	c := testConfig.Redis
+	c.Cluster = []string{"a:7000"}
+	cl := newRedisCluster(c, func(address string) (redis.Conn, error) {
+		switch address {
+		case "a:7000":
+			return contextMock{a}, nil
+		case "b:7001":
+			return contextMock{b}, nil
+		}
+		return nil, fmt.Errorf("unknown node %v", address)
+	})
+
+	return cl, a, b
+}
+
+func TestClusterRoutesByKey(t *testing.T) {
+	cl, a, b := testCluster()
+	repo := newMatchRepo(cl, testConfig.Redis)
+
+	foo := b.Command("GET", "match:{foo}").Expect("{}")
+	bar := a.Command("GET", "match:{bar}").Expect("{}")
+
+	repo.Get(context.Background(), "foo")
+	repo.Get(context.Background(), "bar")
+
+	if b.Stats(foo) != 1 || a.Stats(bar) != 1 {
+		t.Fatal("commands should be sent to the node of their key")
+	}
+}
+
+func TestClusterFollowsMoved(t *testing.T) {
+	cl, a, b := testCluster()
+	repo := newMatchRepo(cl, testConfig.Redis)
+
+	a.Command("GET", "match:{bar}").ExpectError(redis.Error(fmt.Sprintf("MOVED %v b:7001", slot("bar"))))
+	moved := b.Command("GET", "match:{bar}").Expect("{}")
+
+	for i := 0; i < 2; i++ {
+		if _, err := repo.Get(context.Background(), "bar"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if b.Stats(moved) != 2 {
+		t.Fatal("the slot should be served by its new node")
+	}
+}
+
+func TestClusterFollowsAsk(t *testing.T) {
+	cl, a, b := testCluster()
+	repo := newMatchRepo(cl, testConfig.Redis)
+
+	a.Command("GET", "match:{bar}").ExpectError(redis.Error(fmt.Sprintf("ASK %v b:7001", slot("bar"))))
+	asking := b.Command("ASKING").Expect("OK")
+	b.Command("GET", "match:{bar}").Expect("{}")
+
+	if _, err := repo.Get(context.Background(), "bar"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if b.Stats(asking) != 1 {
+		t.Fatal("ASKING should be sent before the redirected command")
+	}
+}
+
+func TestClusterTransactionStaysOnItsNode(t *testing.T) {
+	cl, a, b := testCluster()
+	repo := newTournamentRepo(cl, testConfig.Redis)
+
+	tr := Tournament{Id: "foo", Format: SwissFormat}
+	tournamentValue, _ := json.Marshal(tr)
+
+	b.Command("WATCH", "tournament:{foo}").Expect("OK")
+	b.Command("GET", "tournament:{foo}").Expect(tournamentValue)
+	b.Command("MULTI").Expect("OK")
+	b.GenericCommand("SET").Expect("QUEUED")
+	exec := b.Command("EXEC").Expect([]interface{}{"OK"})
+	index := a.Command("SET", "tournament_match:{bar}", "foo").Expect("OK")
+
+	_, err := repo.UpdateTournament(context.Background(), "foo", func(t *Tournament) error {
+		t.Games = append(t.Games, TournamentGame{MatchId: "bar"})
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if b.Stats(exec) != 1 || a.Stats(index) != 1 {
+		t.Fatal("the transaction should run on the tournament's node and the index on its own")
+	}
+}
+
+func TestClusterTransactionNeedsWatch(t *testing.T) {
+	cl, _, _ := testCluster()
+	conn, _ := cl.GetContext(context.Background())
+	defer conn.Close()
+
+	if err := conn.Send("MULTI"); err != errUnboundTransaction {
+		t.Fatalf("expected errUnboundTransaction but got %v", err)
+	}
+}
+
+func TestClusterCanceledContextFailsCommands(t *testing.T) {
+	cl, _, _ := testCluster()
+	repo := newMatchRepo(cl, testConfig.Redis)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := repo.Get(ctx, "foo"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled but got %v", err)
+	}
+}
@@ -0,0 +1,91 @@
+// Command arena runs a tournament between mancala agents in-process.
+//
+//	go run ./cmd/arena -agents greedy,random,first -format swiss -rounds 5 -games 100
+//
+// External bots speaking the protocol of package bot join with -bot:
+//
+//	go run ./cmd/arena -agents greedy -bot "mine=python3 mybot.py"
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dacruz/mancala/arena"
+	"github.com/dacruz/mancala/bot"
+)
+
+type botFlags []string
+
+func (f *botFlags) String() string {
+	return strings.Join(*f, ", ")
+}
+
+func (f *botFlags) Set(v string) error {
+	*f = append(*f, v)
+	return nil
+}
+
+func main() {
+	log.SetFlags(log.LstdFlags | log.Lshortfile)
+
+	agents := flag.String("agents", strings.Join(arena.BuiltinNames(), ","),
+		fmt.Sprintf("comma separated agents, available: %v", strings.Join(arena.BuiltinNames(), ", ")))
+	format := flag.String("format", string(arena.RoundRobin), "tournament format: roundrobin or swiss")
+	rounds := flag.Int("rounds", 3, "number of rounds of a swiss tournament")
+	games := flag.Int("games", 10, "games per pairing and side")
+	seed := flag.Int64("seed", time.Now().UnixNano(), "seed used to make the tournament reproducible")
+	workers := flag.Int("workers", 0, "games played in parallel, defaults to the number of CPUs")
+	moveTime := flag.Duration("movetime", 100*time.Millisecond, "time external bots have to choose a move")
+	bots := botFlags{}
+	flag.Var(&bots, "bot", "external bot as name=command, can be repeated")
+	flag.Parse()
+
+	t := arena.Tournament{
+		Format:  arena.Format(*format),
+		Rounds:  *rounds,
+		Games:   *games,
+		Seed:    *seed,
+		Workers: *workers,
+	}
+
+	if t.Format != arena.RoundRobin && t.Format != arena.Swiss {
+		log.Fatalf("unknown format %q", *format)
+	}
+
+	for _, name := range strings.Split(*agents, ",") {
+		if strings.TrimSpace(name) == "" {
+			continue
+		}
+		p, err := arena.Builtin(strings.TrimSpace(name))
+		if err != nil {
+			log.Fatal(err)
+		}
+		t.Players = append(t.Players, p)
+	}
+
+	for _, b := range bots {
+		name, command := splitBotFlag(b)
+		if len(command) == 0 {
+			log.Fatalf("invalid bot %q, expected name=command", b)
+		}
+		t.Players = append(t.Players, bot.Player(name, command, *moveTime))
+	}
+
+	fmt.Printf("%v tournament, seed %v\n\n", t.Format, t.Seed)
+	if err := arena.WriteTable(os.Stdout, t.Run()); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func splitBotFlag(v string) (string, []string) {
+	parts := strings.SplitN(v, "=", 2)
+	if len(parts) != 2 {
+		return "", nil
+	}
+	return parts[0], strings.Fields(parts[1])
+}
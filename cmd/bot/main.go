@@ -0,0 +1,38 @@
+// Command bot runs one of the arena's built-in agents as an external bot,
+// speaking the protocol described in package bot on stdin and stdout. It
+// is the reference for bots written in other languages.
+//
+//	go run ./cmd/bot -agent greedy
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	"github.com/dacruz/mancala/arena"
+	"github.com/dacruz/mancala/bot"
+)
+
+func main() {
+	log.SetFlags(log.LstdFlags | log.Lshortfile)
+
+	name := flag.String("agent", "greedy", "built-in agent to play with")
+	seed := flag.Int64("seed", time.Now().UnixNano(), "seed for agents that play at random")
+	flag.Parse()
+
+	p, err := arena.Builtin(*name)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	agent, err := p.New(*seed)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := bot.Serve(p.Name, agent, os.Stdin, os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,99 @@
+// Command loadtest plays concurrent games against a running mancala server
+// and reports latency percentiles, errors, stuck matches and throughput.
+//
+//	go run ./cmd/loadtest -url http://localhost:8080 -players 200 -games 5
+//
+// Soak tests play for a while instead:
+//
+//	go run ./cmd/loadtest -url http://localhost:8080 -players 50 -duration 1h
+//
+// It exits with 1 when a match got stuck or too many requests failed.
+//
+// CI needs no running server, it plays against one started in-process with
+// an in-memory repository:
+//
+//	go run ./cmd/loadtest -in-process -players 200 -games 5
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"time"
+
+	"github.com/dacruz/mancala/loadtest"
+)
+
+func main() {
+	log.SetFlags(log.LstdFlags | log.Lshortfile)
+
+	url := flag.String("url", "http://localhost:8080", "server to test")
+	players := flag.Int("players", 100, "players playing at the same time")
+	games := flag.Int("games", 5, "games each player plays, 0 to play for -duration")
+	duration := flag.Duration("duration", 0, "how long to play, no limit if 0")
+	poll := flag.Duration("poll", 100*time.Millisecond, "how often players look at their match")
+	stuckAfter := flag.Duration("stuck-after", 30*time.Second, "time without a move after which a match is stuck")
+	maxErrorRate := flag.Float64("max-error-rate", 0.01, "failed requests tolerated, as a fraction of all requests")
+	seed := flag.Int64("seed", time.Now().UnixNano(), "seed of the players' moves")
+	inProcess := flag.Bool("in-process", false, "play against a server started in-process with an in-memory repository instead of -url, failing on any failed request; needs -games and the go tool")
+	flag.Parse()
+
+	// interrupting stops the players and still reports
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if *inProcess {
+		if *games == 0 {
+			log.Fatal("-in-process needs -games")
+		}
+		os.Exit(runInProcess(ctx, *players, *games, *seed))
+	}
+
+	fmt.Printf("%v players against %v, seed %v\n\n", *players, *url, *seed)
+	report, err := loadtest.Run(ctx, loadtest.Config{
+		URL:          *url,
+		Players:      *players,
+		Games:        *games,
+		Duration:     *duration,
+		PollInterval: *poll,
+		StuckAfter:   *stuckAfter,
+		Seed:         *seed,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := report.Write(os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+
+	if len(report.Stuck) > 0 || report.ErrorRate() > *maxErrorRate {
+		os.Exit(1)
+	}
+}
+
+// runInProcess runs TestLoadInProcess of the server package, which starts
+// the server in the process of the players, and returns its exit code. The
+// server is a main package that cannot be imported, so the go tool builds
+// the test with it.
+func runInProcess(ctx context.Context, players int, games int, seed int64) int {
+	fmt.Printf("%v players against an in-process server, seed %v\n\n", players, seed)
+	cmd := exec.CommandContext(ctx, "go", "test", "-count=1", "-v", "-run", "^TestLoadInProcess$", "github.com/dacruz/mancala",
+		"-args", "-loadtest.players", strconv.Itoa(players), "-loadtest.games", strconv.Itoa(games), "-loadtest.seed", strconv.FormatInt(seed, 10))
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	exitErr := &exec.ExitError{}
+	if err := cmd.Run(); errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	} else if err != nil {
+		log.Fatal(err)
+	}
+	return 0
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dacruz/mancala/game"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	ENV_CONFIG_FILE = "CONFIG_FILE"
+
+	// Besides the submit timeout, the lock of a move has to outlast the
+	// slowest commands run while it is held: reading the match, extending
+	// the lock and saving the move. The time the move is queued behind
+	// others in its lane is not bounded, a move whose lock expires there is
+	// dropped.
+	lockTTLCommandTimeouts = 3
+)
+
+// Config holds every setting of the server. Settings are read, each one
+// overriding the previous, from the defaults, the configuration file, the
+// environment and the command line.
+type Config struct {
+	Server ServerConfig `yaml:"server"`
+	Dealer DealerConfig `yaml:"dealer"`
+	Redis  RedisConfig  `yaml:"redis"`
+	Board  BoardConfig  `yaml:"board"`
+
+	LogLevel       string `yaml:"log_level"`
+	TracesExporter string `yaml:"traces_exporter"`
+	// command of an external bot playing GET /?opponent=bot matches
+	BotCommand string `yaml:"bot_command"`
+}
+
+type ServerConfig struct {
+	Address         string        `yaml:"address"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	// sent in Retry-After when moves are rejected, in whole seconds
+	RetryAfter time.Duration `yaml:"retry_after"`
+	// how often match event streams look for changes
+	StreamInterval time.Duration `yaml:"stream_interval"`
+}
+
+type DealerConfig struct {
+	// move lanes, each with a worker sowing and a worker saving the moves
+	// of its matches in order
+	Workers int `yaml:"workers"`
+	// per lane. With 0, a move waits for the worker of its lane to take it,
+	// and the lane is never reported full.
+	MoveBuffer      int `yaml:"move_buffer"`
+	CompletedBuffer int `yaml:"completed_buffer"`
+	// a move is rejected if its lane stays full this long
+	SubmitTimeout time.Duration `yaml:"submit_timeout"`
+}
+
+type RedisConfig struct {
+	// a single server, unless Sentinel or Cluster are set
+	Address     string        `yaml:"address"`
+	Username    string        `yaml:"username"`
+	Password    string        `yaml:"password"`
+	MaxIdle     int           `yaml:"max_idle"`
+	MaxActive   int           `yaml:"max_active"`
+	IdleTimeout time.Duration `yaml:"idle_timeout"`
+	// a command gives up after this long
+	CommandTimeout time.Duration `yaml:"command_timeout"`
+	// how long a move keeps its match locked, in whole seconds and at least
+	// the submit timeout plus lockTTLCommandTimeouts times CommandTimeout
+	LockTTL time.Duration `yaml:"lock_ttl"`
+
+	TLS TLSConfig `yaml:"tls"`
+	// sentinels to ask for the address of the master
+	Sentinel SentinelConfig `yaml:"sentinel"`
+	// nodes to discover the cluster from
+	Cluster []string `yaml:"cluster"`
+}
+
+type TLSConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// PEM certificates trusted on top of the system ones
+	CAFile     string `yaml:"ca_file"`
+	ServerName string `yaml:"server_name"`
+}
+
+type SentinelConfig struct {
+	Addresses  []string `yaml:"addresses"`
+	MasterName string   `yaml:"master_name"`
+	Password   string   `yaml:"password"`
+}
+
+// BoardConfig sets up new boards. The number of pits is part of the rules
+// and cannot be changed.
+type BoardConfig struct {
+	Stones int `yaml:"stones"`
+}
+
+func defaultConfig() Config {
+	return Config{
+		Server: ServerConfig{
+			Address: ":8080",
+			// a bit less than the 30s Kubernetes waits before killing the pod
+			ShutdownTimeout: 25 * time.Second,
+			RetryAfter:      time.Second,
+			StreamInterval:  250 * time.Millisecond,
+		},
+		Dealer: DealerConfig{
+			Workers:         100,
+			MoveBuffer:      boardSize,
+			CompletedBuffer: boardSize,
+			SubmitTimeout:   500 * time.Millisecond,
+		},
+		Redis: RedisConfig{
+			Address:        "localhost:6379",
+			MaxIdle:        10,
+			IdleTimeout:    240 * time.Second,
+			CommandTimeout: 2 * time.Second,
+			LockTTL:        10 * time.Second,
+		},
+		Board: BoardConfig{
+			Stones: game.Stones,
+		},
+		LogLevel: "info",
+	}
+}
+
+// bindFlags adds a flag for every setting, mapping flag names to the
+// environment variables that set them too.
+func (c *Config) bindFlags(fs *flag.FlagSet) map[string]string {
+	fs.StringVar(&c.Server.Address, "address", c.Server.Address, "address the HTTP server listens on")
+	fs.DurationVar(&c.Server.ShutdownTimeout, "shutdown-timeout", c.Server.ShutdownTimeout, "time given to requests and queued moves to finish on shutdown")
+	fs.DurationVar(&c.Server.RetryAfter, "retry-after", c.Server.RetryAfter, "how long clients of rejected moves are told to wait")
+	fs.DurationVar(&c.Server.StreamInterval, "stream-interval", c.Server.StreamInterval, "how often match event streams look for changes")
+	fs.IntVar(&c.Dealer.Workers, "workers", c.Dealer.Workers, "move lanes, each playing the moves of its matches in order")
+	fs.IntVar(&c.Dealer.MoveBuffer, "move-buffer", c.Dealer.MoveBuffer, "moves waiting to be sown, 0 to hand them straight to the lane worker")
+	fs.IntVar(&c.Dealer.CompletedBuffer, "completed-buffer", c.Dealer.CompletedBuffer, "moves waiting to be saved")
+	fs.DurationVar(&c.Dealer.SubmitTimeout, "move-submit-timeout", c.Dealer.SubmitTimeout, "how long a move waits for room in a full lane before it is rejected")
+	fs.StringVar(&c.Redis.Address, "redis-address", c.Redis.Address, "Redis host:port")
+	fs.StringVar(&c.Redis.Username, "redis-username", c.Redis.Username, "Redis ACL user, empty for the default user")
+	fs.StringVar(&c.Redis.Password, "redis-password", c.Redis.Password, "Redis password, empty for no AUTH")
+	fs.IntVar(&c.Redis.MaxIdle, "redis-max-idle", c.Redis.MaxIdle, "idle connections kept in the Redis pool")
+	fs.IntVar(&c.Redis.MaxActive, "redis-max-active", c.Redis.MaxActive, "connections open at once in the Redis pool, 0 for no limit")
+	fs.DurationVar(&c.Redis.IdleTimeout, "redis-idle-timeout", c.Redis.IdleTimeout, "idle Redis connections are closed after this long")
+	fs.DurationVar(&c.Redis.CommandTimeout, "redis-command-timeout", c.Redis.CommandTimeout, "Redis commands give up after this long")
+	fs.DurationVar(&c.Redis.LockTTL, "lock-ttl", c.Redis.LockTTL, "how long a move keeps its match locked, in whole seconds")
+	fs.BoolVar(&c.Redis.TLS.Enabled, "redis-tls", c.Redis.TLS.Enabled, "connect to Redis over TLS")
+	fs.StringVar(&c.Redis.TLS.CAFile, "redis-ca-file", c.Redis.TLS.CAFile, "PEM file of the CA certificates Redis is trusted with")
+	fs.StringVar(&c.Redis.TLS.ServerName, "redis-tls-server-name", c.Redis.TLS.ServerName, "name Redis certificates are checked against, the host by default")
+	fs.Var((*listFlag)(&c.Redis.Sentinel.Addresses), "redis-sentinels", "comma separated host:port of the Redis sentinels")
+	fs.StringVar(&c.Redis.Sentinel.MasterName, "redis-sentinel-master", c.Redis.Sentinel.MasterName, "name of the master the sentinels monitor")
+	fs.StringVar(&c.Redis.Sentinel.Password, "redis-sentinel-password", c.Redis.Sentinel.Password, "password of the Redis sentinels")
+	fs.Var((*listFlag)(&c.Redis.Cluster), "redis-cluster", "comma separated host:port of Redis cluster nodes")
+	fs.IntVar(&c.Board.Stones, "stones", c.Board.Stones, "stones in every pit of a new board")
+	fs.StringVar(&c.LogLevel, "log-level", c.LogLevel, "debug, info, warn or error")
+	fs.StringVar(&c.TracesExporter, "traces-exporter", c.TracesExporter, "otlp, stdout or empty to disable tracing")
+	fs.StringVar(&c.BotCommand, "bot-command", c.BotCommand, "command of the bot playing GET /?opponent=bot matches")
+
+	return map[string]string{
+		"address":                 "LISTEN_ADDRESS",
+		"shutdown-timeout":        "SHUTDOWN_TIMEOUT",
+		"workers":                 "DEALER_WORKERS",
+		"move-buffer":             "MOVE_BUFFER",
+		"completed-buffer":        "COMPLETED_BUFFER",
+		"move-submit-timeout":     "MOVE_SUBMIT_TIMEOUT",
+		"retry-after":             "RETRY_AFTER",
+		"stream-interval":         "STREAM_INTERVAL",
+		"redis-address":           ENV_REDIS_ADDRESS,
+		"redis-username":          "REDIS_USERNAME",
+		"redis-password":          "REDIS_PASSWORD",
+		"redis-max-idle":          "REDIS_MAX_IDLE",
+		"redis-max-active":        "REDIS_MAX_ACTIVE",
+		"redis-idle-timeout":      "REDIS_IDLE_TIMEOUT",
+		"redis-command-timeout":   "REDIS_COMMAND_TIMEOUT",
+		"lock-ttl":                "LOCK_TTL",
+		"redis-tls":               "REDIS_TLS",
+		"redis-ca-file":           "REDIS_CA_FILE",
+		"redis-tls-server-name":   "REDIS_TLS_SERVER_NAME",
+		"redis-sentinels":         "REDIS_SENTINELS",
+		"redis-sentinel-master":   "REDIS_SENTINEL_MASTER",
+		"redis-sentinel-password": "REDIS_SENTINEL_PASSWORD",
+		"redis-cluster":           "REDIS_CLUSTER",
+		"stones":                  "BOARD_STONES",
+		"log-level":               ENV_LOG_LEVEL,
+		"traces-exporter":         ENV_TRACES,
+		"bot-command":             ENV_BOT_COMMAND,
+	}
+}
+
+// loadConfig reads the configuration from the file given with -config or
+// CONFIG_FILE, the environment and args.
+func loadConfig(args []string, lookupEnv func(string) (string, bool)) (Config, error) {
+	c := defaultConfig()
+
+	fs := flag.NewFlagSet("mancala", flag.ContinueOnError)
+	file := fs.String("config", "", "YAML or JSON configuration file, also set with "+ENV_CONFIG_FILE)
+	envs := c.bindFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return c, err
+	}
+
+	// flags are applied again once the file and the environment are read
+	flags := map[string]string{}
+	fs.Visit(func(f *flag.Flag) {
+		flags[f.Name] = f.Value.String()
+	})
+
+	if *file == "" {
+		*file, _ = lookupEnv(ENV_CONFIG_FILE)
+	}
+	if *file != "" {
+		if err := c.readFile(*file); err != nil {
+			return c, err
+		}
+	}
+
+	for name, env := range envs {
+		if v, ok := lookupEnv(env); ok {
+			if err := fs.Set(name, v); err != nil {
+				return c, fmt.Errorf("%v: %w", env, err)
+			}
+		}
+	}
+
+	for name, v := range flags {
+		fs.Set(name, v)
+	}
+
+	return c, c.validate()
+}
+
+// listFlag is a comma separated flag of a list setting.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(v string) error {
+	*l = nil
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			*l = append(*l, s)
+		}
+	}
+	return nil
+}
+
+func (c *Config) readFile(path string) error {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	// JSON is valid YAML
+	d := yaml.NewDecoder(bytes.NewReader(bs))
+	d.KnownFields(true)
+	if err := d.Decode(c); err != nil {
+		return fmt.Errorf("%v: %w", path, err)
+	}
+	return nil
+}
+
+func (c Config) validate() error {
+	var errs []error
+	check := func(ok bool, msg string) {
+		if !ok {
+			errs = append(errs, errors.New(msg))
+		}
+	}
+
+	check(c.Server.Address != "", "server address is required")
+	check(c.Server.ShutdownTimeout > 0, "shutdown timeout must be positive")
+	check(c.Dealer.Workers > 0, "dealer needs at least 1 lane")
+	check(c.Dealer.MoveBuffer >= 0, "move buffer cannot be negative")
+	check(c.Dealer.CompletedBuffer >= 0, "completed buffer cannot be negative")
+	check(c.Dealer.SubmitTimeout >= 0, "move submit timeout cannot be negative")
+	check(c.Server.RetryAfter >= time.Second, "retry after must be at least 1s")
+	check(c.Server.StreamInterval > 0, "stream interval must be positive")
+	check(c.Redis.Address != "" || len(c.Redis.Sentinel.Addresses) > 0 || len(c.Redis.Cluster) > 0, "redis address is required")
+	check(len(c.Redis.Sentinel.Addresses) == 0 || len(c.Redis.Cluster) == 0, "redis sentinel and cluster cannot be used together")
+	check(len(c.Redis.Sentinel.Addresses) == 0 || c.Redis.Sentinel.MasterName != "", "redis sentinel needs a master name")
+	check(c.Redis.TLS.Enabled || c.Redis.TLS.CAFile == "", "redis ca file needs tls enabled")
+	check(c.Redis.MaxIdle >= 0, "redis max idle cannot be negative")
+	check(c.Redis.MaxActive >= 0, "redis max active cannot be negative")
+	check(c.Redis.MaxActive == 0 || c.Redis.MaxIdle <= c.Redis.MaxActive, "redis max idle cannot exceed max active")
+	check(c.Redis.IdleTimeout >= 0, "redis idle timeout cannot be negative")
+	check(c.Redis.CommandTimeout > 0, "redis command timeout must be positive")
+	check(c.Redis.LockTTL >= time.Second, "lock ttl must be at least 1s")
+	check(c.Redis.LockTTL%time.Second == 0, "lock ttl must be whole seconds")
+	check(c.Redis.LockTTL >= c.Dealer.SubmitTimeout+lockTTLCommandTimeouts*c.Redis.CommandTimeout,
+		fmt.Sprintf("lock ttl must be at least the move submit timeout plus %v times the redis command timeout", lockTTLCommandTimeouts))
+	check(c.Board.Stones > 0, "a board needs at least 1 stone per pit")
+
+	switch c.TracesExporter {
+	case "", otlpExporter, stdoutExporter:
+	default:
+		errs = append(errs, fmt.Errorf("unknown traces exporter %q", c.TracesExporter))
+	}
+
+	switch c.LogLevel {
+	case "debug", "info", "warn", "error":
+	default:
+		errs = append(errs, fmt.Errorf("unknown log level %q", c.LogLevel))
+	}
+
+	return errors.Join(errs...)
+}
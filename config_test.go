@@ -0,0 +1,141 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var testConfig = defaultConfig()
+
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		v, ok := vars[name]
+		return v, ok
+	}
+}
+
+func TestDefaultConfigIsValid(t *testing.T) {
+	c, err := loadConfig(nil, env(nil))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if c.Server.Address != ":8080" || c.Dealer.Workers != 100 || c.Redis.Address != "localhost:6379" {
+		t.Fatalf("unexpected defaults: %+v", c)
+	}
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	os.WriteFile(file, []byte("dealer:\n  workers: 10\n  move_buffer: 20\nredis:\n  address: file:6379\n  idle_timeout: 1m\n"), 0600)
+
+	c, err := loadConfig([]string{"-workers", "30"}, env(map[string]string{
+		ENV_CONFIG_FILE:   file,
+		ENV_REDIS_ADDRESS: "env:6379",
+		"DEALER_WORKERS":  "20",
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if c.Dealer.Workers != 30 {
+		t.Fatalf("flags should win but got %v workers", c.Dealer.Workers)
+	}
+	if c.Redis.Address != "env:6379" {
+		t.Fatalf("environment should win over the file but got %v", c.Redis.Address)
+	}
+	if c.Dealer.MoveBuffer != 20 || c.Redis.IdleTimeout != time.Minute {
+		t.Fatalf("file settings were not read: %+v", c)
+	}
+	if c.Dealer.CompletedBuffer != boardSize {
+		t.Fatalf("defaults should stay but got %v", c.Dealer.CompletedBuffer)
+	}
+}
+
+func TestConfigFromJSONFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(file, []byte(`{"board": {"stones": 4}, "server": {"address": ":9090"}}`), 0600)
+
+	c, err := loadConfig([]string{"-config", file}, env(nil))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if c.Board.Stones != 4 || c.Server.Address != ":9090" {
+		t.Fatalf("json file was not read: %+v", c)
+	}
+}
+
+func TestConfigRejectsUnknownFileSettings(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	os.WriteFile(file, []byte("dealer:\n  wrokers: 10\n"), 0600)
+
+	if _, err := loadConfig([]string{"-config", file}, env(nil)); err == nil {
+		t.Fatal("a misspelled setting should be rejected")
+	}
+}
+
+func TestConfigAcceptsUnbufferedLanes(t *testing.T) {
+	c, err := loadConfig([]string{"-move-buffer", "0"}, env(nil))
+	if err != nil || c.Dealer.MoveBuffer != 0 {
+		t.Fatalf("unbuffered lanes should be accepted but got %v, %v", c.Dealer.MoveBuffer, err)
+	}
+}
+
+func TestConfigValidation(t *testing.T) {
+	invalid := [][]string{
+		{"-workers", "0"},
+		{"-stones", "0"},
+		{"-lock-ttl", "100ms"},
+		{"-lock-ttl", "1500ms"},
+		{"-lock-ttl", "5s", "-redis-command-timeout", "2s"},
+		{"-lock-ttl", "7s", "-redis-command-timeout", "2s", "-move-submit-timeout", "2s"},
+		{"-retry-after", "100ms"},
+		{"-move-submit-timeout", "-1s"},
+		{"-redis-max-idle", "20", "-redis-max-active", "10"},
+		{"-traces-exporter", "jaeger"},
+		{"-log-level", "verbose"},
+	}
+
+	for _, args := range invalid {
+		if _, err := loadConfig(args, env(nil)); err == nil {
+			t.Fatalf("%v should be rejected", args)
+		}
+	}
+}
+
+func TestConfigRejectsInvalidEnvironment(t *testing.T) {
+	if _, err := loadConfig(nil, env(map[string]string{"DEALER_WORKERS": "many"})); err == nil {
+		t.Fatal("a non numeric DEALER_WORKERS should be rejected")
+	}
+}
+
+func TestRedisDeploymentSettings(t *testing.T) {
+	c, err := loadConfig([]string{"-redis-tls"}, env(map[string]string{
+		"REDIS_CLUSTER":  "node1:6379, node2:6379",
+		"REDIS_USERNAME": "mancala",
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(c.Redis.Cluster) != 2 || c.Redis.Cluster[1] != "node2:6379" {
+		t.Fatalf("cluster nodes were not read: %v", c.Redis.Cluster)
+	}
+	if !c.Redis.TLS.Enabled || c.Redis.Username != "mancala" {
+		t.Fatalf("redis settings were not read: %+v", c.Redis)
+	}
+
+	invalid := [][]string{
+		{"-redis-sentinels", "s1:26379"},
+		{"-redis-sentinels", "s1:26379", "-redis-sentinel-master", "m", "-redis-cluster", "node1:6379"},
+		{"-redis-ca-file", "ca.pem"},
+	}
+	for _, args := range invalid {
+		if _, err := loadConfig(args, env(nil)); err == nil {
+			t.Fatalf("%v should be rejected", args)
+		}
+	}
+}
@@ -1,78 +1,312 @@
 package main
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/dacruz/mancala/game"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
-	numStones  int = 6
-	boardSize  int = 6
-	numWorkers int = 100
-	bufferSize int = 3
+	boardSize int = game.Pits
+
+	drainPollInterval time.Duration = 10 * time.Millisecond
+)
+
+var (
+	ErrDealerClosed = errors.New("dealer is closed")
+	// the lane of the match stayed full for the whole submit timeout
+	ErrQueueFull = errors.New("move queue is full")
+
+	ErrMatchNotFound  = errors.New("match not found")
+	ErrNotParticipant = errors.New("not a player of this match")
+	ErrInvalidPit     = errors.New("invalid pit number")
+	ErrPitEmpty       = errors.New("pit is empty")
+	ErrNotYourTurn    = errors.New("not your turn")
+	ErrMatchFinished  = errors.New("match is finished")
+	// the match is waiting for an opponent
+	ErrMatchNotStarted = errors.New("match has not started")
+	// another move of the match is being made
+	ErrMoveConflict = errors.New("another move is being made")
+	ErrMatchNotOver = errors.New("match is not over")
+	// the other player is offering or accepting a rematch of the match too
+	ErrRematchConflict = errors.New("rematch is being offered")
 )
 
+// Move carries the context of the request that made it, so workers log
+// with the same fields and their spans join the request's trace. The match
+// stays locked with lock until the move is saved.
 type Move struct {
+	ctx   context.Context
 	pit   int
 	match Match
+	lock  string
 }
 
 type MancalaBoard [][]int
 
 type Match struct {
-	Id   string
+	Id    string
 	Board MancalaBoard
-	P1   string
-	P2   string
-	Turn string
+	P1    string
+	P2    string
+	Turn  string
+	// nil until the first move is saved
+	LastMove *LastMove `json:",omitempty"`
+	// first pits sown, P1's then P2's as turns alternate
+	Openings   []int      `json:",omitempty"`
+	FinishedAt *time.Time `json:",omitempty"`
+	// of P1 and P2 once the match is over and rated
+	Ratings []int `json:",omitempty"`
+	// in every pit of the new board, the variant of the match
+	Stones int `json:",omitempty"`
+	// the match this one is a rematch of
+	Previous string `json:",omitempty"`
+	// the series the match is a game of
+	Series string `json:",omitempty"`
+}
+
+// Rematch is offered by a player of a finished match and accepted by the
+// other. It is kept apart from the match, which is saved again once rated.
+type Rematch struct {
+	MatchId   string
+	OfferedBy string
+	// the new match, once accepted
+	NextMatchId string `json:",omitempty"`
+}
+
+// LastMove lets players see, and replay, the move their opponent made.
+type LastMove struct {
+	Player string
+	Pit    int
+}
+
+func (m Match) HasPlayer(playerId string) bool {
+	return playerId != "" && (m.P1 == playerId || m.P2 == playerId)
+}
+
+// passTurn gives the turn to the other player. No move earns another turn,
+// not even one ending in the player's store.
+func (m *Match) passTurn() {
+	if m.Turn == m.P1 {
+		m.Turn = m.P2
+	} else {
+		m.Turn = m.P1
+	}
+}
+
+// side returns the row of the board of playerId.
+func (m Match) side(playerId string) int {
+	if playerId == m.P2 {
+		return 1
+	}
+	return 0
 }
 
 type Dealer interface {
-	JoinMatch() (*Match, string)
-	GetMatch(string, string) (*Match, error)
+	JoinMatch(context.Context) (*Match, string, error)
+	StartMatch(context.Context, string, string, string) (*Match, error)
+	// StartSeriesMatch starts a match of the series, like StartMatch.
+	StartSeriesMatch(ctx context.Context, seriesId string, matchId string, p1 string, p2 string) (*Match, error)
+	OnMatchFinished(func(context.Context, Match))
+	GetMatch(context.Context, string, string) (*Match, error)
 	PlayerTurn(Match, string) bool
-	MakeMove(int, Match, string) (bool, error)
+	// LegalMoves returns the pits the player can sow now, none when it is
+	// not their turn.
+	LegalMoves(Match, string) []int
+	// Rematch offers a rematch of the finished match, or accepts the one
+	// the opponent offered.
+	Rematch(ctx context.Context, matchId string, playerId string) (*Rematch, error)
+	// GetRematch returns the rematch of the match, nil if it is not over
+	// or none was offered.
+	GetRematch(context.Context, Match) (*Rematch, error)
+	// MakeMove queues a move, returning why it was not if it was not.
+	MakeMove(context.Context, int, Match, string) error
+	// Ready returns why the dealer cannot take moves, if it cannot.
+	Ready(context.Context) error
+	// Close stops taking moves and waits until the queued ones are saved,
+	// or ctx is done.
+	Close(context.Context) error
+}
+
+// lane sows and saves the moves of the matches hashed to it, one at a
+// time and in the order they were queued. Each lane has a worker of each
+// kind, so matches of different lanes are played in parallel.
+type lane struct {
+	moves     chan Move
+	completed chan Move
 }
 
 type MancalaDealer struct {
-	repo     MatchRepo
-	moveInCh chan Move
+	repo       MatchRepo
+	lanes      []lane
+	onFinished []func(context.Context, Match)
+	stones     int
+	// how long MakeMove waits for room in a full lane
+	submitTimeout time.Duration
+
+	// running workers of each kind
+	moveWorkers      atomic.Int32
+	completedWorkers atomic.Int32
+	// moves accepted and not saved yet
+	pending atomic.Int64
+
+	// held for writing to close, and for reading to queue a move
+	closing sync.RWMutex
+	closed  bool
 }
 
-func newDealer(r MatchRepo) Dealer {
-	moveInCh := make(chan Move, boardSize)
-	moveOutCh := make(chan Move, boardSize)
-	d := MancalaDealer{repo: r, moveInCh: moveInCh}
+func newDealer(r MatchRepo, c DealerConfig, b BoardConfig) Dealer {
+	d := MancalaDealer{repo: r, lanes: make([]lane, c.Workers), stones: b.Stones, submitTimeout: c.SubmitTimeout}
 
-	for i := 0; i < numWorkers; i++ {
-		go handleMove(&d, moveOutCh)
-		go handleMoveCompleted(&d, moveOutCh)
+	for i := range d.lanes {
+		d.lanes[i] = lane{moves: make(chan Move, c.MoveBuffer), completed: make(chan Move, c.CompletedBuffer)}
+		go handleMove(&d, d.lanes[i])
+		go handleMoveCompleted(&d, d.lanes[i].completed)
 	}
 
 	return &d
 }
 
-func (d *MancalaDealer) JoinMatch() (*Match, string) {
+// lane returns the lane of every move of a match.
+func (d *MancalaDealer) lane(matchId string) lane {
+	h := fnv.New32a()
+	h.Write([]byte(matchId))
+	return d.lanes[h.Sum32()%uint32(len(d.lanes))]
+}
+
+func (d *MancalaDealer) JoinMatch(ctx context.Context) (*Match, string, error) {
 
-	m, err := d.repo.GetWaitingMatch()
+	m, err := d.repo.GetWaitingMatch(ctx)
 	if err == nil {
 		m.P2 = uuid.NewString()
 		m.Turn = m.P1
-		d.repo.Save(m)
-		return m, m.P2
+		if err := d.repo.Save(ctx, m); err != nil {
+			return nil, "", fmt.Errorf("unable to join match: %w", err)
+		}
+		matchesJoined.Inc()
+		logger(ctx).Info("match joined", "match_id", m.Id, "player_id", m.P2)
+		return m, m.P2, nil
+	}
+
+	newMatch := Match{Id: uuid.NewString(), P1: uuid.NewString(), Board: d.newBoard(), Stones: d.stones}
+	if err := d.repo.AddWaitingMatch(ctx, &newMatch); err != nil {
+		return nil, "", fmt.Errorf("unable to create match: %w", err)
 	}
+	matchesCreated.Inc()
+	logger(ctx).Info("match created", "match_id", newMatch.Id, "player_id", newMatch.P1)
 
-	newMatch := Match{Id: uuid.NewString(), P1: uuid.NewString(), Board: newBoard()}
-	d.repo.AddWaitingMatch(&newMatch)
+	return &newMatch, newMatch.P1, nil
+}
+
+// StartMatch creates a match between two players, skipping the waiting
+// list. It is p1's turn.
+func (d *MancalaDealer) StartMatch(ctx context.Context, matchId string, p1 string, p2 string) (*Match, error) {
+	return d.StartSeriesMatch(ctx, "", matchId, p1, p2)
+}
+
+func (d *MancalaDealer) StartSeriesMatch(ctx context.Context, seriesId string, matchId string, p1 string, p2 string) (*Match, error) {
+	m := Match{Id: matchId, P1: p1, P2: p2, Turn: p1, Board: d.newBoard(), Stones: d.stones, Series: seriesId}
+	if err := d.repo.Save(ctx, &m); err != nil {
+		return nil, fmt.Errorf("unable to start match: %w", err)
+	}
+	matchesCreated.Inc()
+	logger(ctx).Info("match started", "match_id", m.Id, "p1", m.P1, "p2", m.P2)
 
-	return &newMatch, newMatch.P1
+	return &m, nil
 }
 
-func (d *MancalaDealer) GetMatch(matchId string, playerId string) (*Match, error) {
-	match, err := d.repo.Get(matchId)
+// Rematch starts the new match when the opponent offered it already, with
+// the players on each other's side, so the one who moved second starts.
+// The match is locked meanwhile, as no move can be made on it anymore.
+func (d *MancalaDealer) Rematch(ctx context.Context, matchId string, playerId string) (*Rematch, error) {
+	lock, err := d.repo.Lock(ctx, matchId)
+	if err == ErrMatchLocked {
+		return nil, ErrRematchConflict
+	}
 	if err != nil {
-		return nil, errors.New("unnable to get match")
+		return nil, fmt.Errorf("unable to lock match: %w", err)
+	}
+	defer d.unlock(ctx, matchId, lock)
+
+	m, err := d.GetMatch(ctx, matchId, playerId)
+	if err != nil {
+		return nil, err
+	}
+	if m.P2 == "" {
+		return nil, ErrMatchNotStarted
+	}
+	if !game.Over(game.Board(m.Board)) {
+		return nil, ErrMatchNotOver
+	}
+
+	r, err := d.GetRematch(ctx, *m)
+	if err != nil {
+		return nil, err
+	}
+	if r == nil {
+		r = &Rematch{MatchId: matchId}
+	}
+	if r.NextMatchId != "" || r.OfferedBy == playerId {
+		return r, nil
+	}
+	if r.OfferedBy == "" {
+		r.OfferedBy = playerId
+		if err := d.repo.SaveRematch(ctx, r); err != nil {
+			return nil, fmt.Errorf("unable to offer rematch: %w", err)
+		}
+		logger(ctx).Info("rematch offered")
+		return r, nil
+	}
+
+	next := Match{Id: uuid.NewString(), P1: m.P2, P2: m.P1, Turn: m.P2, Board: d.newBoard(), Stones: d.stones, Previous: m.Id}
+	// the rematch only points to a match that was saved
+	if err := d.repo.Save(ctx, &next); err != nil {
+		return nil, fmt.Errorf("unable to start rematch: %w", err)
+	}
+	matchesCreated.Inc()
+
+	r.NextMatchId = next.Id
+	if err := d.repo.SaveRematch(ctx, r); err != nil {
+		return nil, fmt.Errorf("unable to accept rematch: %w", err)
+	}
+	logger(ctx).Info("rematch started", "next_match_id", next.Id)
+	return r, nil
+}
+
+func (d *MancalaDealer) GetRematch(ctx context.Context, m Match) (*Rematch, error) {
+	if m.P2 == "" || !game.Over(game.Board(m.Board)) {
+		return nil, nil
+	}
+	r, err := d.repo.GetRematch(ctx, m.Id)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get rematch: %w", err)
+	}
+	return r, nil
+}
+
+// OnMatchFinished registers f to be called with every match that ends.
+// It must be called before any move is made.
+func (d *MancalaDealer) OnMatchFinished(f func(context.Context, Match)) {
+	d.onFinished = append(d.onFinished, f)
+}
+
+// GetMatch returns the match if playerId is one of its players.
+func (d *MancalaDealer) GetMatch(ctx context.Context, matchId string, playerId string) (*Match, error) {
+	match, err := d.repo.Get(ctx, matchId)
+	if err != nil {
+		return nil, fmt.Errorf("unnable to get match: %w", err)
+	}
+	if !match.HasPlayer(playerId) {
+		return nil, ErrNotParticipant
 	}
 	return match, nil
 }
@@ -93,118 +327,304 @@ func (d *MancalaDealer) PlayerTurn(match Match, playerId string) bool {
 			break
 		}
 	}
-	
 
 	return !p1IsDone && !p2IsDone && match.Turn == playerId
 }
 
-func (d *MancalaDealer) MakeMove(pit int, match Match, playerId string) (bool, error) {
-	if err := d.repo.Lock(match.Id); err != nil {
-		return false, nil
+func (d *MancalaDealer) LegalMoves(match Match, playerId string) []int {
+	if checkTurn(match, playerId) != nil {
+		return []int{}
 	}
+	return game.LegalMoves(game.Board(match.Board), match.side(playerId))
+}
 
+// MakeMove locks the match and reads it again, so the move is made on its
+// latest board. The lock is held until the move is saved.
+func (d *MancalaDealer) MakeMove(ctx context.Context, pit int, match Match, playerId string) error {
 	if 0 > pit || pit >= boardSize {
-		return false, errors.New("invalid pit number")
+		return ErrInvalidPit
+	}
+
+	d.closing.RLock()
+	defer d.closing.RUnlock()
+	if d.closed {
+		movesRejected.WithLabelValues("closed").Inc()
+		return ErrDealerClosed
+	}
+
+	lock, err := d.repo.Lock(ctx, match.Id)
+	if err == ErrMatchLocked {
+		movesRejected.WithLabelValues("locked").Inc()
+		logger(ctx).Info("move rejected, match is locked")
+		return ErrMoveConflict
+	}
+	if err != nil {
+		return fmt.Errorf("unable to lock match: %w", err)
 	}
 
-	if match.Turn != playerId {
-		return false, nil
+	current, err := d.repo.Get(ctx, match.Id)
+	if err != nil {
+		d.unlock(ctx, match.Id, lock)
+		return fmt.Errorf("unnable to get match: %w", err)
+	}
 
+	if err := checkMove(*current, pit, playerId); err != nil {
+		d.unlock(ctx, match.Id, lock)
+		logger(ctx).Info("move rejected", "pit", pit, "error", err)
+		return err
 	}
 
-	d.moveInCh <- Move{pit, match}
+	// the move outlives the request that made it
+	move := Move{queued(context.WithoutCancel(ctx), "moves"), pit, *current, lock}
+	d.pending.Add(1)
+	moveQueueDepth.Inc()
+	if err := d.submit(ctx, move); err != nil {
+		d.pending.Add(-1)
+		moveQueueDepth.Dec()
+		endSpan(trace.SpanFromContext(move.ctx), err)
+		d.unlock(move.ctx, match.Id, lock)
+		return err
+	}
+	logger(ctx).Debug("move queued", "pit", pit)
 
-	return true, nil
+	return nil
+}
 
+// checkMove returns why playerId cannot sow pit of m now, if they cannot.
+// Only legal moves are queued.
+func checkMove(m Match, pit int, playerId string) error {
+	if err := checkTurn(m, playerId); err != nil {
+		return err
+	}
+	if m.Board[m.side(playerId)][pit] == 0 {
+		return ErrPitEmpty
+	}
+	return nil
 }
 
-func newBoard() [][]int {
-	b := make([][]int, 2)
-	for i := 0; i < boardSize; i++ {
-		b[0] = append(b[0], numStones)
-		b[1] = append(b[1], numStones)
+// checkTurn returns why playerId cannot move in m now, if they cannot.
+func checkTurn(m Match, playerId string) error {
+	if !m.HasPlayer(playerId) {
+		return ErrNotParticipant
+	}
+	if m.P1 == "" || m.P2 == "" {
+		return ErrMatchNotStarted
+	}
+	if game.Over(game.Board(m.Board)) {
+		return ErrMatchFinished
 	}
+	if m.Turn != playerId {
+		return ErrNotYourTurn
+	}
+	return nil
+}
 
-	b[0] = append(b[0], 0)
-	b[1] = append(b[1], 0)
+// submit queues the move in its lane, waiting for room at most the submit
+// timeout.
+func (d *MancalaDealer) submit(ctx context.Context, move Move) error {
+	moves := d.lane(move.match.Id).moves
+	select {
+	case moves <- move:
+		return nil
+	default:
+	}
 
-	return b
+	timeout := time.NewTimer(d.submitTimeout)
+	defer timeout.Stop()
+
+	select {
+	case moves <- move:
+		return nil
+	case <-timeout.C:
+		movesRejected.WithLabelValues("queue_full").Inc()
+		logger(ctx).Warn("move rejected, queue is full")
+		return ErrQueueFull
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
-func handleMove(d *MancalaDealer, out chan Move) {
-	for m := range d.moveInCh {
-		executeMove(m, d.moveInCh, out)
+func (d *MancalaDealer) unlock(ctx context.Context, matchId string, lock string) {
+	if err := d.repo.Unlock(ctx, matchId, lock); err != nil {
+		logger(ctx).Warn("failed to unlock match", "error", err)
 	}
 }
 
-func handleMoveCompleted(d *MancalaDealer, ch chan Move) {
-	for m := range ch {
-		if m.match.Turn == m.match.P1 {
-			m.match.Turn = m.match.P2
-		} else {
-			m.match.Turn = m.match.P1
+// dropMove gives up on a move whose match is not locked anymore, as
+// another move may have changed it, or that the rules do not allow.
+func (d *MancalaDealer) dropMove(m Move, err error) {
+	logger(m.ctx).Warn("move dropped", "error", err)
+	movesDropped.Inc()
+	d.pending.Add(-1)
+}
+
+func (d *MancalaDealer) Ready(ctx context.Context) error {
+	d.closing.RLock()
+	closed := d.closed
+	d.closing.RUnlock()
+	if closed {
+		return ErrDealerClosed
+	}
+
+	if d.moveWorkers.Load() == 0 || d.completedWorkers.Load() == 0 {
+		return errors.New("move workers are not running")
+	}
+
+	// unbuffered lanes hand moves straight to their worker, they are never
+	// full
+	for i, l := range d.lanes {
+		if cap(l.moves) > 0 && len(l.moves) == cap(l.moves) {
+			return fmt.Errorf("move lane %v is full", i)
 		}
+	}
 
-		d.repo.Save(&m.match)
+	if err := d.repo.Ping(ctx); err != nil {
+		return fmt.Errorf("repository unreachable: %w", err)
 	}
+
+	return nil
 }
 
-func executeMove(move Move, moveCh chan Move, completedCh chan Move) {
-	var playerBoard int
-	var opponentBoard int
+// Close lets the workers finish every accepted move before stopping them.
+func (d *MancalaDealer) Close(ctx context.Context) error {
+	d.closing.Lock()
+	closed := d.closed
+	d.closed = true
+	d.closing.Unlock()
+	if closed {
+		return nil
+	}
 
-	if move.match.Turn == move.match.P1 {
-		playerBoard = 0
-		opponentBoard = 1
-	} else {
-		playerBoard = 1
-		opponentBoard = 0
-	}
-
-	linearBoard := append(move.match.Board[playerBoard], move.match.Board[opponentBoard]...)
-
-	stones := linearBoard[move.pit]
-	linearBoard[move.pit] = 0
-
-	firstPit := move.pit + 1
-	lastPit := len(linearBoard)-1
-	for {
-		for i := firstPit; i < lastPit; i++ {
-			linearBoard[i] += 1
-			stones -= 1
-			if stones == 0 {
-				move.match.Board[playerBoard] = linearBoard[:boardSize+1]
-				move.match.Board[opponentBoard] = linearBoard[boardSize+1:]
-
-				if endsOnMySide(i){
-					if wasEmpty(linearBoard[i]) {
-						collectStones(i,linearBoard)
-						completedCh <- move
-					} else {
-						moveCh <- Move{pit: i, match: move.match}
-					}
-
-				} else {
-					completedCh <- move
-				}
-				return
-			}
+	logger(ctx).Info("dealer closing", "pending_moves", d.pending.Load())
+	if err := waitFor(ctx, func() bool { return d.pending.Load() <= 0 }); err != nil {
+		return fmt.Errorf("%v moves not saved: %w", d.pending.Load(), err)
+	}
+
+	for _, l := range d.lanes {
+		close(l.moves)
+		close(l.completed)
+	}
+
+	return waitFor(ctx, func() bool {
+		return d.moveWorkers.Load() == 0 && d.completedWorkers.Load() == 0
+	})
+}
+
+// waitFor polls done until it returns true or ctx is done.
+func waitFor(ctx context.Context, done func() bool) error {
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+
+	for !done() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
 		}
-		firstPit = 0
 	}
+	return nil
 }
 
-func collectStones(i int, linearBoard []int) {
-	linearBoard[i] = 0
-	opponentStone := linearBoard[i+boardSize+1]
-	linearBoard[i+boardSize+1] = 0
-	linearBoard[boardSize] += opponentStone + 1
+func newBoard() [][]int {
+	return game.NewBoard()
+}
+
+func (d *MancalaDealer) newBoard() MancalaBoard {
+	return MancalaBoard(game.NewBoardOf(d.stones))
 }
 
-func wasEmpty(i int) bool {
-	return i == 1
+func handleMove(d *MancalaDealer, l lane) {
+	d.moveWorkers.Add(1)
+	defer d.moveWorkers.Add(-1)
+
+	for m := range l.moves {
+		moveQueueDepth.Dec()
+		dequeued(m.ctx)
+
+		if err := d.repo.ExtendLock(m.ctx, m.match.Id, m.lock); err != nil {
+			d.dropMove(m, err)
+			continue
+		}
+
+		start := time.Now()
+		var span trace.Span
+		m.ctx, span = tracer.Start(m.ctx, "sow", trace.WithAttributes(attribute.Int("pit", m.pit)))
+		var err error
+		m, err = executeMove(m)
+		endSpan(span, err)
+		workerDuration.WithLabelValues("move").Observe(time.Since(start).Seconds())
+		if err != nil {
+			// MakeMove only queues legal moves, the match changed since
+			d.unlock(m.ctx, m.match.Id, m.lock)
+			d.dropMove(m, err)
+			continue
+		}
+
+		m.ctx = queued(m.ctx, "completed")
+		l.completed <- m
+	}
 }
 
-func endsOnMySide(i int) bool {
-	return i < boardSize 
+func handleMoveCompleted(d *MancalaDealer, ch chan Move) {
+	d.completedWorkers.Add(1)
+	defer d.completedWorkers.Add(-1)
+
+	for m := range ch {
+		dequeued(m.ctx)
+
+		start := time.Now()
+		var span trace.Span
+		m.ctx, span = tracer.Start(m.ctx, "complete move")
+		if err := d.repo.ExtendLock(m.ctx, m.match.Id, m.lock); err != nil {
+			endSpan(span, err)
+			d.dropMove(m, err)
+			continue
+		}
+
+		m.match.LastMove = &LastMove{Player: m.match.Turn, Pit: m.pit}
+		if len(m.match.Openings) < 2 {
+			m.match.Openings = append(m.match.Openings, m.pit)
+		}
+		m.match.passTurn()
+		over := game.Over(game.Board(m.match.Board))
+		if over {
+			now := time.Now()
+			m.match.FinishedAt = &now
+		}
+
+		if err := d.repo.Save(m.ctx, &m.match); err != nil {
+			endSpan(span, err)
+			d.unlock(m.ctx, m.match.Id, m.lock)
+			d.dropMove(m, err)
+			continue
+		}
+		d.unlock(m.ctx, m.match.Id, m.lock)
+		movesApplied.Inc()
+		logger(m.ctx).Debug("move applied", "board", m.match.Board)
+
+		if over {
+			matchesFinished.Inc()
+			logger(m.ctx).Info("match finished",
+				"p1_score", game.Score(game.Board(m.match.Board), 0),
+				"p2_score", game.Score(game.Board(m.match.Board), 1))
+			for _, f := range d.onFinished {
+				f(m.ctx, m.match)
+			}
+		}
+		span.End()
+		d.pending.Add(-1)
+		workerDuration.WithLabelValues("completed").Observe(time.Since(start).Seconds())
+	}
+}
+
+// executeMove sows the move, and keeps sowing from where it ends as long
+// as it relays, without giving the lane to another move in between.
+func executeMove(move Move) (Move, error) {
+	board, err := game.Play(game.Board(move.match.Board), move.match.side(move.match.Turn), move.pit)
+	if err != nil {
+		return move, err
+	}
+
+	move.match.Board = MancalaBoard(board)
+	return move, nil
 }
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"context"
 	"errors"
+	"reflect"
+	"strconv"
 	"testing"
 	"time"
 
@@ -11,14 +14,21 @@ import (
 type StubRepo struct {
 	match        *Match
 	waitingMatch *Match
+	pingErr      error
+	lockErr      error
+	saveErr      error
+	lockLost     bool
+	// token of the last lock released
+	unlocked string
+	rematch  *Rematch
 }
 
 func TestJoinNewMatch(t *testing.T) {
 
 	var stubRepo MatchRepo = &StubRepo{}
-	md := newDealer(stubRepo)
+	md := newDealer(stubRepo, testConfig.Dealer, testConfig.Board)
 
-	match, p1 := md.JoinMatch()
+	match, p1, _ := md.JoinMatch(context.Background())
 
 	if match.P1 != p1 {
 		t.Fatalf("Player1 does not match: %v and %v", match.P1, p1)
@@ -29,10 +39,10 @@ func TestJoinNewMatch(t *testing.T) {
 func TestJoinExistingMatch(t *testing.T) {
 
 	var stubRepo MatchRepo = &StubRepo{}
-	md := newDealer(stubRepo)
+	md := newDealer(stubRepo, testConfig.Dealer, testConfig.Board)
 
-	originalMatch, _ := md.JoinMatch()
-	existingMatch, _ := md.JoinMatch()
+	originalMatch, _, _ := md.JoinMatch(context.Background())
+	existingMatch, _, _ := md.JoinMatch(context.Background())
 
 	if originalMatch.Id != existingMatch.Id {
 		t.Fatalf("A new match shoudl not be created if one is already available:\n original: %v \n new: %v", originalMatch.Id, existingMatch.Id)
@@ -43,10 +53,10 @@ func TestJoinExistingMatch(t *testing.T) {
 func TestJoinExistingMatchSetsP2(t *testing.T) {
 
 	var stubRepo MatchRepo = &StubRepo{}
-	md := newDealer(stubRepo)
+	md := newDealer(stubRepo, testConfig.Dealer, testConfig.Board)
 
-	md.JoinMatch()
-	existingMatch, p2 := md.JoinMatch()
+	md.JoinMatch(context.Background())
+	existingMatch, p2, _ := md.JoinMatch(context.Background())
 
 	if existingMatch.P2 != p2 {
 		t.Fatalf("Player2 does not match: %v and %v", existingMatch.P2, p2)
@@ -57,10 +67,10 @@ func TestJoinExistingMatchSetsP2(t *testing.T) {
 func TestSetsTurnToP1WhenGameStarts(t *testing.T) {
 
 	var stubRepo MatchRepo = &StubRepo{}
-	md := newDealer(stubRepo)
+	md := newDealer(stubRepo, testConfig.Dealer, testConfig.Board)
 
-	_, p1 := md.JoinMatch()
-	match, p2 := md.JoinMatch()
+	_, p1, _ := md.JoinMatch(context.Background())
+	match, p2, _ := md.JoinMatch(context.Background())
 
 	if !md.PlayerTurn(*match, p1) {
 		t.Fatal("expected to be Player1 turn but it is not")
@@ -74,32 +84,59 @@ func TestSetsTurnToP1WhenGameStarts(t *testing.T) {
 
 func TestSetsTurnToNoOneIfBoardAreEmpty(t *testing.T) {
 	var stubRepo MatchRepo = &StubRepo{}
-	md := newDealer(stubRepo)
+	md := newDealer(stubRepo, testConfig.Dealer, testConfig.Board)
 
 	p1 := uuid.NewString()
 	p2 := uuid.NewString()
 
-	match := Match{P1: p1, P2: p2, Turn: p1, Board: MancalaBoard{{0,0,0,0,0,0,10}, {1,1,1,1,1,1,1}}}
+	match := Match{P1: p1, P2: p2, Turn: p1, Board: MancalaBoard{{0, 0, 0, 0, 0, 0, 10}, {1, 1, 1, 1, 1, 1, 1}}}
 	if md.PlayerTurn(match, match.P1) {
 		t.Fatal("expected to not be Player1 turn but it is")
 	}
 
-	match = Match{P1: p1, P2: p2, Turn: p2, Board: MancalaBoard{{1,1,1,1,1,1,1}, {0,0,0,0,0,0,10}}}
+	match = Match{P1: p1, P2: p2, Turn: p2, Board: MancalaBoard{{1, 1, 1, 1, 1, 1, 1}, {0, 0, 0, 0, 0, 0, 10}}}
 	if md.PlayerTurn(match, match.P2) {
 		t.Fatal("expected to not be Player2 turn but it is")
 	}
 
 }
 
+func TestStartMatch(t *testing.T) {
+
+	var stubRepo = &StubRepo{}
+	md := newDealer(stubRepo, testConfig.Dealer, testConfig.Board)
+
+	p1 := uuid.NewString()
+	p2 := uuid.NewString()
+	match, _ := md.StartMatch(context.Background(), uuid.NewString(), p1, p2)
+
+	if match.P1 != p1 || match.P2 != p2 {
+		t.Fatalf("both players should be set: %v", match)
+	}
+
+	if !md.PlayerTurn(*match, match.P1) {
+		t.Fatal("expected to be Player1 turn but it is not")
+	}
+
+	if stubRepo.match != match {
+		t.Fatal("match was not saved")
+	}
+
+	if stubRepo.waitingMatch != nil {
+		t.Fatal("match should not be waiting for players")
+	}
+
+}
+
 func TestGetExistingMatch(t *testing.T) {
 
 	var stubRepo MatchRepo = &StubRepo{}
-	md := newDealer(stubRepo)
+	md := newDealer(stubRepo, testConfig.Dealer, testConfig.Board)
 
 	match := Match{Id: uuid.NewString(), P1: uuid.NewString(), Board: newBoard()}
-	stubRepo.Save(&match)
+	stubRepo.Save(context.Background(), &match)
 
-	existingMatch, _ := md.GetMatch(match.Id, match.P1)
+	existingMatch, _ := md.GetMatch(context.Background(), match.Id, match.P1)
 
 	if existingMatch.Id != match.Id {
 		t.Fatalf("failed to get correct match. expected %v but got %v", match.Id, existingMatch.Id)
@@ -110,14 +147,30 @@ func TestGetExistingMatch(t *testing.T) {
 func TestGetNonExistingMatch(t *testing.T) {
 
 	var stubRepo MatchRepo = &StubRepo{}
-	md := newDealer(stubRepo)
+	md := newDealer(stubRepo, testConfig.Dealer, testConfig.Board)
 
 	match := Match{Id: uuid.NewString(), P1: uuid.NewString(), Board: newBoard()}
-	stubRepo.Save(&match)
+	stubRepo.Save(context.Background(), &match)
 
-	_, err := md.GetMatch(uuid.NewString(), uuid.NewString())
-	if err == nil {
-		t.Fatal("it should not get a non existing match")
+	_, err := md.GetMatch(context.Background(), uuid.NewString(), uuid.NewString())
+	if !errors.Is(err, ErrMatchNotFound) {
+		t.Fatalf("expected ErrMatchNotFound but got %v", err)
+	}
+
+}
+
+func TestGetMatchOfOtherPlayers(t *testing.T) {
+
+	var stubRepo MatchRepo = &StubRepo{}
+	md := newDealer(stubRepo, testConfig.Dealer, testConfig.Board)
+
+	match := Match{Id: uuid.NewString(), P1: uuid.NewString(), Board: newBoard()}
+	stubRepo.Save(context.Background(), &match)
+
+	for _, playerId := range []string{uuid.NewString(), ""} {
+		if _, err := md.GetMatch(context.Background(), match.Id, playerId); err != ErrNotParticipant {
+			t.Fatalf("expected ErrNotParticipant for %q but got %v", playerId, err)
+		}
 	}
 
 }
@@ -125,15 +178,14 @@ func TestGetNonExistingMatch(t *testing.T) {
 func TestMakeMoveOnMyTurn(t *testing.T) {
 
 	var stubRepo MatchRepo = &StubRepo{}
-	md := newDealer(stubRepo)
+	md := newDealer(stubRepo, testConfig.Dealer, testConfig.Board)
 
 	p1Id := uuid.NewString()
-	match := Match{Id: uuid.NewString(), P1: p1Id, Turn: p1Id, Board: newBoard()}
-
-	validMove, _ := md.MakeMove(1, match, match.P1)
+	match := Match{Id: uuid.NewString(), P1: p1Id, P2: uuid.NewString(), Turn: p1Id, Board: newBoard()}
+	stubRepo.Save(context.Background(), &match)
 
-	if !validMove {
-		t.Fatal("it should be a valid move")
+	if err := md.MakeMove(context.Background(), 1, match, match.P1); err != nil {
+		t.Fatalf("it should be a valid move: %v", err)
 	}
 
 }
@@ -141,14 +193,14 @@ func TestMakeMoveOnMyTurn(t *testing.T) {
 func TestMakeMoveNotOnMyTurn(t *testing.T) {
 
 	var stubRepo MatchRepo = &StubRepo{}
-	md := newDealer(stubRepo)
+	md := newDealer(stubRepo, testConfig.Dealer, testConfig.Board)
 
-	match := Match{Id: uuid.NewString(), P1: uuid.NewString(), Turn: uuid.NewString(), Board: newBoard()}
-
-	validMove, _ := md.MakeMove(1, match, match.P1)
+	p2Id := uuid.NewString()
+	match := Match{Id: uuid.NewString(), P1: uuid.NewString(), P2: p2Id, Turn: p2Id, Board: newBoard()}
+	stubRepo.Save(context.Background(), &match)
 
-	if validMove {
-		t.Fatal("it should not be a valid move")
+	if err := md.MakeMove(context.Background(), 1, match, match.P1); err != ErrNotYourTurn {
+		t.Fatalf("expected ErrNotYourTurn but got %v", err)
 	}
 
 }
@@ -156,69 +208,498 @@ func TestMakeMoveNotOnMyTurn(t *testing.T) {
 func TestMakeMoveInvalidPit(t *testing.T) {
 
 	var stubRepo MatchRepo = &StubRepo{}
-	md := newDealer(stubRepo)
+	md := newDealer(stubRepo, testConfig.Dealer, testConfig.Board)
 
 	p1Id := uuid.NewString()
-	match := Match{Id: uuid.NewString(), P1: p1Id, Turn: p1Id, Board: newBoard()}
+	match := Match{Id: uuid.NewString(), P1: p1Id, P2: uuid.NewString(), Turn: p1Id, Board: newBoard()}
 
-	_, err := md.MakeMove(-1, match, match.P1)
-	if err == nil {
+	err := md.MakeMove(context.Background(), -1, match, match.P1)
+	if err != ErrInvalidPit {
 		t.Fatal("pit -1 should not be a valid move")
 	}
 
-	_, err = md.MakeMove(boardSize, match, match.P1)
-	if err == nil {
+	err = md.MakeMove(context.Background(), boardSize, match, match.P1)
+	if err != ErrInvalidPit {
 		t.Fatal("pit greater than the numbers of pits should not be a valid move")
 	}
 
-	_, err = md.MakeMove(boardSize+1, match, match.P1)
-	if err == nil {
+	err = md.MakeMove(context.Background(), boardSize+1, match, match.P1)
+	if err != ErrInvalidPit {
 		t.Fatal("pit greater than the numbers of pits should not be a valid move")
 	}
 
 }
 
+func TestMakeMoveRejectedByTheMatch(t *testing.T) {
+
+	p1Id := uuid.NewString()
+	p2Id := uuid.NewString()
+	finished := MancalaBoard{{0, 0, 0, 0, 0, 0, 40}, {1, 0, 0, 0, 0, 0, 31}}
+	emptyPit := MancalaBoard{{0, 6, 6, 6, 6, 6, 0}, {6, 6, 6, 6, 6, 6, 0}}
+
+	tests := []struct {
+		name     string
+		match    Match
+		playerId string
+		expected error
+	}{
+		{"not a player", Match{P1: p1Id, P2: p2Id, Turn: p1Id, Board: newBoard()}, uuid.NewString(), ErrNotParticipant},
+		{"finished", Match{P1: p1Id, P2: p2Id, Turn: p1Id, Board: finished}, p1Id, ErrMatchFinished},
+		{"empty pit", Match{P1: p1Id, P2: p2Id, Turn: p1Id, Board: emptyPit}, p1Id, ErrPitEmpty},
+		{"opponent's turn", Match{P1: p1Id, P2: p2Id, Turn: p2Id, Board: newBoard()}, p1Id, ErrNotYourTurn},
+		{"no opponent yet", Match{P1: p1Id, Turn: p1Id, Board: newBoard()}, p1Id, ErrMatchNotStarted},
+	}
+
+	for _, tt := range tests {
+		stubRepo := &StubRepo{}
+		md := newDealer(stubRepo, testConfig.Dealer, testConfig.Board)
+		tt.match.Id = uuid.NewString()
+		stubRepo.Save(context.Background(), &tt.match)
+
+		if err := md.MakeMove(context.Background(), 0, tt.match, tt.playerId); err != tt.expected {
+			t.Fatalf("%v: expected %v but got %v", tt.name, tt.expected, err)
+		}
+		if stubRepo.unlocked != "token-"+tt.match.Id {
+			t.Fatalf("%v: the match should be unlocked when the move is rejected", tt.name)
+		}
+	}
+
+}
+
+func TestLegalMoves(t *testing.T) {
+
+	md := newDealer(&StubRepo{}, testConfig.Dealer, testConfig.Board)
+
+	p1Id := uuid.NewString()
+	p2Id := uuid.NewString()
+	board := MancalaBoard{{0, 6, 0, 6, 6, 6, 0}, {6, 6, 6, 6, 6, 0, 0}}
+	finished := MancalaBoard{{0, 0, 0, 0, 0, 0, 40}, {1, 0, 0, 0, 0, 0, 31}}
+
+	tests := []struct {
+		name     string
+		match    Match
+		playerId string
+		expected []int
+	}{
+		{"my turn", Match{P1: p1Id, P2: p2Id, Turn: p1Id, Board: board}, p1Id, []int{1, 3, 4, 5}},
+		{"my turn as p2", Match{P1: p1Id, P2: p2Id, Turn: p2Id, Board: board}, p2Id, []int{0, 1, 2, 3, 4}},
+		{"opponent's turn", Match{P1: p1Id, P2: p2Id, Turn: p2Id, Board: board}, p1Id, []int{}},
+		{"no opponent yet", Match{P1: p1Id, Turn: p1Id, Board: board}, p1Id, []int{}},
+		{"finished", Match{P1: p1Id, P2: p2Id, Turn: p1Id, Board: finished}, p1Id, []int{}},
+	}
+
+	for _, tt := range tests {
+		if moves := md.LegalMoves(tt.match, tt.playerId); !reflect.DeepEqual(moves, tt.expected) {
+			t.Fatalf("%v: expected %v but got %v", tt.name, tt.expected, moves)
+		}
+	}
+
+}
+
 func TestMakeMoveChangesBoard(t *testing.T) {
 
 	var stubRepo MatchRepo = &StubRepo{}
-	md := newDealer(stubRepo)
+	md := newDealer(stubRepo, testConfig.Dealer, testConfig.Board)
 
 	p1Id := uuid.NewString()
-	match := Match{Id: uuid.NewString(), P1: p1Id, Turn: p1Id, Board: newBoard()}
+	match := Match{Id: uuid.NewString(), P1: p1Id, P2: uuid.NewString(), Turn: p1Id, Board: newBoard()}
+	stubRepo.Save(context.Background(), &match)
 
-	md.MakeMove(0, match, match.P1)
-	time.Sleep(1 * time.Millisecond)
+	md.MakeMove(context.Background(), 0, match, match.P1)
+	// closing waits for the move to be saved
+	md.Close(context.Background())
 
-	if match.Board[0][0] != 0 {
+	saved, _ := stubRepo.Get(context.Background(), match.Id)
+	if saved.Board[0][0] != 0 {
 		t.Fatal("pit should be zero after the move")
 	}
+	if saved.LastMove == nil || *saved.LastMove != (LastMove{Player: p1Id, Pit: 0}) {
+		t.Fatalf("expected the move to be saved as the last one, got %+v", saved.LastMove)
+	}
+
+}
+
+func TestMakeMoveGivesUpWhenContextIsDone(t *testing.T) {
+
+	// no workers read the queue
+	stubRepo := &StubRepo{}
+	md := &MancalaDealer{repo: stubRepo, lanes: []lane{{moves: make(chan Move)}}, submitTimeout: time.Second}
+
+	p1Id := uuid.NewString()
+	match := Match{Id: uuid.NewString(), P1: p1Id, P2: uuid.NewString(), Turn: p1Id, Board: newBoard()}
+	stubRepo.Save(context.Background(), &match)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := md.MakeMove(ctx, 0, match, match.P1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the move to time out but got %v", err)
+	}
+
+}
+
+func TestMakeMoveOnFullQueue(t *testing.T) {
+
+	// no workers read the queue
+	stubRepo := &StubRepo{}
+	md := &MancalaDealer{repo: stubRepo, lanes: []lane{{moves: make(chan Move)}}, submitTimeout: 10 * time.Millisecond}
+
+	p1Id := uuid.NewString()
+	match := Match{Id: uuid.NewString(), P1: p1Id, P2: uuid.NewString(), Turn: p1Id, Board: newBoard()}
+	stubRepo.Save(context.Background(), &match)
+
+	if err := md.MakeMove(context.Background(), 0, match, match.P1); err != ErrQueueFull {
+		t.Fatalf("expected ErrQueueFull but got %v", err)
+	}
+
+	if md.pending.Load() != 0 || stubRepo.unlocked != "token-"+match.Id {
+		t.Fatal("a rejected move should not be pending nor keep its match locked")
+	}
+
+}
+
+func TestStartMatchWithConfiguredStones(t *testing.T) {
+
+	md := newDealer(&StubRepo{}, testConfig.Dealer, BoardConfig{Stones: 4})
+
+	match, _ := md.StartMatch(context.Background(), uuid.NewString(), uuid.NewString(), uuid.NewString())
+
+	if match.Board[0][0] != 4 || match.Board[1][0] != 4 || match.Stones != 4 {
+		t.Fatalf("expected 4 stones per pit but got %v", match.Board)
+	}
+
+}
+
+func TestReady(t *testing.T) {
+
+	md := newDealer(&StubRepo{}, testConfig.Dealer, testConfig.Board)
+	time.Sleep(10 * time.Millisecond)
+
+	if err := md.Ready(context.Background()); err != nil {
+		t.Fatalf("dealer should be ready but got %v", err)
+	}
+
+}
+
+func TestNotReadyWithoutRepository(t *testing.T) {
+
+	md := newDealer(&StubRepo{pingErr: errors.New("connection refused")}, testConfig.Dealer, testConfig.Board)
+
+	if err := md.Ready(context.Background()); err == nil {
+		t.Fatal("dealer should not be ready without a repository")
+	}
+
+}
+
+func TestNotReadyWithoutWorkers(t *testing.T) {
+
+	md := &MancalaDealer{repo: &StubRepo{}, lanes: []lane{{moves: make(chan Move, boardSize)}}}
+
+	if err := md.Ready(context.Background()); err == nil {
+		t.Fatal("dealer should not be ready without workers")
+	}
+
+}
+
+func TestNotReadyWithFullQueue(t *testing.T) {
+
+	md := &MancalaDealer{repo: &StubRepo{}, lanes: []lane{{moves: make(chan Move, 1)}}}
+	md.moveWorkers.Add(1)
+	md.completedWorkers.Add(1)
+	md.lanes[0].moves <- Move{}
+
+	if err := md.Ready(context.Background()); err == nil {
+		t.Fatal("dealer should not be ready with a full move queue")
+	}
+
+}
+
+func TestReadyWithUnbufferedLanes(t *testing.T) {
+
+	md := &MancalaDealer{repo: &StubRepo{}, lanes: []lane{{moves: make(chan Move)}}}
+	md.moveWorkers.Add(1)
+	md.completedWorkers.Add(1)
+
+	if err := md.Ready(context.Background()); err != nil {
+		t.Fatalf("dealer with unbuffered lanes should be ready but got %v", err)
+	}
+
+}
+
+func TestCloseSavesQueuedMoves(t *testing.T) {
+
+	var stubRepo = &StubRepo{}
+	md := newDealer(stubRepo, testConfig.Dealer, testConfig.Board)
+
+	p1Id := uuid.NewString()
+	match := Match{Id: uuid.NewString(), P1: p1Id, P2: uuid.NewString(), Turn: p1Id, Board: newBoard()}
+	stubRepo.Save(context.Background(), &match)
+	md.MakeMove(context.Background(), 0, match, match.P1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := md.Close(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if stubRepo.match == nil || stubRepo.match.Turn != match.P2 {
+		t.Fatal("the queued move should be saved before closing")
+	}
+
+	if stubRepo.unlocked != "token-"+match.Id {
+		t.Fatal("the match should be unlocked once the move is saved")
+	}
+
+}
+
+func TestMakeMoveAfterClose(t *testing.T) {
+
+	md := newDealer(&StubRepo{}, testConfig.Dealer, testConfig.Board)
+	md.Close(context.Background())
+
+	p1Id := uuid.NewString()
+	match := Match{Id: uuid.NewString(), P1: p1Id, P2: uuid.NewString(), Turn: p1Id, Board: newBoard()}
+
+	if err := md.MakeMove(context.Background(), 0, match, match.P1); err != ErrDealerClosed {
+		t.Fatalf("expected ErrDealerClosed but got %v", err)
+	}
+
+	if err := md.Ready(context.Background()); err == nil {
+		t.Fatal("a closed dealer should not be ready")
+	}
+
+}
+
+func TestCloseGivesUpOnStuckMoves(t *testing.T) {
+
+	// no workers take the move
+	stubRepo := &StubRepo{}
+	md := &MancalaDealer{repo: stubRepo, lanes: []lane{{moves: make(chan Move, 1), completed: make(chan Move, 1)}}}
+
+	p1Id := uuid.NewString()
+	match := Match{Id: uuid.NewString(), P1: p1Id, P2: uuid.NewString(), Turn: p1Id, Board: newBoard()}
+	stubRepo.Save(context.Background(), &match)
+	md.MakeMove(context.Background(), 0, match, match.P1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if err := md.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected close to time out but got %v", err)
+	}
 
 }
 
 func TestMakeMoveOnOngoingMove(t *testing.T) {
 
 	var stubRepo MatchRepo = &StubRepo{}
-	md := newDealer(stubRepo)
+	md := newDealer(stubRepo, testConfig.Dealer, testConfig.Board)
+
+	p1Id := uuid.NewString()
+	match := Match{Id: lockedMatchId, P1: p1Id, P2: uuid.NewString(), Turn: p1Id, Board: newBoard()}
+
+	if err := md.MakeMove(context.Background(), 0, match, match.P1); err != ErrMoveConflict {
+		t.Fatalf("expected ErrMoveConflict on a locked match but got %v", err)
+	}
+
+}
+
+func TestRematchIsOfferedThenAccepted(t *testing.T) {
+
+	finished := Match{Id: uuid.NewString(), P1: uuid.NewString(), P2: uuid.NewString(), Board: MancalaBoard{{0, 0, 0, 0, 0, 0, 40}, {0, 0, 0, 0, 0, 1, 31}}}
+	stubRepo := &StubRepo{match: &finished}
+	md := newDealer(stubRepo, testConfig.Dealer, BoardConfig{Stones: 4})
+
+	offer, err := md.Rematch(context.Background(), finished.Id, finished.P1)
+	if err != nil || offer.OfferedBy != finished.P1 || offer.NextMatchId != "" {
+		t.Fatalf("expected P1 to offer a rematch but got %+v, %v", offer, err)
+	}
+	if again, _ := md.Rematch(context.Background(), finished.Id, finished.P1); again.NextMatchId != "" {
+		t.Fatalf("the player offering should not accept their own offer: %+v", again)
+	}
+
+	accepted, err := md.Rematch(context.Background(), finished.Id, finished.P2)
+	if err != nil || accepted.NextMatchId == "" {
+		t.Fatalf("expected P2 to accept the rematch but got %+v, %v", accepted, err)
+	}
+	if stubRepo.unlocked != "token-"+finished.Id {
+		t.Fatalf("expected the finished match to be unlocked but got %v", stubRepo.unlocked)
+	}
+
+	next := stubRepo.match
+	if next.Id != accepted.NextMatchId || next.Previous != finished.Id || next.Stones != 4 {
+		t.Fatalf("expected a new match linked to the finished one but got %+v", next)
+	}
+	if next.P1 != finished.P2 || next.P2 != finished.P1 || next.Turn != finished.P2 {
+		t.Fatalf("expected the players to swap sides, P2 starting, but got %+v", next)
+	}
+}
+
+func TestRematchIsNotAcceptedWhenTheNextMatchIsNotSaved(t *testing.T) {
+
+	finished := Match{Id: uuid.NewString(), P1: uuid.NewString(), P2: uuid.NewString(), Board: MancalaBoard{{0, 0, 0, 0, 0, 0, 40}, {0, 0, 0, 0, 0, 1, 31}}}
+	stubRepo := &StubRepo{match: &finished}
+	md := newDealer(stubRepo, testConfig.Dealer, testConfig.Board)
+	md.Rematch(context.Background(), finished.Id, finished.P1)
+
+	stubRepo.saveErr = errors.New("i/o timeout")
+	if _, err := md.Rematch(context.Background(), finished.Id, finished.P2); err == nil {
+		t.Fatal("a repository failure should be an error")
+	}
+	if stubRepo.rematch.NextMatchId != "" {
+		t.Fatalf("the rematch should still be offered only but got %+v", stubRepo.rematch)
+	}
+}
+
+func TestRematchOfOngoingMatch(t *testing.T) {
 
 	p1Id := uuid.NewString()
-	match := Match{Id: lockedMatchId, P1: p1Id, Turn: p1Id, Board: newBoard()}
+	match := Match{Id: uuid.NewString(), P1: p1Id, P2: uuid.NewString(), Turn: p1Id, Board: newBoard()}
+	md := newDealer(&StubRepo{match: &match}, testConfig.Dealer, testConfig.Board)
+
+	if _, err := md.Rematch(context.Background(), match.Id, p1Id); err != ErrMatchNotOver {
+		t.Fatalf("expected ErrMatchNotOver but got %v", err)
+	}
+	if _, err := md.Rematch(context.Background(), match.Id, uuid.NewString()); err != ErrNotParticipant {
+		t.Fatalf("expected ErrNotParticipant but got %v", err)
+	}
+	if _, err := md.Rematch(context.Background(), lockedMatchId, p1Id); err != ErrRematchConflict {
+		t.Fatalf("expected ErrRematchConflict on a locked match but got %v", err)
+	}
+}
+
+func TestMakeMoveOnLockFailure(t *testing.T) {
+
+	md := newDealer(&StubRepo{lockErr: errors.New("connection refused")}, testConfig.Dealer, testConfig.Board)
+
+	p1Id := uuid.NewString()
+	match := Match{Id: uuid.NewString(), P1: p1Id, P2: uuid.NewString(), Turn: p1Id, Board: newBoard()}
+
+	if err := md.MakeMove(context.Background(), 0, match, match.P1); err == nil {
+		t.Fatal("a repository failure should be an error")
+	}
+
+}
+
+func TestMakeMoveReadsTheLockedMatch(t *testing.T) {
+
+	var stubRepo = &StubRepo{}
+	md := newDealer(stubRepo, testConfig.Dealer, testConfig.Board)
+
+	p1Id := uuid.NewString()
+	p2Id := uuid.NewString()
+	match := Match{Id: uuid.NewString(), P1: p1Id, P2: p2Id, Turn: p1Id, Board: newBoard()}
+	stubRepo.Save(context.Background(), &Match{Id: match.Id, P1: p1Id, P2: p2Id, Turn: p2Id, Board: newBoard()})
+
+	if err := md.MakeMove(context.Background(), 0, match, match.P1); err != ErrNotYourTurn {
+		t.Fatalf("the move should be checked against the saved match, got %v", err)
+	}
+
+	if stubRepo.unlocked != "token-"+match.Id {
+		t.Fatal("the match should be unlocked when the move is rejected")
+	}
+
+}
+
+func TestMoveIsDroppedWhenLockIsLost(t *testing.T) {
+
+	var stubRepo = &StubRepo{lockLost: true}
+	ch := make(chan Move, 1)
+	d := MancalaDealer{repo: stubRepo}
+
+	match := Match{Id: uuid.NewString(), P1: uuid.NewString(), P2: uuid.NewString(), Board: newBoard()}
+	ch <- Move{ctx: context.Background(), pit: 0, match: match, lock: "expired"}
+	close(ch)
+	handleMoveCompleted(&d, ch)
+
+	if stubRepo.match != nil {
+		t.Fatal("a move should not be saved without its match lock")
+	}
+
+}
+
+func TestMoveIsDroppedWhenSaveFails(t *testing.T) {
+
+	var stubRepo = &StubRepo{saveErr: errors.New("i/o timeout")}
+	ch := make(chan Move, 1)
+	d := MancalaDealer{repo: stubRepo}
+	d.pending.Add(1)
+
+	finished := false
+	d.OnMatchFinished(func(ctx context.Context, m Match) {
+		finished = true
+	})
+
+	p1 := uuid.NewString()
+	over := Match{Id: uuid.NewString(), P1: p1, P2: uuid.NewString(), Turn: p1, Board: MancalaBoard{{0, 0, 0, 0, 0, 0, 40}, {1, 0, 0, 0, 0, 0, 31}}}
+	ch <- Move{ctx: context.Background(), match: over, lock: "token"}
+	close(ch)
+	handleMoveCompleted(&d, ch)
+
+	if d.pending.Load() != 0 || stubRepo.unlocked != "token" {
+		t.Fatal("a move that is not saved should be dropped and its match unlocked")
+	}
+	if finished {
+		t.Fatal("a match that is not saved should not finish")
+	}
+
+}
+
+func TestMovesOfAMatchAreSavedInOrder(t *testing.T) {
+
+	repo := &recordingRepo{}
+	md := newDealer(repo, DealerConfig{Workers: 4, MoveBuffer: 10, CompletedBuffer: 10}, testConfig.Board).(*MancalaDealer)
+
+	id := uuid.NewString()
+	for i := 0; i < 10; i++ {
+		p1 := strconv.Itoa(i)
+		md.pending.Add(1)
+		moveQueueDepth.Inc()
+		md.lane(id).moves <- Move{ctx: context.Background(), pit: 0, match: Match{Id: id, P1: p1, P2: "p2", Turn: p1, Board: newBoard()}}
+	}
+	md.Close(context.Background())
+
+	if len(repo.saved) != 10 {
+		t.Fatalf("expected 10 moves saved but got %v", repo.saved)
+	}
+	for i, p1 := range repo.saved {
+		if p1 != strconv.Itoa(i) {
+			t.Fatalf("moves were saved out of order: %v", repo.saved)
+		}
+	}
+
+}
+
+func TestMatchesAreSpreadOverLanes(t *testing.T) {
+
+	md := newDealer(&StubRepo{}, testConfig.Dealer, testConfig.Board).(*MancalaDealer)
+
+	used := map[chan Move]bool{}
+	for i := 0; i < 100; i++ {
+		id := uuid.NewString()
+		if md.lane(id).moves != md.lane(id).moves {
+			t.Fatal("moves of a match should always take the same lane")
+		}
+		used[md.lane(id).moves] = true
+	}
 
-	validMove, _ := md.MakeMove(0, match, match.P1)
-	if validMove {
-		t.Fatal("no move should be made on a locked match")
+	if len(used) < 2 {
+		t.Fatal("matches should be spread over lanes")
 	}
 
 }
 
 func TestMoveFinishesOnOpponentsPit(t *testing.T) {
 
-	board := MancalaBoard{{0,0,0,0,0,3,0},{0,1,0,0,0,0,0}}
+	board := MancalaBoard{{0, 0, 0, 0, 0, 3, 0}, {0, 1, 0, 0, 0, 0, 0}}
 
 	p1Id := uuid.NewString()
 	match := Match{Id: uuid.NewString(), P1: p1Id, P2: uuid.NewString(), Turn: p1Id, Board: board}
 
-	move := Move {
-		pit: 5,
+	move := Move{
+		ctx:   context.Background(),
+		pit:   5,
 		match: match,
 	}
 
@@ -231,7 +712,7 @@ func TestMoveFinishesOnOpponentsPit(t *testing.T) {
 	if result.match.Board[1][1] != 2 {
 		t.Fatalf("expected board[1][1] == 2 but got:%v \n %v", result.match.Board[1][1], result.match.Board)
 	}
-	
+
 	if result.match.Board[0][5] != 0 {
 		t.Fatalf("expected board[0][5] == 0 but got:%v \n %v", result.match.Board[0][5], result.match.Board)
 	}
@@ -239,13 +720,14 @@ func TestMoveFinishesOnOpponentsPit(t *testing.T) {
 
 func TestMoveSkipsOpponentsBigPit(t *testing.T) {
 
-	board := MancalaBoard{{1,0,0,0,0,8,0},{1,0,0,0,0,0,0}}
+	board := MancalaBoard{{1, 0, 0, 0, 0, 8, 0}, {1, 0, 0, 0, 0, 0, 0}}
 
 	p1Id := uuid.NewString()
 	match := Match{Id: uuid.NewString(), P1: p1Id, P2: uuid.NewString(), Turn: p1Id, Board: board}
 
-	move := Move {
-		pit: 5,
+	move := Move{
+		ctx:   context.Background(),
+		pit:   5,
 		match: match,
 	}
 
@@ -254,18 +736,19 @@ func TestMoveSkipsOpponentsBigPit(t *testing.T) {
 	if result.match.Board[1][6] != 0 {
 		t.Fatalf("expected board[1][6] == 0 but got:%v \n %v", result.match.Board[1][6], result.match.Board)
 	}
-	
+
 }
 
 func TestMovePassTheBoarMoreThanOnce(t *testing.T) {
 
-	board := MancalaBoard{{0,0,0,0,0,14,0},{0,0,0,0,0,1,0}}
+	board := MancalaBoard{{0, 0, 0, 0, 0, 14, 0}, {0, 0, 0, 0, 0, 1, 0}}
 
 	p1Id := uuid.NewString()
 	match := Match{Id: uuid.NewString(), P1: p1Id, P2: uuid.NewString(), Turn: p1Id, Board: board}
 
-	move := Move {
-		pit: 5,
+	move := Move{
+		ctx:   context.Background(),
+		pit:   5,
 		match: match,
 	}
 
@@ -274,18 +757,19 @@ func TestMovePassTheBoarMoreThanOnce(t *testing.T) {
 	if result.match.Board[0][0] != 1 {
 		t.Fatalf("expected board[0][0] == 1 but got:%v \n %v", result.match.Board[0][0], result.match.Board)
 	}
-	
+
 }
 
 func TestMoveForP2(t *testing.T) {
 
-	board := MancalaBoard{{0,0,0,0,0,1,0},{5,0,0,0,0,1,5}}
+	board := MancalaBoard{{0, 0, 0, 0, 0, 1, 0}, {5, 0, 0, 0, 0, 1, 5}}
 
 	p2Id := uuid.NewString()
-	match := Match{Id: uuid.NewString(), P1: uuid.NewString(), P2: p2Id,  Turn: p2Id, Board: board}
+	match := Match{Id: uuid.NewString(), P1: uuid.NewString(), P2: p2Id, Turn: p2Id, Board: board}
 
-	move := Move {
-		pit: 5,
+	move := Move{
+		ctx:   context.Background(),
+		pit:   5,
 		match: match,
 	}
 
@@ -294,23 +778,24 @@ func TestMoveForP2(t *testing.T) {
 	if result.match.Board[1][6] != 6 {
 		t.Fatalf("expected board[1][6] == 6 but got:%v \n %v", result.match.Board[1][6], result.match.Board)
 	}
-	
+
 }
 
 func TestMoveFinishesOnPlayerBoarGetsAnotherTurn(t *testing.T) {
 
-	board := MancalaBoard{{0,0,0,0,1,1,0},{0,0,0,0,0,1,0}}
+	board := MancalaBoard{{0, 0, 0, 0, 1, 1, 0}, {0, 0, 0, 0, 0, 1, 0}}
 
 	p1Id := uuid.NewString()
 	match := Match{Id: uuid.NewString(), P1: p1Id, P2: uuid.NewString(), Turn: p1Id, Board: board}
 
-	move := Move {
-		pit: 4,
+	move := Move{
+		ctx:   context.Background(),
+		pit:   4,
 		match: match,
 	}
 
 	result := testMove(move)
-	
+
 	if result.match.Board[0][4] != 0 {
 		t.Fatalf("expected board[0][4] == 0 but got:%v \n %v", result.match.Board[0][4], result.match.Board)
 	}
@@ -331,18 +816,19 @@ func TestMoveFinishesOnPlayerBoarGetsAnotherTurn(t *testing.T) {
 
 func TestMoveFinishesOnPlayerEmptyPitAndCaptureStones(t *testing.T) {
 
-	board := MancalaBoard{{1,0,0,0,1,0,0},{0,0,0,0,1,10,0}}
+	board := MancalaBoard{{1, 0, 0, 0, 1, 0, 0}, {0, 0, 0, 0, 1, 10, 0}}
 
 	p1Id := uuid.NewString()
 	match := Match{Id: uuid.NewString(), P1: p1Id, P2: uuid.NewString(), Turn: p1Id, Board: board}
 
-	move := Move {
-		pit: 4,
+	move := Move{
+		ctx:   context.Background(),
+		pit:   4,
 		match: match,
 	}
 
 	result := testMove(move)
-	
+
 	if result.match.Board[0][5] != 0 {
 		t.Fatalf("expected board[0][5] == 0 but got:%v \n %v", result.match.Board[0][5], result.match.Board)
 	}
@@ -359,22 +845,22 @@ func TestMoveFinishesOnPlayerEmptyPitAndCaptureStones(t *testing.T) {
 
 func TestSavesMatchAfterMove(t *testing.T) {
 
-	var stubRepo  = &StubRepo{}
+	var stubRepo = &StubRepo{}
 	ch := make(chan Move, 10)
 	d := MancalaDealer{repo: stubRepo}
 
 	p1 := uuid.NewString()
-	match := Match{Id: uuid.NewString(), P1: p1, P2: uuid.NewString(), Turn: p1}
+	match := Match{Id: uuid.NewString(), P1: p1, P2: uuid.NewString(), Turn: p1, Board: newBoard()}
 
-	move := Move {
-		pit: 4,
+	move := Move{
+		ctx:   context.Background(),
+		pit:   4,
 		match: match,
 	}
 
 	ch <- move
 	close(ch)
 	handleMoveCompleted(&d, ch)
-	
 
 	if stubRepo.match == nil {
 		t.Fatalf("match was not saved")
@@ -383,15 +869,16 @@ func TestSavesMatchAfterMove(t *testing.T) {
 
 func TestChangeTurnsFromP1ToP2AfterMove(t *testing.T) {
 
-	var stubRepo  = &StubRepo{}
+	var stubRepo = &StubRepo{}
 	ch := make(chan Move, 10)
 	d := MancalaDealer{repo: stubRepo}
 
 	p1 := uuid.NewString()
-	match := Match{Id: uuid.NewString(), P1: p1, P2: uuid.NewString(), Turn: p1}
+	match := Match{Id: uuid.NewString(), P1: p1, P2: uuid.NewString(), Turn: p1, Board: newBoard()}
 
-	move := Move {
-		pit: 4,
+	move := Move{
+		ctx:   context.Background(),
+		pit:   4,
 		match: match,
 	}
 
@@ -404,17 +891,78 @@ func TestChangeTurnsFromP1ToP2AfterMove(t *testing.T) {
 	}
 }
 
+func TestNotifiesFinishedMatch(t *testing.T) {
+
+	var stubRepo = &StubRepo{}
+	ch := make(chan Move, 10)
+	d := MancalaDealer{repo: stubRepo}
+
+	finished := []Match{}
+	d.OnMatchFinished(func(ctx context.Context, m Match) {
+		finished = append(finished, m)
+	})
+
+	p1 := uuid.NewString()
+	ongoing := Match{Id: uuid.NewString(), P1: p1, P2: uuid.NewString(), Turn: p1, Board: newBoard()}
+	over := Match{Id: uuid.NewString(), P1: p1, P2: uuid.NewString(), Turn: p1, Board: MancalaBoard{{0, 0, 0, 0, 0, 0, 40}, {1, 0, 0, 0, 0, 0, 31}}}
+
+	ch <- Move{ctx: context.Background(), match: ongoing}
+	ch <- Move{ctx: context.Background(), match: over}
+	close(ch)
+	handleMoveCompleted(&d, ch)
+
+	if len(finished) != 1 || finished[0].Id != over.Id {
+		t.Fatalf("expected only match %v to finish but got %v", over.Id, finished)
+	}
+	if finished[0].FinishedAt == nil {
+		t.Fatal("the finished match should be timed")
+	}
+}
+
+func TestFirstMovesAreKeptAsOpenings(t *testing.T) {
+
+	p1 := uuid.NewString()
+	tests := []struct {
+		openings []int
+		pit      int
+		expected []int
+	}{
+		{nil, 2, []int{2}},
+		{[]int{2}, 4, []int{2, 4}},
+		{[]int{2, 4}, 1, []int{2, 4}},
+	}
+
+	for _, tt := range tests {
+		var stubRepo = &StubRepo{}
+		ch := make(chan Move, 1)
+		d := MancalaDealer{repo: stubRepo}
+
+		match := Match{Id: uuid.NewString(), P1: p1, P2: uuid.NewString(), Turn: p1, Board: newBoard(), Openings: tt.openings}
+		ch <- Move{ctx: context.Background(), pit: tt.pit, match: match}
+		close(ch)
+		handleMoveCompleted(&d, ch)
+
+		if !reflect.DeepEqual(stubRepo.match.Openings, tt.expected) {
+			t.Fatalf("expected openings %v after %v but got %v", tt.expected, tt.pit, stubRepo.match.Openings)
+		}
+		if stubRepo.match.LastMove.Pit != tt.pit {
+			t.Fatalf("expected the last move to be %v but got %v", tt.pit, stubRepo.match.LastMove)
+		}
+	}
+}
+
 func TestChangeTurnsFromP2ToP1AfterMove(t *testing.T) {
 
-	var stubRepo  = &StubRepo{}
+	var stubRepo = &StubRepo{}
 	ch := make(chan Move, 10)
 	d := MancalaDealer{repo: stubRepo}
 
 	p2 := uuid.NewString()
-	match := Match{Id: uuid.NewString(), P1: uuid.NewString(), P2: p2, Turn: p2}
+	match := Match{Id: uuid.NewString(), P1: uuid.NewString(), P2: p2, Turn: p2, Board: newBoard()}
 
-	move := Move {
-		pit: 4,
+	move := Move{
+		ctx:   context.Background(),
+		pit:   4,
 		match: match,
 	}
 
@@ -427,31 +975,88 @@ func TestChangeTurnsFromP2ToP1AfterMove(t *testing.T) {
 	}
 }
 
+// recordingRepo records P1 of every match saved.
+type recordingRepo struct {
+	StubRepo
+	saved []string
+}
+
+func (r *recordingRepo) Save(ctx context.Context, match *Match) error {
+	r.saved = append(r.saved, match.P1)
+	return nil
+}
 
-func testMove(m Move) (Move){
-	in := make(chan Move, 1)
+func TestRelayIsSownWithoutQueueingAgain(t *testing.T) {
+
+	// a worker queueing a relay in its own unbuffered lane would block
+	in := make(chan Move)
 	out := make(chan Move, 1)
+	d := MancalaDealer{repo: &StubRepo{}}
+	go handleMove(&d, lane{moves: in, completed: out})
 
-	var stubRepo  = &StubRepo{}
+	board := MancalaBoard{{1, 1, 0, 0, 0, 0, 0}, {1, 0, 0, 0, 0, 0, 0}}
+	p1Id := uuid.NewString()
+	in <- Move{ctx: context.Background(), pit: 0, match: Match{Id: uuid.NewString(), P1: p1Id, Turn: p1Id, Board: board}}
+
+	select {
+	case m := <-out:
+		if m.match.Board[0][1] != 0 || m.match.Board[0][2] != 1 {
+			t.Fatalf("the relay should be sown but got %v", m.match.Board)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the relay was not sown")
+	}
+	close(in)
+
+}
 
-	d := MancalaDealer{repo: stubRepo, moveInCh: in}
+func TestIllegalMoveIsDropped(t *testing.T) {
 
+	stubRepo := &StubRepo{}
+	in := make(chan Move, 1)
+	out := make(chan Move, 1)
+	d := MancalaDealer{repo: stubRepo}
+	d.pending.Add(1)
+
+	p1Id := uuid.NewString()
+	board := MancalaBoard{{0, 1, 0, 0, 0, 0, 0}, {1, 0, 0, 0, 0, 0, 0}}
+	m := Move{ctx: context.Background(), pit: 0, match: Match{Id: uuid.NewString(), P1: p1Id, Turn: p1Id, Board: board}, lock: "token"}
 	in <- m
-	go handleMove(&d, out)
+	close(in)
+	handleMove(&d, lane{moves: in, completed: out})
+
+	if len(out) != 0 || d.pending.Load() != 0 {
+		t.Fatal("a move from an empty pit should not be saved")
+	}
+	if stubRepo.unlocked != m.lock {
+		t.Fatal("the match of a dropped move should be unlocked")
+	}
 
-	return <- out 
 }
 
+func testMove(m Move) Move {
+	in := make(chan Move, 1)
+	out := make(chan Move, 1)
+
+	var stubRepo = &StubRepo{}
 
-func (r *StubRepo) Get(id string) (*Match, error) {
-	if r.match.Id == id {
+	d := MancalaDealer{repo: stubRepo}
+
+	in <- m
+	go handleMove(&d, lane{moves: in, completed: out})
+
+	return <-out
+}
+
+func (r *StubRepo) Get(ctx context.Context, id string) (*Match, error) {
+	if r.match != nil && r.match.Id == id {
 		return r.match, nil
 	}
 
-	return nil, errors.New("unnable to get match")
+	return nil, ErrMatchNotFound
 }
 
-func (r *StubRepo) GetWaitingMatch() (*Match, error) {
+func (r *StubRepo) GetWaitingMatch(ctx context.Context) (*Match, error) {
 	if r.waitingMatch != nil {
 		m := r.waitingMatch
 		r.waitingMatch = nil
@@ -461,20 +1066,56 @@ func (r *StubRepo) GetWaitingMatch() (*Match, error) {
 	return nil, errors.New("unnable to get match")
 }
 
-func (r *StubRepo) AddWaitingMatch(match *Match) {
+func (r *StubRepo) AddWaitingMatch(ctx context.Context, match *Match) error {
 	r.waitingMatch = match
+	return nil
 }
 
-func (r *StubRepo) Save(match *Match) {
+func (r *StubRepo) Save(ctx context.Context, match *Match) error {
+	if r.saveErr != nil {
+		return r.saveErr
+	}
 	r.match = match
+	return nil
 }
 
 var lockedMatchId = uuid.NewString()
 
-func (r *StubRepo) Lock(id string) error {
+func (r *StubRepo) Lock(ctx context.Context, id string) (string, error) {
+	if r.lockErr != nil {
+		return "", r.lockErr
+	}
 	if lockedMatchId == id {
-		return errors.New("already locked")
+		return "", ErrMatchLocked
+	}
+
+	return "token-" + id, nil
+}
+
+func (r *StubRepo) ExtendLock(ctx context.Context, id string, token string) error {
+	if r.lockLost {
+		return ErrLockLost
+	}
+	return nil
+}
+
+func (r *StubRepo) Unlock(ctx context.Context, id string, token string) error {
+	r.unlocked = token
+	return nil
+}
+
+func (r *StubRepo) GetRematch(ctx context.Context, matchId string) (*Rematch, error) {
+	if r.rematch != nil && r.rematch.MatchId == matchId {
+		return r.rematch, nil
 	}
+	return nil, nil
+}
 
+func (r *StubRepo) SaveRematch(ctx context.Context, rematch *Rematch) error {
+	r.rematch = rematch
 	return nil
 }
+
+func (r *StubRepo) Ping(ctx context.Context) error {
+	return r.pingErr
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+var (
+	errMissingPlayer   = errors.New("not your match")
+	errInvalidRequest  = errors.New("invalid request")
+	errUnknownOpponent = errors.New("unknown opponent")
+	errNoBot           = errors.New("no bot available")
+)
+
+// ErrorMessage is the body of every error response. Code is meant for
+// programs and does not change, Message for people.
+type ErrorMessage struct {
+	Code    string                 `json:"code"`
+	Message string                 `json:"message"`
+	Details map[string]interface{} `json:"details,omitempty"`
+	// Deprecated: the message, read by clients of the original API.
+	LegacyMessage string `json:"error"`
+}
+
+// apiError is how the API answers an error and the errors wrapping it.
+type apiError struct {
+	err    error
+	status int
+	code   string
+}
+
+var apiErrors = []apiError{
+	{errMissingPlayer, http.StatusUnauthorized, "unauthorized"},
+	{errInvalidRequest, http.StatusBadRequest, "invalid_request"},
+	{errUnknownOpponent, http.StatusBadRequest, "unknown_opponent"},
+	{errNoBot, http.StatusNotFound, "bot_unavailable"},
+
+	{ErrMatchNotFound, http.StatusNotFound, "match_not_found"},
+	{ErrNotParticipant, http.StatusForbidden, "not_participant"},
+	{ErrInvalidPit, http.StatusBadRequest, "pit_out_of_range"},
+	{ErrPitEmpty, http.StatusUnprocessableEntity, "pit_empty"},
+	{ErrNotYourTurn, http.StatusConflict, "not_your_turn"},
+	{ErrMatchFinished, http.StatusConflict, "match_finished"},
+	{ErrMatchNotStarted, http.StatusConflict, "match_not_started"},
+	{ErrMoveConflict, http.StatusConflict, "conflict"},
+	{ErrMatchNotOver, http.StatusConflict, "match_not_over"},
+	{ErrRematchConflict, http.StatusConflict, "conflict"},
+	{ErrDealerClosed, http.StatusServiceUnavailable, "shutting_down"},
+	{ErrQueueFull, http.StatusServiceUnavailable, "queue_full"},
+
+	{ErrTournamentNotFound, http.StatusNotFound, "tournament_not_found"},
+	{ErrInvalidFormat, http.StatusBadRequest, "invalid_format"},
+	{ErrInvalidRounds, http.StatusBadRequest, "invalid_rounds"},
+	{ErrRegistrationClosed, http.StatusConflict, "registration_closed"},
+	{ErrNotEnoughPlayers, http.StatusConflict, "not_enough_players"},
+
+	{ErrSeriesNotFound, http.StatusNotFound, "series_not_found"},
+	{ErrInvalidBestOf, http.StatusBadRequest, "invalid_best_of"},
+	{ErrSeriesFull, http.StatusConflict, "series_full"},
+
+	{ErrPlayerNotFound, http.StatusNotFound, "player_not_found"},
+	{ErrLeaderboardNotFound, http.StatusNotFound, "leaderboard_not_found"},
+	{ErrInvalidPeriod, http.StatusBadRequest, "invalid_period"},
+
+	{context.DeadlineExceeded, http.StatusGatewayTimeout, "timeout"},
+	{context.Canceled, http.StatusGatewayTimeout, "timeout"},
+}
+
+var internalError = apiError{errors.New("internal server error"), http.StatusInternalServerError, "internal"}
+
+// findAPIError returns how to answer err, 500 if the API does not know it.
+func findAPIError(err error) apiError {
+	for _, e := range apiErrors {
+		if errors.Is(err, e.err) {
+			return e
+		}
+	}
+	return internalError
+}
+
+// writeError answers err with its status and code. The message is the one
+// of the error the API knows, so wrapped causes are only logged.
+func writeError(ctx context.Context, err error, details map[string]interface{}, w http.ResponseWriter) {
+	e := findAPIError(err)
+	if e.status >= http.StatusInternalServerError && e.status != http.StatusGatewayTimeout {
+		logger(ctx).Error("request failed", "code", e.code, "error", err)
+	} else {
+		logger(ctx).Warn("request rejected", "code", e.code, "error", err)
+	}
+
+	msg := e.err.Error()
+	if e.code == "timeout" {
+		msg = "request timed out"
+	}
+
+	bs, _ := json.Marshal(ErrorMessage{Code: e.code, Message: msg, Details: details, LegacyMessage: msg})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(e.status)
+	w.Write(bs)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWriteErrorFindsWrappedErrors(t *testing.T) {
+	w := httptest.NewRecorder()
+	err := fmt.Errorf("unnable to get match: %w", ErrMatchNotFound)
+	writeError(context.Background(), err, map[string]interface{}{"match": "a-match"}, w)
+
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 but got %v", w.Code)
+	}
+
+	body := ErrorMessage{}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if body.Code != "match_not_found" || body.Message != ErrMatchNotFound.Error() || body.Details["match"] != "a-match" {
+		t.Fatalf("wrong error body: %v", w.Body.String())
+	}
+}
+
+func TestWriteErrorHidesUnknownErrors(t *testing.T) {
+	w := httptest.NewRecorder()
+	writeError(context.Background(), errors.New("dial tcp 10.0.0.1:6379: connection refused"), nil, w)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500 but got %v", w.Code)
+	}
+
+	body := ErrorMessage{}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if body.Code != "internal" || body.Message != "internal server error" {
+		t.Fatalf("wrong error body: %v", w.Body.String())
+	}
+}
+
+func TestErrorCodesAreUnique(t *testing.T) {
+	statuses := map[string]int{}
+	for _, e := range apiErrors {
+		if s, ok := statuses[e.code]; ok && s != e.status {
+			t.Fatalf("code %v is used with statuses %v and %v", e.code, s, e.status)
+		}
+		statuses[e.code] = e.status
+		if findAPIError(e.err).code != e.code {
+			t.Fatalf("%v is shadowed by an earlier error", e.err)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/dacruz/mancala/game"
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	// proxies close connections that stay silent for too long
+	streamKeepAlive time.Duration = 15 * time.Second
+)
+
+// matchEvents streams the match to the player as server-sent events: a
+// match event with the MatchResponse every time the match changes. The
+// stream ends once the match is over.
+//
+// Moves may be saved by any replica, so the match is read again every
+// stream interval rather than waiting to be told it changed.
+func (h Handler) matchEvents(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	defer handle5xx(r.Context(), w)
+
+	matchId := ps.ByName("matchId")
+	ctx := withLogFields(r.Context(), "match_id", matchId)
+
+	playerId, err := player(r, w)
+	if err != nil {
+		writeError(ctx, err, nil, w)
+		return
+	}
+	ctx = withLogFields(ctx, "player_id", playerId)
+
+	response, err := h.matchResponse(ctx, matchId, playerId)
+	if err != nil {
+		writeError(ctx, err, map[string]interface{}{"match": matchId}, w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(w)
+
+	ticker := time.NewTicker(h.streamInterval)
+	defer ticker.Stop()
+
+	var sent []byte
+	lastWrite := time.Time{}
+	for {
+		bs, _ := json.Marshal(response)
+		if !bytes.Equal(bs, sent) {
+			fmt.Fprintf(w, "event: match\ndata: %s\n\n", bs)
+			sent, lastWrite = bs, time.Now()
+		} else if time.Since(lastWrite) > streamKeepAlive {
+			fmt.Fprint(w, ": keep-alive\n\n")
+			lastWrite = time.Now()
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+
+		if game.Over(game.Board(response.Board)) {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-h.stopping:
+			return
+		case <-ticker.C:
+		}
+
+		response, err = h.matchResponse(ctx, matchId, playerId)
+		if err != nil {
+			// the client gets the error when it connects again
+			logger(ctx).Warn("match stream ended", "error", err)
+			return
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dacruz/mancala/client"
+)
+
+// newStreamServer serves a real dealer on an in-memory repository.
+func newStreamServer() (*http.Server, *httptest.Server, *memoryRepo) {
+	repo := newMemoryRepo()
+	c := testConfig.Server
+	c.StreamInterval = 5 * time.Millisecond
+
+	srv := newServer(c, newDealer(repo, testConfig.Dealer, testConfig.Board), nil, &StubOrganizer{}, &StubScorekeeper{}, &StubReferee{})
+	return srv, httptest.NewServer(srv.Handler), repo
+}
+
+// newPlayerClient plays as playerId.
+func newPlayerClient(serverURL string, playerId string, t *testing.T) *client.Client {
+	u, _ := url.Parse(serverURL)
+	jar, _ := cookiejar.New(nil)
+	jar.SetCookies(u, []*http.Cookie{{Name: playerCookieConst, Value: playerId, Path: "/"}})
+
+	c, err := client.NewWithHTTPClient(serverURL, &http.Client{Jar: jar})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	return c
+}
+
+func TestMatchEventsFollowTheMatchUntilItIsOver(t *testing.T) {
+	_, s, repo := newStreamServer()
+	defer s.Close()
+
+	m := Match{Id: "m", P1: "p1", P2: "p2", Turn: "p1", Board: MancalaBoard{{0, 0, 0, 0, 0, 1, 0}, {1, 0, 0, 0, 0, 0, 0}}}
+	repo.Save(context.Background(), &m)
+
+	p1 := newPlayerClient(s.URL, "p1", t)
+	p2 := newPlayerClient(s.URL, "p2", t)
+
+	events := make(chan *client.Match, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- p2.Watch(context.Background(), "m", func(m *client.Match) error {
+			events <- m
+			return nil
+		})
+	}()
+
+	first := <-events
+	if first.MyTurn || first.LastMove != nil || !reflect.DeepEqual(first.Board[1], []int{0, 0, 0, 0, 0, 1, 0}) {
+		t.Fatalf("expected the match as P2 sees it, got %+v", first)
+	}
+
+	if _, err := p1.Move(context.Background(), "m", 5); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the stream should end with the match")
+	}
+
+	last := <-events
+	if last.LastMove == nil || last.LastMove.Pit != 5 || last.LastMove.Mine {
+		t.Fatalf("expected the opponent's move in the last event, got %+v", last.LastMove)
+	}
+	if last.Board[1][6] != 1 {
+		t.Fatalf("expected the move to be sown, got %v", last.Board)
+	}
+}
+
+func TestMatchEventsOfOtherPlayers(t *testing.T) {
+	_, s, repo := newStreamServer()
+	defer s.Close()
+
+	m := Match{Id: "m", P1: "p1", P2: "p2", Turn: "p1", Board: MancalaBoard(newBoard())}
+	repo.Save(context.Background(), &m)
+
+	err := newPlayerClient(s.URL, "p3", t).Watch(context.Background(), "m", func(m *client.Match) error { return nil })
+
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusForbidden || apiErr.Code != "not_participant" {
+		t.Fatalf("expected 403 not_participant but got %v", err)
+	}
+}
+
+func TestMatchEventsEndOnShutdown(t *testing.T) {
+	srv, s, repo := newStreamServer()
+	defer s.Close()
+
+	m := Match{Id: "m", P1: "p1", P2: "p2", Turn: "p1", Board: MancalaBoard(newBoard())}
+	repo.Save(context.Background(), &m)
+
+	watching := make(chan bool, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- newPlayerClient(s.URL, "p1", t).Watch(context.Background(), "m", func(m *client.Match) error {
+			watching <- true
+			return nil
+		})
+	}()
+	<-watching
+
+	srv.Shutdown(context.Background())
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the stream should end on shutdown")
+	}
+}
@@ -0,0 +1,168 @@
+// Package game implements the mancala rules used by the server.
+//
+// A Board has one row per player. Each row holds Pits pits followed by the
+// player's big pit (the store) at index Store.
+//
+// Most functions here work on a linear board seen from the player that is
+// moving: the player's pits and store first, then the opponent's pits and
+// store. Sowing never drops a stone in the opponent's store.
+package game
+
+import (
+	"errors"
+)
+
+const (
+	Pits   int = 6
+	Stones int = 6
+	Store  int = Pits
+
+	// relay sowing can, in theory, go around the board forever
+	maxLaps int = 1000
+)
+
+var (
+	ErrInvalidPit = errors.New("invalid pit number")
+	ErrEmptyPit   = errors.New("pit is empty")
+	ErrEndless    = errors.New("move does not end")
+)
+
+type Board [][]int
+
+func NewBoard() Board {
+	return NewBoardOf(Stones)
+}
+
+// NewBoardOf returns a board with stones in every pit.
+func NewBoardOf(stones int) Board {
+	b := make(Board, 2)
+	for i := 0; i < Pits; i++ {
+		b[0] = append(b[0], stones)
+		b[1] = append(b[1], stones)
+	}
+
+	b[0] = append(b[0], 0)
+	b[1] = append(b[1], 0)
+
+	return b
+}
+
+func (b Board) Copy() Board {
+	return Board{append([]int{}, b[0]...), append([]int{}, b[1]...)}
+}
+
+// Linear returns a copy of the board as seen by side.
+func Linear(b Board, side int) []int {
+	l := make([]int, 0, 2*(Pits+1))
+	l = append(l, b[side]...)
+	return append(l, b[1-side]...)
+}
+
+// FromLinear is the inverse of Linear.
+func FromLinear(l []int, side int) Board {
+	b := make(Board, 2)
+	b[side] = l[:Pits+1]
+	b[1-side] = l[Pits+1:]
+	return b
+}
+
+// Sow empties pit and drops its stones one by one on the following pits.
+// It returns the index where the last stone landed.
+func Sow(l []int, pit int) int {
+	stones := l[pit]
+	l[pit] = 0
+
+	i := pit
+	for ; stones > 0; stones-- {
+		i = (i + 1) % (len(l) - 1)
+		l[i] += 1
+	}
+	return i
+}
+
+func EndsOnMySide(i int) bool {
+	return i < Pits
+}
+
+// WasEmpty tells if the pit was empty before the last stone landed on it.
+func WasEmpty(stones int) bool {
+	return stones == 1
+}
+
+// Relay tells if sowing goes on from the pit where the last stone landed.
+func Relay(stones int) bool {
+	return stones > 1
+}
+
+// Capture moves the stones of pit i and of the opponent's pit with the same
+// number to the player's store.
+func Capture(i int, l []int) {
+	l[i] = 0
+	opponentStone := l[i+Pits+1]
+	l[i+Pits+1] = 0
+	l[Store] += opponentStone + 1
+}
+
+// Play makes a complete move for side, relay sowing included, and returns
+// the resulting board. b is left untouched.
+func Play(b Board, side int, pit int) (Board, error) {
+	if 0 > pit || pit >= Pits {
+		return nil, ErrInvalidPit
+	}
+
+	if b[side][pit] == 0 {
+		return nil, ErrEmptyPit
+	}
+
+	l := Linear(b, side)
+	for lap := 0; lap < maxLaps; lap++ {
+		last := Sow(l, pit)
+		if !EndsOnMySide(last) || !Relay(l[last]) {
+			if EndsOnMySide(last) && WasEmpty(l[last]) {
+				Capture(last, l)
+			}
+			return FromLinear(l, side), nil
+		}
+		pit = last
+	}
+
+	return nil, ErrEndless
+}
+
+func LegalMoves(b Board, side int) []int {
+	moves := []int{}
+	if Over(b) {
+		return moves
+	}
+
+	for i := 0; i < Pits; i++ {
+		if b[side][i] > 0 {
+			moves = append(moves, i)
+		}
+	}
+	return moves
+}
+
+// Over tells if one of the players has no stones left in their pits.
+func Over(b Board) bool {
+	return sideIsEmpty(b[0]) || sideIsEmpty(b[1])
+}
+
+// Score counts the stones of side: the store plus whatever is still left
+// in the side's pits.
+func Score(b Board, side int) int {
+	score := 0
+	for _, s := range b[side] {
+		score += s
+	}
+	return score
+}
+
+func sideIsEmpty(pits []int) bool {
+	for i := 0; i < Pits; i++ {
+		if pits[i] != 0 {
+			return false
+		}
+	}
+	return true
+}
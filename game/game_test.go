@@ -0,0 +1,124 @@
+package game
+
+import (
+	"testing"
+)
+
+func TestPlayDoesNotChangeBoard(t *testing.T) {
+	b := NewBoard()
+
+	if _, err := Play(b, 0, 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if b[0][0] != Stones {
+		t.Fatalf("original board changed: %v", b)
+	}
+}
+
+func TestNewBoardOf(t *testing.T) {
+	b := NewBoardOf(4)
+
+	if b[0][0] != 4 || b[1][Pits-1] != 4 || b[0][Store] != 0 || b[1][Store] != 0 {
+		t.Fatalf("expected 4 stones per pit and empty stores but got %v", b)
+	}
+}
+
+func TestPlaySkipsOpponentsStore(t *testing.T) {
+	b := Board{{1, 0, 0, 0, 0, 8, 0}, {1, 0, 0, 0, 0, 0, 0}}
+
+	result, _ := Play(b, 0, 5)
+
+	if result[1][Store] != 0 {
+		t.Fatalf("expected board[1][6] == 0 but got:%v \n %v", result[1][Store], result)
+	}
+}
+
+func TestPlayRelaysFromNonEmptyPit(t *testing.T) {
+	b := Board{{0, 0, 0, 0, 1, 1, 0}, {0, 0, 0, 0, 0, 1, 0}}
+
+	result, _ := Play(b, 0, 4)
+
+	expected := Board{{0, 0, 0, 0, 0, 0, 1}, {1, 0, 0, 0, 0, 1, 0}}
+	assertBoard(expected, result, t)
+}
+
+func TestPlayCaptures(t *testing.T) {
+	b := Board{{1, 0, 0, 0, 1, 0, 0}, {0, 0, 0, 0, 1, 10, 0}}
+
+	result, _ := Play(b, 0, 4)
+
+	expected := Board{{1, 0, 0, 0, 0, 0, 11}, {0, 0, 0, 0, 1, 0, 0}}
+	assertBoard(expected, result, t)
+}
+
+func TestPlayForP2(t *testing.T) {
+	b := Board{{0, 0, 0, 0, 0, 1, 0}, {5, 0, 0, 0, 0, 1, 5}}
+
+	result, _ := Play(b, 1, 5)
+
+	expected := Board{{0, 0, 0, 0, 0, 1, 0}, {5, 0, 0, 0, 0, 0, 6}}
+	assertBoard(expected, result, t)
+}
+
+func TestPlayInvalidPit(t *testing.T) {
+	b := NewBoard()
+
+	for _, pit := range []int{-1, Pits, Store + 1} {
+		if _, err := Play(b, 0, pit); err != ErrInvalidPit {
+			t.Fatalf("pit %v should not be valid, got %v", pit, err)
+		}
+	}
+}
+
+func TestPlayEmptyPit(t *testing.T) {
+	b := Board{{0, 1, 0, 0, 0, 0, 0}, {1, 0, 0, 0, 0, 0, 0}}
+
+	if _, err := Play(b, 0, 0); err != ErrEmptyPit {
+		t.Fatalf("expected ErrEmptyPit but got %v", err)
+	}
+}
+
+func TestLegalMoves(t *testing.T) {
+	b := Board{{0, 1, 0, 3, 0, 0, 9}, {1, 0, 0, 0, 0, 0, 0}}
+
+	moves := LegalMoves(b, 0)
+	if len(moves) != 2 || moves[0] != 1 || moves[1] != 3 {
+		t.Fatalf("expected [1 3] but got %v", moves)
+	}
+}
+
+func TestNoLegalMovesWhenOver(t *testing.T) {
+	b := Board{{0, 1, 0, 3, 0, 0, 9}, {0, 0, 0, 0, 0, 0, 1}}
+
+	if !Over(b) {
+		t.Fatal("game should be over")
+	}
+
+	if moves := LegalMoves(b, 0); len(moves) != 0 {
+		t.Fatalf("expected no moves but got %v", moves)
+	}
+}
+
+func TestScoreCountsRemainingStones(t *testing.T) {
+	b := Board{{0, 1, 0, 3, 0, 0, 9}, {0, 0, 0, 0, 0, 0, 1}}
+
+	if Score(b, 0) != 13 {
+		t.Fatalf("expected 13 but got %v", Score(b, 0))
+	}
+
+	if Score(b, 1) != 1 {
+		t.Fatalf("expected 1 but got %v", Score(b, 1))
+	}
+}
+
+func assertBoard(expected Board, actual Board, t *testing.T) {
+	t.Helper()
+	for side := range expected {
+		for i := range expected[side] {
+			if expected[side][i] != actual[side][i] {
+				t.Fatalf("expected %v but got %v", expected, actual)
+			}
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	RatingLeaderboard = "rating"
+	WinsLeaderboard   = "wins"
+
+	AllTimePeriod = "all"
+	MonthPeriod   = "month"
+	WeekPeriod    = "week"
+
+	// Variant of the leaderboards of every variant
+	allVariants = 0
+)
+
+var (
+	ErrLeaderboardNotFound = errors.New("leaderboard not found")
+	ErrInvalidPeriod       = errors.New("invalid leaderboard period")
+)
+
+// Leaderboard names one ranking. Variant is the stones per pit matches
+// start with, allVariants for all of them. Window is the month or ISO week
+// of the period, and AllTimePeriod for all-time leaderboards.
+type Leaderboard struct {
+	By      string
+	Variant int
+	Window  string
+}
+
+type LeaderboardEntry struct {
+	Rank  int
+	Alias string
+	Score int
+}
+
+// newLeaderboard returns the leaderboard of the period holding t.
+func newLeaderboard(by string, variant int, period string, t time.Time) (Leaderboard, error) {
+	switch by {
+	case RatingLeaderboard, WinsLeaderboard:
+	default:
+		return Leaderboard{}, ErrLeaderboardNotFound
+	}
+
+	window, err := window(period, t)
+	return Leaderboard{By: by, Variant: variant, Window: window}, err
+}
+
+func window(period string, t time.Time) (string, error) {
+	t = t.UTC()
+	switch period {
+	case AllTimePeriod:
+		return AllTimePeriod, nil
+	case MonthPeriod:
+		return t.Format("2006-01"), nil
+	case WeekPeriod:
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week), nil
+	}
+	return "", ErrInvalidPeriod
+}
+
+// matchLeaderboards are the leaderboards a match finished at t counts in:
+// every period, of all variants and of its own.
+func matchLeaderboards(by string, m Match, t time.Time) []Leaderboard {
+	variants := []int{allVariants}
+	if m.Stones > 0 {
+		variants = append(variants, m.Stones)
+	}
+
+	boards := []Leaderboard{}
+	for _, v := range variants {
+		for _, p := range []string{AllTimePeriod, MonthPeriod, WeekPeriod} {
+			b, _ := newLeaderboard(by, v, p, t)
+			boards = append(boards, b)
+		}
+	}
+	return boards
+}
+
+// alias stands for a player on leaderboards. Player ids are also their
+// credentials, so they are not shown to others.
+func alias(playerId string) string {
+	sum := sha256.Sum256([]byte(playerId))
+	return hex.EncodeToString(sum[:8])
+}
+
+// updateLeaderboards sets the ratings of both players after m and counts
+// the win, if there is one. Players that did not win are listed in the
+// wins leaderboards too.
+func (s *MancalaScorekeeper) updateLeaderboards(ctx context.Context, m Match) error {
+	for _, b := range matchLeaderboards(RatingLeaderboard, m, *m.FinishedAt) {
+		for side, playerId := range []string{m.P1, m.P2} {
+			if err := s.repo.SetLeaderboardScore(ctx, b, alias(playerId), m.Ratings[side]); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, b := range matchLeaderboards(WinsLeaderboard, m, *m.FinishedAt) {
+		for side, playerId := range []string{m.P1, m.P2} {
+			wins := 0
+			if result(m.Board, side) == 1 {
+				wins = 1
+			}
+			if err := s.repo.AddLeaderboardScore(ctx, b, alias(playerId), wins); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *MancalaScorekeeper) GetLeaderboard(ctx context.Context, b Leaderboard, offset int, limit int) ([]LeaderboardEntry, int, error) {
+	return s.repo.GetLeaderboard(ctx, b, offset, limit)
+}
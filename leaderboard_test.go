@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testLeaderboards are the all-time leaderboards served by StubScorekeeper.
+var testLeaderboards = map[Leaderboard]map[string]int{
+	{By: WinsLeaderboard, Variant: allVariants, Window: AllTimePeriod}: {"a1": 5, "a2": 3, "a3": 0},
+	{By: RatingLeaderboard, Variant: 4, Window: AllTimePeriod}:         {"a1": 1540},
+}
+
+func TestNewLeaderboard(t *testing.T) {
+	tests := []struct {
+		period   string
+		at       time.Time
+		expected string
+	}{
+		{AllTimePeriod, time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC), "all"},
+		{MonthPeriod, time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC), "2026-10"},
+		{WeekPeriod, time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC), "2026-W43"},
+		// ISO weeks can belong to the year before
+		{WeekPeriod, time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC), "2020-W53"},
+		// windows follow UTC
+		{MonthPeriod, time.Date(2026, 11, 1, 0, 30, 0, 0, time.FixedZone("CET", 3600)), "2026-10"},
+	}
+	for _, tt := range tests {
+		b, err := newLeaderboard(WinsLeaderboard, allVariants, tt.period, tt.at)
+		if err != nil || b.Window != tt.expected {
+			t.Fatalf("%v of %v: expected %v but got %v, %v", tt.period, tt.at, tt.expected, b.Window, err)
+		}
+	}
+
+	if _, err := newLeaderboard("losses", allVariants, AllTimePeriod, time.Now()); err != ErrLeaderboardNotFound {
+		t.Fatalf("expected ErrLeaderboardNotFound but got %v", err)
+	}
+	if _, err := newLeaderboard(WinsLeaderboard, allVariants, "year", time.Now()); err != ErrInvalidPeriod {
+		t.Fatalf("expected ErrInvalidPeriod but got %v", err)
+	}
+}
+
+func TestMatchFinishedUpdatesLeaderboards(t *testing.T) {
+	repo := &StubPlayerRepo{}
+	k := newScorekeeper(repo)
+
+	m := finishedMatch("p1", "p2", MancalaBoard{{0, 0, 0, 0, 0, 0, 40}, {0, 0, 0, 0, 0, 1, 31}}, nil, nil)
+	m.Stones = 4
+	k.MatchFinished(context.Background(), m)
+
+	// all-time, monthly and weekly, of all variants and of 4 stones
+	if len(repo.leaderboards) != 12 {
+		t.Fatalf("expected 12 leaderboards but got %v", repo.leaderboards)
+	}
+	wins := Leaderboard{By: WinsLeaderboard, Variant: allVariants, Window: "2020-W01"}
+	if !reflect.DeepEqual(repo.leaderboards[wins], map[string]int{alias("p1"): 1, alias("p2"): 0}) {
+		t.Fatalf("expected the win of p1 and p2 without wins, got %v", repo.leaderboards[wins])
+	}
+	rating := Leaderboard{By: RatingLeaderboard, Variant: 4, Window: "2020-01"}
+	if !reflect.DeepEqual(repo.leaderboards[rating], map[string]int{alias("p1"): 1516, alias("p2"): 1484}) {
+		t.Fatalf("expected the new ratings but got %v", repo.leaderboards[rating])
+	}
+}
+
+func TestGetLeaderboard(t *testing.T) {
+	res := execute2xxRequest("GET", "http://localhost:8080/api/v1/leaderboards/wins?offset=1&limit=1", t)
+
+	board := LeaderboardResponse{}
+	if err := json.NewDecoder(res.Body).Decode(&board); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	expected := LeaderboardResponse{
+		By:      WinsLeaderboard,
+		Period:  AllTimePeriod,
+		Window:  AllTimePeriod,
+		Entries: []LeaderboardEntryResponse{{Rank: 2, Player: "a2", Score: 3}},
+		Total:   3,
+		Offset:  1,
+		Limit:   1,
+	}
+	if !reflect.DeepEqual(board, expected) {
+		t.Fatalf("expected %+v but got %+v", expected, board)
+	}
+}
+
+func TestGetLeaderboardOfVariant(t *testing.T) {
+	res := execute2xxRequest("GET", "http://localhost:8080/api/v1/leaderboards/rating?variant=4", t)
+
+	board := LeaderboardResponse{}
+	if err := json.NewDecoder(res.Body).Decode(&board); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	if board.Variant == nil || *board.Variant != 4 || board.Total != 1 || board.Entries[0].Score != 1540 {
+		t.Fatalf("expected the rating of a1 with 4 stones but got %+v", board)
+	}
+}
+
+func TestGetMonthlyLeaderboardOfAnotherDate(t *testing.T) {
+	res := execute2xxRequest("GET", "http://localhost:8080/api/v1/leaderboards/wins?period=month&date=2026-09-30", t)
+
+	board := LeaderboardResponse{}
+	if err := json.NewDecoder(res.Body).Decode(&board); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	if board.Window != "2026-09" || board.Total != 0 || len(board.Entries) != 0 {
+		t.Fatalf("expected the empty leaderboard of September but got %+v", board)
+	}
+}
+
+func TestGetLeaderboardWithInvalidQuery(t *testing.T) {
+	tests := []struct {
+		path   string
+		status int
+		code   string
+	}{
+		{"losses", http.StatusNotFound, "leaderboard_not_found"},
+		{"wins?period=year", http.StatusBadRequest, "invalid_period"},
+		{"wins?variant=0", http.StatusBadRequest, "invalid_request"},
+		{"wins?date=19-10-2026", http.StatusBadRequest, "invalid_request"},
+		{"wins?limit=101", http.StatusBadRequest, "invalid_request"},
+	}
+	for _, tt := range tests {
+		res, err := http.Get("http://localhost:8080/api/v1/leaderboards/" + tt.path)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		e := ErrorMessage{}
+		json.NewDecoder(res.Body).Decode(&e)
+		res.Body.Close()
+
+		if res.StatusCode != tt.status || e.Code != tt.code {
+			t.Fatalf("%v: expected %v %v but got %v %+v", tt.path, tt.status, tt.code, res.StatusCode, e)
+		}
+	}
+}
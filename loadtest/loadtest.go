@@ -0,0 +1,246 @@
+// Package loadtest plays many concurrent games against a mancala server
+// through its HTTP API and measures how it copes.
+//
+// Every player joins a match, waits to be paired, and plays random legal
+// moves until the match is over, then joins the next one.
+package loadtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dacruz/mancala/client"
+	"github.com/dacruz/mancala/game"
+)
+
+// Operations timed by a run.
+const (
+	OpJoin = "join"
+	OpGet  = "get"
+	OpMove = "move"
+)
+
+type Config struct {
+	URL string
+	// players playing at the same time
+	Players int
+	// games each player plays, 0 to play until Duration is over
+	Games    int
+	Duration time.Duration
+	// how often players look at their match
+	PollInterval time.Duration
+	// a match whose board does not change for this long is given up on
+	StuckAfter time.Duration
+	Seed       int64
+	// used by every player, a default one is made if nil
+	HTTPClient *http.Client
+}
+
+// matchState is what players saw happen to a match.
+type matchState int
+
+const (
+	started matchState = iota
+	finished
+	stuck
+	unpaired
+)
+
+type run struct {
+	config Config
+	stats  *stats
+
+	matches    map[string]matchState
+	matchesMut sync.Mutex
+}
+
+// Run plays until every player played its games, Duration is over or ctx
+// is done.
+func Run(ctx context.Context, c Config) (Report, error) {
+	if c.URL == "" || c.Players < 1 {
+		return Report{}, errors.New("loadtest: a URL and at least one player are needed")
+	}
+	if c.Games == 0 && c.Duration == 0 {
+		return Report{}, errors.New("loadtest: games or a duration are needed")
+	}
+	if c.PollInterval == 0 {
+		c.PollInterval = 100 * time.Millisecond
+	}
+	if c.StuckAfter == 0 {
+		c.StuckAfter = 30 * time.Second
+	}
+	if c.HTTPClient == nil {
+		c.HTTPClient = &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: &http.Transport{MaxIdleConnsPerHost: c.Players},
+		}
+	}
+
+	if c.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Duration)
+		defer cancel()
+	}
+
+	r := &run{config: c, stats: newStats(), matches: map[string]matchState{}}
+	start := time.Now()
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < c.Players; i++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			r.player(ctx, rand.New(rand.NewSource(seed)))
+		}(c.Seed + int64(i))
+	}
+	wg.Wait()
+
+	return r.report(time.Since(start)), nil
+}
+
+func (r *run) player(ctx context.Context, rnd *rand.Rand) {
+	for g := 0; r.config.Games == 0 || g < r.config.Games; g++ {
+		if ctx.Err() != nil {
+			return
+		}
+		r.playGame(ctx, rnd)
+	}
+}
+
+// playGame joins a match and plays it until it is over, stuck or ctx is
+// done.
+func (r *run) playGame(ctx context.Context, rnd *rand.Rand) {
+	// a client per game, as joining replaces the player cookie
+	c, err := client.NewWithHTTPClient(r.config.URL, &http.Client{
+		Timeout:   r.config.HTTPClient.Timeout,
+		Transport: r.config.HTTPClient.Transport,
+	})
+	if err != nil {
+		r.stats.fail(OpJoin, err)
+		return
+	}
+
+	var m *client.Match
+	if err := r.stats.time(ctx, OpJoin, func() (err error) {
+		m, err = c.Join(ctx)
+		return err
+	}); err != nil {
+		sleep(ctx, r.config.PollInterval)
+		return
+	}
+	r.setState(m.Id, started)
+
+	board := m.Board
+	lastChange := time.Now()
+	paired := m.MyTurn
+	// the last move is not sown yet
+	moved := false
+
+	for {
+		if !sleep(ctx, r.config.PollInterval) {
+			return
+		}
+
+		err := r.stats.time(ctx, OpGet, func() (err error) {
+			m, err = c.Get(ctx, m.Id)
+			return err
+		})
+		if err == nil && !reflect.DeepEqual(board, m.Board) {
+			board, lastChange, moved, paired = m.Board, time.Now(), false, true
+		}
+		if err == nil && game.Over(game.Board(m.Board)) {
+			r.setState(m.Id, finished)
+			return
+		}
+		if time.Since(lastChange) > r.config.StuckAfter {
+			if paired {
+				r.setState(m.Id, stuck)
+			} else {
+				r.setState(m.Id, unpaired)
+			}
+			return
+		}
+		if err != nil || !m.MyTurn || moved || len(m.LegalMoves) == 0 {
+			continue
+		}
+		paired = true
+
+		pit := m.LegalMoves[rnd.Intn(len(m.LegalMoves))]
+		var accepted bool
+		err = r.stats.time(ctx, OpMove, func() (err error) {
+			accepted, err = c.Move(ctx, m.Id, pit)
+			return err
+		})
+		if err == nil {
+			r.stats.moved(accepted)
+		}
+		moved = accepted
+	}
+}
+
+func (r *run) setState(matchId string, s matchState) {
+	r.matchesMut.Lock()
+	defer r.matchesMut.Unlock()
+
+	// the other player may have seen it end
+	if r.matches[matchId] != finished {
+		r.matches[matchId] = s
+	}
+}
+
+func (r *run) report(elapsed time.Duration) Report {
+	report := r.stats.report(elapsed)
+
+	r.matchesMut.Lock()
+	defer r.matchesMut.Unlock()
+	for id, s := range r.matches {
+		switch s {
+		case started:
+			report.Unfinished++
+		case finished:
+			report.Finished++
+		case stuck:
+			report.Stuck = append(report.Stuck, id)
+		case unpaired:
+			report.Unpaired++
+		}
+	}
+	sort.Strings(report.Stuck)
+	return report
+}
+
+// sleep waits for d, or returns false if ctx is done first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+// errorKind groups errors by operation and status, and the code of the
+// server when it sends one.
+func errorKind(op string, err error) string {
+	var apiErr *client.Error
+	if errors.As(err, &apiErr) {
+		if apiErr.Code != "" {
+			return fmt.Sprintf("%v %v %v", op, apiErr.StatusCode, apiErr.Code)
+		}
+		return fmt.Sprintf("%v %v", op, apiErr.StatusCode)
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return op + " timeout"
+	}
+	return op + " transport"
+}
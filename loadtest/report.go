@@ -0,0 +1,201 @@
+package loadtest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+type Report struct {
+	Elapsed time.Duration
+	// latency of the requests that got an answer, errors included
+	Operations map[string]Latency
+	// failed requests by operation, status and error code
+	Errors map[string]int
+	// moves the server did not accept, another move of the match being made
+	Rejected int
+	Moves    int
+
+	Finished int
+	// matches still being played when the run ended
+	Unfinished int
+	// matches whose board stopped changing, by id
+	Stuck []string
+	// matches in which no move was seen, usually as no opponent joined
+	Unpaired int
+}
+
+type Latency struct {
+	Count  int
+	Errors int
+	P50    time.Duration
+	P90    time.Duration
+	P99    time.Duration
+	Max    time.Duration
+}
+
+func (r Report) Requests() int {
+	n := 0
+	for _, l := range r.Operations {
+		n += l.Count
+	}
+	return n
+}
+
+func (r Report) FailedRequests() int {
+	n := 0
+	for _, c := range r.Errors {
+		n += c
+	}
+	return n
+}
+
+func (r Report) ErrorRate() float64 {
+	if r.Requests() == 0 {
+		return 0
+	}
+	return float64(r.FailedRequests()) / float64(r.Requests())
+}
+
+// perSecond is the throughput of n over the run.
+func (r Report) perSecond(n int) float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(n) / r.Elapsed.Seconds()
+}
+
+func (r Report) Write(w io.Writer) error {
+	fmt.Fprintf(w, "%v requests in %v, %.1f/s, %.2f%% failed\n",
+		r.Requests(), r.Elapsed.Round(time.Millisecond), r.perSecond(r.Requests()), 100*r.ErrorRate())
+	fmt.Fprintf(w, "%v moves, %.1f/s, %v rejected\n", r.Moves, r.perSecond(r.Moves), r.Rejected)
+	fmt.Fprintf(w, "%v matches finished, %.2f/s, %v unfinished, %v stuck, %v unpaired\n\n",
+		r.Finished, r.perSecond(r.Finished), r.Unfinished, len(r.Stuck), r.Unpaired)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "operation\trequests\terrors\tp50\tp90\tp99\tmax\t")
+	for _, op := range sortedKeys(r.Operations) {
+		l := r.Operations[op]
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t\n", op, l.Count, l.Errors,
+			round(l.P50), round(l.P90), round(l.P99), round(l.Max))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if len(r.Errors) > 0 {
+		fmt.Fprintln(w, "\nerrors")
+		for _, kind := range sortedKeys(r.Errors) {
+			fmt.Fprintf(w, "  %v: %v\n", kind, r.Errors[kind])
+		}
+	}
+	for _, id := range r.Stuck {
+		fmt.Fprintf(w, "stuck match %v\n", id)
+	}
+	return nil
+}
+
+func round(d time.Duration) time.Duration {
+	return d.Round(10 * time.Microsecond)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// stats collects the latency of every request of a run.
+type stats struct {
+	mut       sync.Mutex
+	latencies map[string][]time.Duration
+	failed    map[string]int
+	errors    map[string]int
+	rejected  int
+	moves     int
+}
+
+func newStats() *stats {
+	return &stats{latencies: map[string][]time.Duration{}, failed: map[string]int{}, errors: map[string]int{}}
+}
+
+// time runs and times the request f. Requests cut short because the run
+// is over are not counted.
+func (s *stats) time(ctx context.Context, op string, f func() error) error {
+	start := time.Now()
+	err := f()
+	elapsed := time.Since(start)
+	if ctx.Err() != nil {
+		return err
+	}
+
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.latencies[op] = append(s.latencies[op], elapsed)
+	if err != nil {
+		s.failed[op]++
+		s.errors[errorKind(op, err)]++
+	}
+	return err
+}
+
+// fail counts an error that happened before any request was made.
+func (s *stats) fail(op string, err error) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.errors[errorKind(op, err)]++
+}
+
+// moved counts a move the server answered, accepted or not.
+func (s *stats) moved(accepted bool) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if accepted {
+		s.moves++
+	} else {
+		s.rejected++
+	}
+}
+
+func (s *stats) report(elapsed time.Duration) Report {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	r := Report{Elapsed: elapsed, Operations: map[string]Latency{}, Errors: map[string]int{}, Rejected: s.rejected, Moves: s.moves}
+	for op, ls := range s.latencies {
+		sorted := slices.Clone(ls)
+		slices.Sort(sorted)
+		r.Operations[op] = Latency{
+			Count:  len(sorted),
+			Errors: s.failed[op],
+			P50:    percentile(sorted, 50),
+			P90:    percentile(sorted, 90),
+			P99:    percentile(sorted, 99),
+			Max:    sorted[len(sorted)-1],
+		}
+	}
+	for kind, n := range s.errors {
+		r.Errors[kind] = n
+	}
+	return r
+}
+
+// percentile returns the nearest rank percentile p of sorted.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := (len(sorted)*p + 99) / 100
+	if i < 1 {
+		i = 1
+	}
+	return sorted[i-1]
+}
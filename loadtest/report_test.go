@@ -0,0 +1,72 @@
+package loadtest
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dacruz/mancala/client"
+)
+
+func TestPercentile(t *testing.T) {
+	sorted := []time.Duration{}
+	for i := 1; i <= 100; i++ {
+		sorted = append(sorted, time.Duration(i)*time.Millisecond)
+	}
+
+	tests := []struct {
+		p        int
+		expected time.Duration
+	}{
+		{50, 50 * time.Millisecond},
+		{90, 90 * time.Millisecond},
+		{99, 99 * time.Millisecond},
+		{100, 100 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if actual := percentile(sorted, tt.p); actual != tt.expected {
+			t.Fatalf("p%v: expected %v but got %v", tt.p, tt.expected, actual)
+		}
+	}
+
+	if actual := percentile(sorted[:1], 99); actual != time.Millisecond {
+		t.Fatalf("the percentile of one request should be that request, got %v", actual)
+	}
+}
+
+func TestReportCountsErrors(t *testing.T) {
+	s := newStats()
+	s.time(context.Background(), OpGet, func() error { return nil })
+	s.time(context.Background(), OpMove, func() error {
+		return &client.Error{StatusCode: 503, Code: "queue_full"}
+	})
+	s.time(context.Background(), OpMove, func() error { return errors.New("connection refused") })
+
+	r := s.report(time.Second)
+	if r.Requests() != 3 || r.Operations[OpMove].Errors != 2 {
+		t.Fatalf("expected 3 requests, 2 failed moves, but got %+v", r)
+	}
+	if r.Errors["move 503 queue_full"] != 1 || r.Errors["move transport"] != 1 {
+		t.Fatalf("errors should be grouped by status and code: %v", r.Errors)
+	}
+
+	out := strings.Builder{}
+	r.Write(&out)
+	if !strings.Contains(out.String(), "66.67% failed") {
+		t.Fatalf("unexpected report:\n%v", out.String())
+	}
+}
+
+func TestRequestsCutShortAreNotCounted(t *testing.T) {
+	s := newStats()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	s.time(ctx, OpGet, func() error { return context.Canceled })
+
+	if r := s.report(time.Second); r.Requests() != 0 || len(r.Errors) != 0 {
+		t.Fatalf("a request of a finished run should not count: %+v", r)
+	}
+}
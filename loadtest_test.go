@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dacruz/mancala/loadtest"
+	"github.com/google/uuid"
+)
+
+var (
+	loadTestPlayers = flag.Int("loadtest.players", 20, "players of the in-process load test")
+	loadTestGames   = flag.Int("loadtest.games", 2, "games each player of the in-process load test plays")
+	loadTestSeed    = flag.Int64("loadtest.seed", 1, "seed of the moves of the in-process load test")
+)
+
+// TestLoadInProcess plays games against a server with the real dealer and
+// an in-memory repository, so no match may get stuck and no request fail.
+// It is what cmd/loadtest runs with -in-process.
+func TestLoadInProcess(t *testing.T) {
+	if testing.Short() {
+		t.Skip("load test")
+	}
+
+	d := newDealer(newMemoryRepo(), testConfig.Dealer, testConfig.Board)
+	s := httptest.NewServer(newServer(testConfig.Server, d, nil, &StubOrganizer{}, &StubScorekeeper{}, &StubReferee{}).Handler)
+	defer s.Close()
+
+	report, err := loadtest.Run(context.Background(), loadtest.Config{
+		URL:          s.URL,
+		Players:      *loadTestPlayers,
+		Games:        *loadTestGames,
+		PollInterval: time.Millisecond,
+		StuckAfter:   5 * time.Second,
+		Seed:         *loadTestSeed,
+	})
+	if err != nil {
+		t.Fatalf("load test failed: %v", err)
+	}
+
+	out := strings.Builder{}
+	report.Write(&out)
+	t.Log("\n" + out.String())
+
+	if len(report.Stuck) > 0 || report.Unpaired > 0 || report.FailedRequests() > 0 {
+		t.Fatalf("every match should be played without errors")
+	}
+	if expected := *loadTestPlayers * *loadTestGames / 2; report.Finished != expected {
+		t.Fatalf("expected %v finished matches but got %v", expected, report.Finished)
+	}
+}
+
+// memoryRepo keeps matches in memory and is safe for concurrent use.
+type memoryRepo struct {
+	mut       sync.Mutex
+	matches   map[string]Match
+	waiting   []string
+	locks     map[string]string
+	rematches map[string]Rematch
+}
+
+func newMemoryRepo() *memoryRepo {
+	return &memoryRepo{matches: map[string]Match{}, locks: map[string]string{}, rematches: map[string]Rematch{}}
+}
+
+func (r *memoryRepo) Get(ctx context.Context, id string) (*Match, error) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	m, ok := r.matches[id]
+	if !ok {
+		return nil, ErrMatchNotFound
+	}
+	m = copyMatch(m)
+	return &m, nil
+}
+
+func (r *memoryRepo) Save(ctx context.Context, m *Match) error {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	r.matches[m.Id] = copyMatch(*m)
+	return nil
+}
+
+func (r *memoryRepo) GetWaitingMatch(ctx context.Context) (*Match, error) {
+	r.mut.Lock()
+	if len(r.waiting) == 0 {
+		r.mut.Unlock()
+		return nil, errors.New("no waiting match")
+	}
+	id := r.waiting[0]
+	r.waiting = r.waiting[1:]
+	r.mut.Unlock()
+
+	return r.Get(ctx, id)
+}
+
+func (r *memoryRepo) AddWaitingMatch(ctx context.Context, m *Match) error {
+	r.Save(ctx, m)
+
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	r.waiting = append(r.waiting, m.Id)
+	return nil
+}
+
+func (r *memoryRepo) Lock(ctx context.Context, id string) (string, error) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	if _, ok := r.locks[id]; ok {
+		return "", ErrMatchLocked
+	}
+	token := uuid.NewString()
+	r.locks[id] = token
+	return token, nil
+}
+
+func (r *memoryRepo) ExtendLock(ctx context.Context, id string, token string) error {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	if r.locks[id] != token {
+		return ErrLockLost
+	}
+	return nil
+}
+
+func (r *memoryRepo) Unlock(ctx context.Context, id string, token string) error {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	if r.locks[id] == token {
+		delete(r.locks, id)
+	}
+	return nil
+}
+
+func (r *memoryRepo) GetRematch(ctx context.Context, matchId string) (*Rematch, error) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	rematch, ok := r.rematches[matchId]
+	if !ok {
+		return nil, nil
+	}
+	return &rematch, nil
+}
+
+func (r *memoryRepo) SaveRematch(ctx context.Context, rematch *Rematch) error {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	r.rematches[rematch.MatchId] = *rematch
+	return nil
+}
+
+func (r *memoryRepo) Ping(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	requestIdHeader = "X-Request-Id"
+)
+
+type loggerKey struct{}
+
+// newLogger writes JSON lines to stdout. level is one of debug, info, warn
+// or error, info being the default.
+func newLogger(level string) *slog.Logger {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		l = slog.LevelInfo
+	}
+
+	return slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: l, AddSource: true}))
+}
+
+// withLogFields returns a context whose logger adds args to every line.
+func withLogFields(ctx context.Context, args ...any) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger(ctx).With(args...))
+}
+
+// logger returns the logger carried by ctx, or the default one.
+func logger(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return l
+	}
+	return slog.Default()
+}
+
+// logPath is the path of the request with the player id left out, as it
+// is the player's credential.
+func logPath(r *http.Request, ps httprouter.Params) string {
+	if playerId := ps.ByName("playerId"); playerId != "" {
+		return strings.Replace(r.URL.Path, playerId, "-", 1)
+	}
+	return r.URL.Path
+}
+
+// withRequestLog tags every line logged while handling the request with a
+// request id, taken from the X-Request-Id header if the client sent one,
+// and logs the request once it is done.
+func withRequestLog(h httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		start := time.Now()
+
+		requestId := r.Header.Get(requestIdHeader)
+		if requestId == "" {
+			requestId = uuid.NewString()
+		}
+		w.Header().Set(requestIdHeader, requestId)
+
+		ctx := withLogFields(r.Context(), "request_id", requestId)
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+
+		h(sw, r.WithContext(ctx), ps)
+
+		logger(ctx).Info("request",
+			"method", r.Method,
+			"path", logPath(r, ps),
+			"status", sw.status,
+			"duration_ms", time.Since(start).Milliseconds())
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestRequestIdIsEchoed(t *testing.T) {
+	req, _ := http.NewRequest("GET", "http://localhost:8080", nil)
+	req.Header.Set(requestIdHeader, "test-request")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+
+	if res.Header.Get(requestIdHeader) != "test-request" {
+		t.Fatalf("expected request id test-request but got %v", res.Header.Get(requestIdHeader))
+	}
+}
+
+func TestRequestIdIsGenerated(t *testing.T) {
+	res := execute2xxRequest("GET", "http://localhost:8080", t)
+
+	if res.Header.Get(requestIdHeader) == "" {
+		t.Fatal("expected a request id")
+	}
+}
+
+func TestLoggerCarriesFields(t *testing.T) {
+	var buf bytes.Buffer
+	ctx := context.WithValue(context.Background(), loggerKey{}, slog.New(slog.NewJSONHandler(&buf, nil)))
+
+	ctx = withLogFields(ctx, "match_id", "m1")
+	logger(withLogFields(ctx, "player_id", "p1")).Info("move")
+
+	line := map[string]interface{}{}
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("log line is not JSON: %v", buf.String())
+	}
+
+	if line["match_id"] != "m1" || line["player_id"] != "p1" || line["msg"] != "move" {
+		t.Fatalf("unexpected log line: %v", buf.String())
+	}
+}
+
+func TestRequestLogLeavesPlayerIdOut(t *testing.T) {
+	var buf bytes.Buffer
+	ctx := context.WithValue(context.Background(), loggerKey{}, slog.New(slog.NewJSONHandler(&buf, nil)))
+	req, _ := http.NewRequestWithContext(ctx, "GET", "http://localhost:8080/api/v1/players/p1/matches", nil)
+
+	h := withRequestLog(func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {})
+	h(httptest.NewRecorder(), req, httprouter.Params{{Key: "playerId", Value: "p1"}})
+
+	line := map[string]interface{}{}
+	json.Unmarshal(buf.Bytes(), &line)
+	if line["path"] != "/api/v1/players/-/matches" {
+		t.Fatalf("expected the player id to be left out but got %v", line["path"])
+	}
+}
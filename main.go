@@ -1,46 +1,101 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
+	"flag"
+	"log/slog"
+	"net/http"
 	"os"
-	"time"
-
-	"github.com/gomodule/redigo/redis"
+	"os/signal"
+	"strings"
+	"syscall"
 )
 
 const (
-	ENV_REDIS_ADDRESS= "REDIS_ADDRESS"
+	ENV_REDIS_ADDRESS = "REDIS_ADDRESS"
+	ENV_BOT_COMMAND   = "BOT_COMMAND"
+	ENV_LOG_LEVEL     = "LOG_LEVEL"
+	ENV_TRACES        = "TRACES_EXPORTER"
 )
 
 func main() {
-	log.SetFlags(log.LstdFlags | log.Lshortfile)
-
-    redisAddr, redisAddrExists := os.LookupEnv(ENV_REDIS_ADDRESS)
-    if !redisAddrExists {
-        redisAddr = "localhost:6379"
-    }
-
-	p := &redis.Pool{
-        MaxIdle:     10,
-        IdleTimeout: 240 * time.Second,
-        Dial: func() (redis.Conn, error) {
-            c, err := redis.Dial("tcp", redisAddr)
-            if err != nil {
-                return nil, err
-            }
-            return c, err
-        },
-        TestOnBorrow: func(c redis.Conn, t time.Time) error {
-            _, err := c.Do("PING")
-            return err
-        },
-    }
-
-	r := newMatchRepo(p)
-    
-	d := newDealer(r)
-
-	if err := startServer(d); err != nil {
-		log.Fatal(err)
+	c, err := loadConfig(os.Args[1:], os.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		slog.Error("invalid configuration", "error", err)
+		os.Exit(2)
+	}
+
+	slog.SetDefault(newLogger(c.LogLevel))
+
+	stopTracing, err := startTracing(context.Background(), c.TracesExporter)
+	if err != nil {
+		slog.Error("failed to start tracing", "error", err)
+		os.Exit(1)
+	}
+
+	p, err := newRedisPool(c.Redis)
+	if err != nil {
+		slog.Error("failed to set up redis", "error", err)
+		os.Exit(1)
+	}
+
+	r := newMatchRepo(p, c.Redis)
+
+	d := newDealer(r, c.Dealer, c.Board)
+
+	var o Opponent
+	if c.BotCommand != "" {
+		o = newBotOpponent(d, strings.Fields(c.BotCommand))
+	}
+
+	t := newOrganizer(newTournamentRepo(p, c.Redis), d)
+	d.OnMatchFinished(t.MatchFinished)
+	k := newScorekeeper(newPlayerRepo(p, c.Redis))
+	d.OnMatchFinished(k.MatchFinished)
+	s := newReferee(newSeriesRepo(p, c.Redis), d)
+	d.OnMatchFinished(s.MatchFinished)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+
+	srv := newServer(c.Server, d, o, t, k, s)
+	served := make(chan error, 1)
+	go func() {
+		served <- srv.ListenAndServe()
+	}()
+
+	exitCode := 0
+	select {
+	case err := <-served:
+		slog.Error("server stopped", "error", err)
+		exitCode = 1
+	case <-ctx.Done():
+		slog.Info("shutting down")
+	}
+	// a second signal kills the process right away
+	stop()
+
+	if err := shutdown(c.Server, srv, o, d, stopTracing); err != nil {
+		slog.Error("shutdown failed", "error", err)
+		exitCode = 1
+	}
+	p.Close()
+	os.Exit(exitCode)
+}
+
+// shutdown stops taking requests, then waits for in-flight requests, bots
+// leaving their matches and queued moves, all within the shutdown timeout.
+// The opponent may be nil.
+func shutdown(c ServerConfig, srv *http.Server, o Opponent, d Dealer, stopTracing func(context.Context) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.ShutdownTimeout)
+	defer cancel()
+
+	errs := []error{srv.Shutdown(ctx)}
+	if o != nil {
+		errs = append(errs, o.Close(ctx))
 	}
+	return errors.Join(append(errs, d.Close(ctx), stopTracing(ctx))...)
 }
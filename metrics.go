@@ -0,0 +1,112 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/julienschmidt/httprouter"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	matchesCreated = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "mancala_matches_created_total",
+		Help: "Matches created, waiting for a second player or started right away.",
+	})
+	matchesJoined = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "mancala_matches_joined_total",
+		Help: "Waiting matches joined by a second player.",
+	})
+	matchesFinished = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "mancala_matches_finished_total",
+		Help: "Matches that ended.",
+	})
+	movesApplied = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "mancala_moves_applied_total",
+		Help: "Moves applied to a board and saved.",
+	})
+	movesDropped = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "mancala_moves_dropped_total",
+		Help: "Accepted moves given up on because their match lock was lost or they were not legal anymore.",
+	})
+	movesRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "mancala_moves_rejected_total",
+		Help: "Moves not accepted, by reason: queue_full, locked or closed.",
+	}, []string{"reason"})
+	workerDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "mancala_worker_duration_seconds",
+		Help:    "Time spent by dealer workers on a single move.",
+		Buckets: prometheus.ExponentialBuckets(0.00001, 4, 10),
+	}, []string{"worker"})
+	redisDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "mancala_redis_command_duration_seconds",
+		Help:    "Redis command latency.",
+		Buckets: prometheus.ExponentialBuckets(0.0001, 4, 10),
+	}, []string{"command"})
+	redisErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "mancala_redis_errors_total",
+		Help: "Redis commands that failed.",
+	}, []string{"command"})
+	lockAttempts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "mancala_lock_attempts_total",
+		Help: "Attempts to lock a match, by result: acquired, contended or error.",
+	}, []string{"result"})
+	moveQueueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "mancala_move_queue_depth",
+		Help: "Moves waiting in the dealer's move queue.",
+	})
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "mancala_http_request_duration_seconds",
+		Help:    "HTTP request latency by route and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+)
+
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap lets http.ResponseController flush streamed responses.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// instrument records the duration of every request to route.
+func instrument(route string, h httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+
+		h(sw, r, ps)
+
+		status := strconv.Itoa(sw.status)
+		httpDuration.WithLabelValues(r.Method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+// instrumentedConn records latency and errors of every command sent with
+// Do. Commands queued with Send are measured as part of the Do that
+// flushes them, usually EXEC.
+type instrumentedConn struct {
+	redis.Conn
+}
+
+func (c instrumentedConn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	start := time.Now()
+	reply, err := c.Conn.Do(commandName, args...)
+	redisDuration.WithLabelValues(commandName).Observe(time.Since(start).Seconds())
+
+	if err != nil {
+		redisErrors.WithLabelValues(commandName).Inc()
+	}
+	return reply, err
+}
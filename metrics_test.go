@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rafaeljusto/redigomock"
+)
+
+func TestMetricsEndpoint(t *testing.T) {
+	execute2xxRequest("GET", "http://localhost:8080", t)
+
+	res := execute2xxRequest("GET", "http://localhost:8080/metrics", t)
+	bs, _ := ioutil.ReadAll(res.Body)
+
+	if !strings.Contains(string(bs), `mancala_http_request_duration_seconds_count{method="GET",route="/",status="200"}`) {
+		t.Fatalf("http request was not recorded:\n%v", string(bs))
+	}
+}
+
+func TestRedisErrorsAreCounted(t *testing.T) {
+	conn := redigomock.NewConn()
+	repo := newMatchRepo(&redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			return contextMock{conn}, nil
+		},
+	}, testConfig.Redis)
+
+	conn.Command("GET", "match:{failing}").ExpectError(errors.New("error"))
+
+	before := testutil.ToFloat64(redisErrors.WithLabelValues("GET"))
+	repo.Get(context.Background(), "failing")
+
+	if testutil.ToFloat64(redisErrors.WithLabelValues("GET")) != before+1 {
+		t.Fatal("redis error was not counted")
+	}
+}
+
+func TestLockContentionIsCounted(t *testing.T) {
+	conn := redigomock.NewConn()
+	repo := newMatchRepo(&redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			return contextMock{conn}, nil
+		},
+	}, testConfig.Redis)
+
+	conn.GenericCommand("SET").Expect(nil)
+
+	before := testutil.ToFloat64(lockAttempts.WithLabelValues("contended"))
+	repo.Lock(context.Background(), "contended")
+
+	if testutil.ToFloat64(lockAttempts.WithLabelValues("contended")) != before+1 {
+		t.Fatal("lock contention was not counted")
+	}
+}
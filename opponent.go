@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dacruz/mancala/arena"
+	"github.com/dacruz/mancala/bot"
+	"github.com/dacruz/mancala/game"
+)
+
+const (
+	botPollInterval time.Duration = 200 * time.Millisecond
+	botMoveTime     time.Duration = time.Second
+	// the bot leaves matches where nothing happens for this long
+	botMaxIdle     time.Duration = 30 * time.Minute
+	botMaxFailures int           = 3
+)
+
+type Opponent interface {
+	// Play starts playing the match in the background.
+	Play(ctx context.Context, matchId string, playerId string)
+	// Close leaves every match being played and waits for it.
+	Close(context.Context) error
+}
+
+// BotOpponent plays matches on the server with an external bot, making its
+// moves through the dealer like any other player.
+type BotOpponent struct {
+	dealer   Dealer
+	newAgent func() (arena.Agent, error)
+
+	closing sync.Once
+	done    chan struct{}
+	playing atomic.Int32
+}
+
+func newBotOpponent(d Dealer, command []string) Opponent {
+	newAgent := func() (arena.Agent, error) {
+		return bot.Start(command, botMoveTime)
+	}
+	return &BotOpponent{dealer: d, newAgent: newAgent, done: make(chan struct{})}
+}
+
+func (b *BotOpponent) Play(ctx context.Context, matchId string, playerId string) {
+	b.playing.Add(1)
+	go func() {
+		defer b.playing.Add(-1)
+		b.play(ctx, matchId, playerId)
+	}()
+}
+
+// Close must be called once the server takes no more requests, before the
+// dealer is closed.
+func (b *BotOpponent) Close(ctx context.Context) error {
+	b.closing.Do(func() { close(b.done) })
+	if err := waitFor(ctx, func() bool { return b.playing.Load() <= 0 }); err != nil {
+		return fmt.Errorf("%v bots still playing: %w", b.playing.Load(), err)
+	}
+	return nil
+}
+
+// play blocks until the match is over, gone or abandoned, or the opponent
+// is closed.
+func (b *BotOpponent) play(ctx context.Context, matchId string, playerId string) {
+	ctx = withLogFields(ctx, "match_id", matchId, "player_id", playerId)
+
+	agent, err := b.newAgent()
+	if err != nil {
+		logger(ctx).Error("bot failed to start", "error", err)
+		return
+	}
+	if c, ok := agent.(io.Closer); ok {
+		defer c.Close()
+	}
+
+	lastMove := time.Now()
+	for time.Since(lastMove) < botMaxIdle {
+		select {
+		case <-b.done:
+			logger(ctx).Info("bot left match on shutdown")
+			return
+		case <-time.After(botPollInterval):
+		}
+
+		m, err := b.dealer.GetMatch(ctx, matchId, playerId)
+		if errors.Is(err, ErrMatchNotFound) || errors.Is(err, ErrNotParticipant) {
+			logger(ctx).Info("bot left match", "error", err)
+			return
+		}
+		if err != nil {
+			logger(ctx).Error("bot failed to get match", "error", err)
+			continue
+		}
+
+		if game.Over(game.Board(m.Board)) {
+			return
+		}
+
+		if !b.dealer.PlayerTurn(*m, playerId) {
+			continue
+		}
+
+		pit := b.choose(ctx, agent, *m, playerId)
+		if err := b.dealer.MakeMove(ctx, pit, *m, playerId); err != nil {
+			logger(ctx).Error("bot move failed", "pit", pit, "error", err)
+		}
+		lastMove = time.Now()
+	}
+
+	logger(ctx).Info("bot left idle match")
+}
+
+// choose asks the bot for a move. A bot that keeps failing or answers with
+// an illegal pit plays the first legal pit instead, so the match goes on.
+func (b *BotOpponent) choose(ctx context.Context, agent arena.Agent, m Match, playerId string) int {
+	side := 0
+	if m.P2 == playerId {
+		side = 1
+	}
+
+	view := game.Board{m.Board[side], m.Board[1-side]}.Copy()
+	legal := game.LegalMoves(view, 0)
+
+	for i := 0; i < botMaxFailures; i++ {
+		pit, err := agent.Choose(arena.State{Board: view, Legal: legal})
+		if err != nil {
+			logger(ctx).Error("bot failed to choose a move", "error", err)
+			continue
+		}
+
+		for _, l := range legal {
+			if l == pit {
+				return pit
+			}
+		}
+		logger(ctx).Error("bot chose an illegal pit", "pit", pit)
+	}
+
+	return legal[0]
+}
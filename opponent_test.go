@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/dacruz/mancala/arena"
+	"github.com/google/uuid"
+)
+
+type StubAgent struct {
+	pit   int
+	err   error
+	calls int
+}
+
+func (a *StubAgent) Choose(s arena.State) (int, error) {
+	a.calls++
+	return a.pit, a.err
+}
+
+func TestBotChoosesFromItsSide(t *testing.T) {
+	b := BotOpponent{}
+	botId := uuid.NewString()
+	match := Match{Id: uuid.NewString(), P1: uuid.NewString(), P2: botId, Board: MancalaBoard{{0, 0, 0, 0, 0, 1, 0}, {0, 0, 3, 0, 0, 0, 0}}}
+
+	pit := b.choose(context.Background(), &StubAgent{pit: 2}, match, botId)
+
+	if pit != 2 {
+		t.Fatalf("expected bot to play pit 2 but got %v", pit)
+	}
+}
+
+func TestFailingBotPlaysFirstLegalPit(t *testing.T) {
+	b := BotOpponent{}
+	botId := uuid.NewString()
+	match := Match{Id: uuid.NewString(), P1: botId, P2: uuid.NewString(), Board: MancalaBoard{{0, 0, 0, 4, 0, 1, 0}, {1, 0, 0, 0, 0, 0, 0}}}
+
+	agent := &StubAgent{err: errors.New("crashed")}
+	pit := b.choose(context.Background(), agent, match, botId)
+
+	if pit != 3 {
+		t.Fatalf("expected fallback to pit 3 but got %v", pit)
+	}
+
+	if agent.calls != botMaxFailures {
+		t.Fatalf("expected %v attempts but got %v", botMaxFailures, agent.calls)
+	}
+}
+
+func TestBotIllegalPitIsReplaced(t *testing.T) {
+	b := BotOpponent{}
+	botId := uuid.NewString()
+	match := Match{Id: uuid.NewString(), P1: botId, P2: uuid.NewString(), Board: MancalaBoard{{0, 0, 0, 4, 0, 1, 0}, {1, 0, 0, 0, 0, 0, 0}}}
+
+	pit := b.choose(context.Background(), &StubAgent{pit: 0}, match, botId)
+
+	if pit != 3 {
+		t.Fatalf("expected fallback to pit 3 but got %v", pit)
+	}
+}
+
+func TestBotLeavesUnknownMatch(t *testing.T) {
+	agent := &StubAgent{}
+	b := &BotOpponent{dealer: &StubDealer{}, newAgent: func() (arena.Agent, error) { return agent, nil }, done: make(chan struct{})}
+
+	b.Play(context.Background(), uuid.NewString(), uuid.NewString())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*botPollInterval)
+	defer cancel()
+	if err := b.Close(ctx); err != nil {
+		t.Fatalf("expected the bot to leave but got %v", err)
+	}
+	if agent.calls != 0 {
+		t.Fatalf("expected no move but got %v", agent.calls)
+	}
+}
@@ -0,0 +1,155 @@
+// Package pairing decides who plays whom in each round of a tournament.
+//
+// Players are identified by their index, usually their seed or their
+// registration order. Every function returns the pairings of a round and
+// the player that sits the round out, -1 if none does.
+package pairing
+
+// RoundRobin returns the pairings of round (0 based) of a round robin
+// between n players, built with the circle method. Every player meets
+// every other player once in Rounds(n) rounds.
+func RoundRobin(n int, round int) ([][2]int, int) {
+	m := n
+	if m%2 == 1 {
+		// a ghost player, whoever meets it sits the round out
+		m++
+	}
+
+	circle := make([]int, m)
+	circle[0] = 0
+	for i := 1; i < m; i++ {
+		circle[i] = 1 + (i-1+round)%(m-1)
+	}
+
+	pairs := [][2]int{}
+	bye := -1
+	for i := 0; i < m/2; i++ {
+		a, b := circle[i], circle[m-1-i]
+		switch {
+		case a == n:
+			bye = b
+			continue
+		case b == n:
+			bye = a
+			continue
+		}
+
+		// the fixed player would always move first otherwise
+		if i == 0 && round%2 == 1 {
+			a, b = b, a
+		}
+		pairs = append(pairs, [2]int{a, b})
+	}
+
+	return pairs, bye
+}
+
+// Rounds is the number of rounds of a round robin between n players.
+func Rounds(n int) int {
+	if n%2 == 1 {
+		return n
+	}
+	return n - 1
+}
+
+// Swiss pairs players that are next to each other in ranking, best first,
+// avoiding rematches where possible. With an odd number of players the
+// lowest ranked player that has not had a bye yet sits the round out.
+func Swiss(ranking []int, played func(a, b int) bool, hadBye func(int) bool) ([][2]int, int) {
+	order := append([]int{}, ranking...)
+
+	bye := -1
+	if len(order)%2 == 1 {
+		i := lowestWithoutBye(order, hadBye)
+		bye = order[i]
+		order = append(order[:i], order[i+1:]...)
+	}
+
+	pairs := [][2]int{}
+	paired := make([]bool, len(order))
+	for i := range order {
+		if paired[i] {
+			continue
+		}
+
+		opponent := -1
+		for j := i + 1; j < len(order); j++ {
+			if paired[j] {
+				continue
+			}
+			if opponent < 0 {
+				opponent = j
+			}
+			if !played(order[i], order[j]) {
+				opponent = j
+				break
+			}
+		}
+
+		paired[i] = true
+		paired[opponent] = true
+		pairs = append(pairs, [2]int{order[i], order[opponent]})
+	}
+
+	return pairs, bye
+}
+
+// Elimination pairs the players that have lost fewer than lives games:
+// one life for single elimination, two for double elimination. Players
+// with the same number of losses meet each other, best seed against worst
+// seed. When a group is odd its lowest seed is moved down to the next
+// group, or gets a bye if there is none.
+//
+// The tournament is over when Active returns less than two players.
+func Elimination(losses []int, lives int, hadBye func(int) bool) ([][2]int, int) {
+	pairs := [][2]int{}
+	carry := []int{}
+
+	for l := 0; l < lives; l++ {
+		group := carry
+		carry = []int{}
+		for p, pl := range losses {
+			if pl == l {
+				group = append(group, p)
+			}
+		}
+
+		if len(group)%2 == 1 {
+			i := len(group) - 1
+			if l == lives-1 {
+				i = lowestWithoutBye(group, hadBye)
+			}
+			carry = []int{group[i]}
+			group = append(group[:i:i], group[i+1:]...)
+		}
+
+		for i := 0; i < len(group)/2; i++ {
+			pairs = append(pairs, [2]int{group[i], group[len(group)-1-i]})
+		}
+	}
+
+	if len(carry) == 1 {
+		return pairs, carry[0]
+	}
+	return pairs, -1
+}
+
+// Active returns the players that have lost fewer than lives games.
+func Active(losses []int, lives int) []int {
+	active := []int{}
+	for p, l := range losses {
+		if l < lives {
+			active = append(active, p)
+		}
+	}
+	return active
+}
+
+func lowestWithoutBye(order []int, hadBye func(int) bool) int {
+	for i := len(order) - 1; i >= 0; i-- {
+		if !hadBye(order[i]) {
+			return i
+		}
+	}
+	return len(order) - 1
+}
@@ -0,0 +1,111 @@
+package pairing
+
+import (
+	"testing"
+)
+
+func never(int) bool { return false }
+
+func TestRoundRobinEveryoneMeetsOnce(t *testing.T) {
+	for _, n := range []int{2, 3, 4, 5, 8} {
+		met := map[[2]int]int{}
+		byes := map[int]int{}
+
+		for round := 0; round < Rounds(n); round++ {
+			pairs, bye := RoundRobin(n, round)
+			if bye >= 0 {
+				byes[bye]++
+			}
+			for _, p := range pairs {
+				a, b := p[0], p[1]
+				if a > b {
+					a, b = b, a
+				}
+				met[[2]int{a, b}]++
+			}
+		}
+
+		if len(met) != n*(n-1)/2 {
+			t.Fatalf("%v players: expected %v pairings but got %v", n, n*(n-1)/2, len(met))
+		}
+		for p, times := range met {
+			if times != 1 {
+				t.Fatalf("%v players: %v met %v times", n, p, times)
+			}
+		}
+
+		if n%2 == 1 && len(byes) != n {
+			t.Fatalf("%v players: every player should sit out once, got %v", n, byes)
+		}
+	}
+}
+
+func TestSwissAvoidsRematches(t *testing.T) {
+	played := func(a, b int) bool {
+		return (a == 0 && b == 1) || (a == 1 && b == 0)
+	}
+
+	pairs, bye := Swiss([]int{0, 1, 2, 3}, played, never)
+
+	if bye != -1 {
+		t.Fatalf("no bye expected but got %v", bye)
+	}
+
+	if pairs[0] != [2]int{0, 2} || pairs[1] != [2]int{1, 3} {
+		t.Fatalf("expected [[0 2] [1 3]] but got %v", pairs)
+	}
+}
+
+func TestSwissByeGoesToLowestWithoutBye(t *testing.T) {
+	hadBye := func(p int) bool { return p == 2 }
+
+	_, bye := Swiss([]int{0, 1, 2}, func(a, b int) bool { return false }, hadBye)
+
+	if bye != 1 {
+		t.Fatalf("expected bye for 1 but got %v", bye)
+	}
+}
+
+func TestSingleElimination(t *testing.T) {
+	losses := []int{0, 0, 0, 0, 1}
+
+	pairs, bye := Elimination(losses, 1, never)
+
+	if bye != -1 {
+		t.Fatalf("no bye expected but got %v", bye)
+	}
+
+	if len(pairs) != 2 || pairs[0] != [2]int{0, 3} || pairs[1] != [2]int{1, 2} {
+		t.Fatalf("expected [[0 3] [1 2]] but got %v", pairs)
+	}
+}
+
+func TestSingleEliminationBye(t *testing.T) {
+	pairs, bye := Elimination([]int{0, 0, 0}, 1, never)
+
+	if bye != 2 || len(pairs) != 1 {
+		t.Fatalf("expected bye for 2 and one pairing but got %v, %v", bye, pairs)
+	}
+}
+
+func TestDoubleEliminationCarriesOddPlayerDown(t *testing.T) {
+	losses := []int{0, 0, 0, 1, 2}
+
+	pairs, bye := Elimination(losses, 2, never)
+
+	if bye != -1 {
+		t.Fatalf("no bye expected but got %v", bye)
+	}
+
+	if len(pairs) != 2 || pairs[0] != [2]int{0, 1} || pairs[1] != [2]int{2, 3} {
+		t.Fatalf("expected [[0 1] [2 3]] but got %v", pairs)
+	}
+}
+
+func TestActive(t *testing.T) {
+	active := Active([]int{0, 2, 1}, 2)
+
+	if len(active) != 2 || active[0] != 0 || active[1] != 2 {
+		t.Fatalf("expected [0 2] but got %v", active)
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/dacruz/mancala/game"
+)
+
+const (
+	initialRating int = 1500
+	// how many points a game can move a rating, at most
+	ratingK float64 = 32
+	// newest matches a profile is computed from, so reading it stays
+	// bounded however long the history is
+	maxProfileMatches int = 1000
+)
+
+var (
+	// the player has not finished any match yet
+	ErrPlayerNotFound = errors.New("player not found")
+)
+
+// Profile is what the latest finished matches of a player, at most
+// maxProfileMatches of them, tell about them.
+type Profile struct {
+	PlayerId string
+	Played   int
+	Wins     int
+	Losses   int
+	Draws    int
+	// the player's score minus their opponent's, on average
+	AverageMargin    float64
+	LongestWinStreak int
+	// pit the player sows first most often, as P1 or P2, nil if they never
+	// made a move
+	FavoriteOpening *int
+	Rating          int
+	// oldest first
+	RatingHistory []RatingChange
+}
+
+type RatingChange struct {
+	MatchId    string
+	Rating     int
+	FinishedAt time.Time
+}
+
+// Scorekeeper rates players as their matches finish and keeps their
+// history.
+type Scorekeeper interface {
+	GetProfile(ctx context.Context, playerId string) (*Profile, error)
+	// GetMatches returns the finished matches of the player, newest first,
+	// and how many there are in all.
+	GetMatches(ctx context.Context, playerId string, offset int, limit int) ([]Match, int, error)
+	// GetLeaderboard returns the entries of the leaderboard from offset,
+	// highest score first, and how many players it lists.
+	GetLeaderboard(ctx context.Context, b Leaderboard, offset int, limit int) ([]LeaderboardEntry, int, error)
+	MatchFinished(context.Context, Match)
+}
+
+type MancalaScorekeeper struct {
+	repo PlayerRepo
+}
+
+func newScorekeeper(r PlayerRepo) Scorekeeper {
+	return &MancalaScorekeeper{repo: r}
+}
+
+func (s *MancalaScorekeeper) GetProfile(ctx context.Context, playerId string) (*Profile, error) {
+	matches, _, err := s.repo.GetPlayerMatches(ctx, playerId, 0, maxProfileMatches)
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) == 0 {
+		return nil, ErrPlayerNotFound
+	}
+
+	p := newProfile(playerId, matches)
+	return &p, nil
+}
+
+func (s *MancalaScorekeeper) GetMatches(ctx context.Context, playerId string, offset int, limit int) ([]Match, int, error) {
+	return s.repo.GetPlayerMatches(ctx, playerId, offset, limit)
+}
+
+// MatchFinished rates both players, adds the match to their history and
+// updates the leaderboards it counts in.
+// Matches without a second player, or finished before they were timed, are
+// not kept.
+func (s *MancalaScorekeeper) MatchFinished(ctx context.Context, m Match) {
+	if m.P2 == "" || m.FinishedAt == nil {
+		return
+	}
+
+	r1, err := s.repo.GetRating(ctx, m.P1)
+	if err != nil {
+		logger(ctx).Error("failed to rate match", "error", err)
+		return
+	}
+	r2, err := s.repo.GetRating(ctx, m.P2)
+	if err != nil {
+		logger(ctx).Error("failed to rate match", "error", err)
+		return
+	}
+
+	delta := ratingChange(r1, r2, result(m.Board, 0))
+	if r1, err = s.repo.AddRating(ctx, m.P1, delta); err != nil {
+		logger(ctx).Error("failed to rate match", "error", err)
+		return
+	}
+	if r2, err = s.repo.AddRating(ctx, m.P2, -delta); err != nil {
+		logger(ctx).Error("failed to rate match", "error", err)
+		return
+	}
+	m.Ratings = []int{r1, r2}
+
+	if err := s.repo.AddFinishedMatch(ctx, m); err != nil {
+		logger(ctx).Error("failed to keep finished match", "error", err)
+		return
+	}
+	if err := s.updateLeaderboards(ctx, m); err != nil {
+		logger(ctx).Error("failed to update leaderboards", "error", err)
+		return
+	}
+	logger(ctx).Debug("match rated", "p1_rating", r1, "p2_rating", r2)
+}
+
+// ratingChange is the Elo change of a player rated r against an opponent
+// rated opponent, for a result of 1 for a win, 0.5 for a draw and 0 for a
+// loss. The opponent's rating changes as much the other way.
+func ratingChange(r int, opponent int, result float64) int {
+	expected := 1 / (1 + math.Pow(10, float64(opponent-r)/400))
+	return int(math.Round(ratingK * (result - expected)))
+}
+
+// result is 1 if side won the finished board, 0.5 on a draw and 0 if it
+// lost.
+func result(b MancalaBoard, side int) float64 {
+	mine, theirs := game.Score(game.Board(b), side), game.Score(game.Board(b), 1-side)
+	switch {
+	case mine > theirs:
+		return 1
+	case mine < theirs:
+		return 0
+	}
+	return 0.5
+}
+
+// newProfile computes the profile of playerId from their finished
+// matches, newest first. The first pit a player sows counts as their
+// opening whether they started the match or not.
+func newProfile(playerId string, matches []Match) Profile {
+	p := Profile{PlayerId: playerId, Rating: initialRating, RatingHistory: []RatingChange{}}
+	openings := make([]int, boardSize)
+	margin, streak := 0, 0
+
+	for i := len(matches) - 1; i >= 0; i-- {
+		m := matches[i]
+		side := m.side(playerId)
+
+		p.Played++
+		margin += game.Score(game.Board(m.Board), side) - game.Score(game.Board(m.Board), 1-side)
+		switch result(m.Board, side) {
+		case 1:
+			p.Wins++
+			streak++
+		case 0:
+			p.Losses++
+			streak = 0
+		default:
+			p.Draws++
+			streak = 0
+		}
+		if streak > p.LongestWinStreak {
+			p.LongestWinStreak = streak
+		}
+
+		// P1 opens first, and turns alternate
+		if side < len(m.Openings) {
+			openings[m.Openings[side]]++
+		}
+
+		if len(m.Ratings) == 2 && m.FinishedAt != nil {
+			p.Rating = m.Ratings[side]
+			p.RatingHistory = append(p.RatingHistory, RatingChange{MatchId: m.Id, Rating: p.Rating, FinishedAt: *m.FinishedAt})
+		}
+	}
+
+	p.AverageMargin = float64(margin) / float64(p.Played)
+	for pit, n := range openings {
+		if n > 0 && (p.FavoriteOpening == nil || n > openings[*p.FavoriteOpening]) {
+			pit := pit
+			p.FavoriteOpening = &pit
+		}
+	}
+	return p
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var testPlayerId = uuid.NewString()
+
+// testPlayerMatches are the matches of testPlayerId, newest first: a win
+// as P1, a loss as P2 and a draw as P1.
+var testPlayerMatches = []Match{
+	finishedMatch(testPlayerId, "o1", MancalaBoard{{0, 0, 0, 0, 0, 0, 40}, {0, 0, 0, 0, 0, 1, 31}}, []int{3, 1}, []int{1516, 1484}),
+	finishedMatch("o2", testPlayerId, MancalaBoard{{0, 0, 0, 0, 0, 0, 40}, {0, 0, 0, 0, 0, 1, 31}}, []int{0, 3}, []int{1516, 1500}),
+	finishedMatch(testPlayerId, "o3", MancalaBoard{{0, 0, 0, 0, 0, 0, 36}, {0, 0, 0, 0, 0, 0, 36}}, []int{2, 5}, []int{1500, 1500}),
+}
+
+func finishedMatch(p1 string, p2 string, b MancalaBoard, openings []int, ratings []int) Match {
+	at := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	return Match{Id: uuid.NewString(), P1: p1, P2: p2, Board: b, Openings: openings, FinishedAt: &at, Ratings: ratings}
+}
+
+func TestNewProfile(t *testing.T) {
+	p := newProfile(testPlayerId, testPlayerMatches)
+
+	if p.Played != 3 || p.Wins != 1 || p.Losses != 1 || p.Draws != 1 {
+		t.Fatalf("expected a win, a loss and a draw but got %+v", p)
+	}
+	// +8, -8 and 0
+	if p.AverageMargin != 0 {
+		t.Fatalf("expected an average margin of 0 but got %v", p.AverageMargin)
+	}
+	if p.LongestWinStreak != 1 {
+		t.Fatalf("expected a streak of 1 but got %v", p.LongestWinStreak)
+	}
+	if p.FavoriteOpening == nil || *p.FavoriteOpening != 3 {
+		t.Fatalf("expected to open with 3 most, as P1 and P2, but got %v", p.FavoriteOpening)
+	}
+
+	ratings := []int{}
+	for _, c := range p.RatingHistory {
+		ratings = append(ratings, c.Rating)
+	}
+	if !reflect.DeepEqual(ratings, []int{1500, 1500, 1516}) || p.Rating != 1516 {
+		t.Fatalf("expected the ratings of the player, oldest first, but got %v and %v", ratings, p.Rating)
+	}
+}
+
+func TestNewProfileCountsTheLongestStreak(t *testing.T) {
+	win := finishedMatch(testPlayerId, "o", MancalaBoard{{0, 0, 0, 0, 0, 0, 40}, {0, 0, 0, 0, 0, 1, 31}}, nil, nil)
+	loss := finishedMatch("o", testPlayerId, win.Board, nil, nil)
+
+	// newest first
+	p := newProfile(testPlayerId, []Match{win, loss, win, win, win, loss, win, win})
+	if p.LongestWinStreak != 3 {
+		t.Fatalf("expected a streak of 3 but got %v", p.LongestWinStreak)
+	}
+	if p.FavoriteOpening != nil || p.Rating != initialRating || len(p.RatingHistory) != 0 {
+		t.Fatalf("matches without openings or ratings should not count: %+v", p)
+	}
+}
+
+func TestGetProfileReadsTheLatestMatchesOnly(t *testing.T) {
+	matches := []Match{}
+	for i := 0; i < maxProfileMatches+10; i++ {
+		matches = append(matches, testPlayerMatches[i%len(testPlayerMatches)])
+	}
+	k := newScorekeeper(&StubPlayerRepo{matches: matches})
+
+	p, err := k.GetProfile(context.Background(), testPlayerId)
+	if err != nil || p.Played != maxProfileMatches {
+		t.Fatalf("expected a profile of the latest %v matches but got %+v, %v", maxProfileMatches, p, err)
+	}
+}
+
+func TestRatingChange(t *testing.T) {
+	tests := []struct {
+		rating   int
+		opponent int
+		result   float64
+		expected int
+	}{
+		{1500, 1500, 1, 16},
+		{1500, 1500, 0.5, 0},
+		{1500, 1500, 0, -16},
+		{1500, 1900, 1, 29},
+		{1900, 1500, 1, 3},
+	}
+	for _, tt := range tests {
+		if actual := ratingChange(tt.rating, tt.opponent, tt.result); actual != tt.expected {
+			t.Fatalf("%v against %v scoring %v: expected %v but got %v", tt.rating, tt.opponent, tt.result, tt.expected, actual)
+		}
+	}
+}
+
+func TestMatchFinishedRatesBothPlayers(t *testing.T) {
+	repo := &StubPlayerRepo{ratings: map[string]int{"p2": 1600}}
+	k := newScorekeeper(repo)
+
+	m := finishedMatch("p1", "p2", MancalaBoard{{0, 0, 0, 0, 0, 0, 40}, {0, 0, 0, 0, 0, 1, 31}}, nil, nil)
+	k.MatchFinished(context.Background(), m)
+
+	if repo.ratings["p1"] != 1520 || repo.ratings["p2"] != 1580 {
+		t.Fatalf("expected p1 to take 20 points from p2 but got %v", repo.ratings)
+	}
+	if len(repo.matches) != 1 || !reflect.DeepEqual(repo.matches[0].Ratings, []int{1520, 1580}) {
+		t.Fatalf("expected the match to be kept with the new ratings, got %v", repo.matches)
+	}
+}
+
+func TestMatchFinishedSkipsMatchesNotTimed(t *testing.T) {
+	repo := &StubPlayerRepo{}
+	k := newScorekeeper(repo)
+
+	k.MatchFinished(context.Background(), Match{Id: uuid.NewString(), P1: "p1", P2: "p2", Board: newBoard()})
+
+	if len(repo.matches) != 0 {
+		t.Fatalf("expected no match to be kept but got %v", repo.matches)
+	}
+}
+
+func TestGetPlayer(t *testing.T) {
+	res := execute2xxRequest("GET", "http://localhost:8080/api/v1/players/"+testPlayerId, t)
+
+	player := PlayerResponse{}
+	if err := json.NewDecoder(res.Body).Decode(&player); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	if player.Id != testPlayerId || player.Alias != alias(testPlayerId) || player.Played != 3 || player.Rating != 1516 || len(player.RatingHistory) != 3 {
+		t.Fatalf("unexpected player: %+v", player)
+	}
+}
+
+func TestGetUnknownPlayer(t *testing.T) {
+	res, err := http.Get("http://localhost:8080/api/v1/players/" + uuid.NewString())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer res.Body.Close()
+
+	e := ErrorMessage{}
+	json.NewDecoder(res.Body).Decode(&e)
+	if res.StatusCode != http.StatusNotFound || e.Code != "player_not_found" {
+		t.Fatalf("expected 404 player_not_found but got %v %+v", res.StatusCode, e)
+	}
+}
+
+func TestListPlayerMatches(t *testing.T) {
+	res := execute2xxRequest("GET", "http://localhost:8080/api/v1/players/"+testPlayerId+"/matches?offset=1&limit=1", t)
+
+	bs, _ := ioutil.ReadAll(res.Body)
+	page := PlayerMatchesResponse{}
+	if err := json.Unmarshal(bs, &page); err != nil {
+		t.Fatalf("invalid response: %v", string(bs))
+	}
+
+	if page.Total != 3 || page.Offset != 1 || page.Limit != 1 || len(page.Matches) != 1 {
+		t.Fatalf("expected the second of 3 matches but got %+v", page)
+	}
+	m := page.Matches[0]
+	if m.Id != testPlayerMatches[1].Id || m.Result != "loss" || m.Score != 32 || m.OpponentScore != 40 || *m.Opening != 3 || m.Rating != 1500 {
+		t.Fatalf("expected the loss as P2 but got %+v", m)
+	}
+	if strings.Contains(string(bs), "o2") {
+		t.Fatalf("the opponent's id should not be sent: %v", string(bs))
+	}
+}
+
+func TestListPlayerMatchesWithInvalidPage(t *testing.T) {
+	for _, query := range []string{"offset=-1", "limit=0", "limit=101", "limit=x"} {
+		res, err := http.Get("http://localhost:8080/api/v1/players/" + testPlayerId + "/matches?" + query)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		res.Body.Close()
+
+		if res.StatusCode != http.StatusBadRequest {
+			t.Fatalf("%v: expected 400 but got %v", query, res.StatusCode)
+		}
+	}
+}
+
+type StubScorekeeper struct{}
+
+func (k *StubScorekeeper) GetProfile(ctx context.Context, playerId string) (*Profile, error) {
+	if playerId != testPlayerId {
+		return nil, ErrPlayerNotFound
+	}
+	p := newProfile(playerId, testPlayerMatches)
+	return &p, nil
+}
+
+func (k *StubScorekeeper) GetMatches(ctx context.Context, playerId string, offset int, limit int) ([]Match, int, error) {
+	if playerId != testPlayerId {
+		return []Match{}, 0, nil
+	}
+	return (&StubPlayerRepo{matches: testPlayerMatches}).GetPlayerMatches(ctx, playerId, offset, limit)
+}
+
+func (k *StubScorekeeper) GetLeaderboard(ctx context.Context, b Leaderboard, offset int, limit int) ([]LeaderboardEntry, int, error) {
+	return (&StubPlayerRepo{leaderboards: testLeaderboards}).GetLeaderboard(ctx, b, offset, limit)
+}
+
+func (k *StubScorekeeper) MatchFinished(ctx context.Context, m Match) {}
+
+// StubPlayerRepo keeps the matches of every player together.
+type StubPlayerRepo struct {
+	ratings map[string]int
+	// newest first
+	matches []Match
+	// scores by alias
+	leaderboards map[Leaderboard]map[string]int
+}
+
+func (r *StubPlayerRepo) GetRating(ctx context.Context, playerId string) (int, error) {
+	if rating, ok := r.ratings[playerId]; ok {
+		return rating, nil
+	}
+	return initialRating, nil
+}
+
+func (r *StubPlayerRepo) AddRating(ctx context.Context, playerId string, delta int) (int, error) {
+	if r.ratings == nil {
+		r.ratings = map[string]int{}
+	}
+	rating, _ := r.GetRating(ctx, playerId)
+	r.ratings[playerId] = rating + delta
+	return r.ratings[playerId], nil
+}
+
+func (r *StubPlayerRepo) AddFinishedMatch(ctx context.Context, m Match) error {
+	r.matches = append([]Match{m}, r.matches...)
+	return nil
+}
+
+func (r *StubPlayerRepo) GetPlayerMatches(ctx context.Context, playerId string, offset int, limit int) ([]Match, int, error) {
+	if offset > len(r.matches) {
+		offset = len(r.matches)
+	}
+	end := len(r.matches)
+	if limit >= 0 && offset+limit < end {
+		end = offset + limit
+	}
+	return r.matches[offset:end], len(r.matches), nil
+}
+
+func (r *StubPlayerRepo) SetLeaderboardScore(ctx context.Context, b Leaderboard, alias string, score int) error {
+	if r.leaderboards == nil {
+		r.leaderboards = map[Leaderboard]map[string]int{}
+	}
+	if r.leaderboards[b] == nil {
+		r.leaderboards[b] = map[string]int{}
+	}
+	r.leaderboards[b][alias] = score
+	return nil
+}
+
+func (r *StubPlayerRepo) AddLeaderboardScore(ctx context.Context, b Leaderboard, alias string, delta int) error {
+	return r.SetLeaderboardScore(ctx, b, alias, r.leaderboards[b][alias]+delta)
+}
+
+func (r *StubPlayerRepo) GetLeaderboard(ctx context.Context, b Leaderboard, offset int, limit int) ([]LeaderboardEntry, int, error) {
+	entries := []LeaderboardEntry{}
+	for alias, score := range r.leaderboards[b] {
+		entries = append(entries, LeaderboardEntry{Alias: alias, Score: score})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Score > entries[j].Score })
+
+	total := len(entries)
+	if offset > total {
+		offset = total
+	}
+	end := total
+	if offset+limit < end {
+		end = offset + limit
+	}
+	entries = entries[offset:end]
+	for i := range entries {
+		entries[i].Rank = offset + i + 1
+	}
+	return entries, total, nil
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// connSource hands out connections to Redis: a *redis.Pool for a single
+// server or the master sentinels point to, a *redisCluster for a cluster.
+type connSource interface {
+	GetContext(context.Context) (redis.Conn, error)
+	Close() error
+}
+
+// errorConn fails every command with the error met getting a connection,
+// as redigo's pool does, so callers only check the errors of commands.
+type errorConn struct{ err error }
+
+func (c errorConn) Do(string, ...interface{}) (interface{}, error) { return nil, c.err }
+func (c errorConn) DoContext(context.Context, string, ...interface{}) (interface{}, error) {
+	return nil, c.err
+}
+func (c errorConn) Send(string, ...interface{}) error                   { return c.err }
+func (c errorConn) Err() error                                          { return c.err }
+func (c errorConn) Close() error                                        { return nil }
+func (c errorConn) Flush() error                                        { return c.err }
+func (c errorConn) Receive() (interface{}, error)                       { return nil, c.err }
+func (c errorConn) ReceiveContext(context.Context) (interface{}, error) { return nil, c.err }
+
+// newRedisPool connects to the Redis deployment c describes. Connections
+// are made when first needed, so Redis does not have to be up yet.
+func newRedisPool(c RedisConfig) (connSource, error) {
+	options, err := dialOptions(c.TLS, c.Username, c.Password)
+	if err != nil {
+		return nil, err
+	}
+	options = append(options, redis.DialConnectTimeout(c.CommandTimeout))
+	dial := func(address string) (redis.Conn, error) {
+		return redis.Dial("tcp", address, options...)
+	}
+
+	switch {
+	case len(c.Cluster) > 0:
+		return newRedisCluster(c, dial), nil
+
+	case len(c.Sentinel.Addresses) > 0:
+		sentinelOptions, _ := dialOptions(c.TLS, "", c.Sentinel.Password)
+		sentinelOptions = append(sentinelOptions, redis.DialConnectTimeout(c.CommandTimeout))
+		s := sentinel{
+			addresses: c.Sentinel.Addresses,
+			master:    c.Sentinel.MasterName,
+			dial: func(address string) (redis.Conn, error) {
+				return redis.Dial("tcp", address, sentinelOptions...)
+			},
+		}
+		return newPool(c, func() (redis.Conn, error) { return s.dialMaster(dial) }, checkMaster), nil
+
+	default:
+		return newPool(c, func() (redis.Conn, error) { return dial(c.Address) }, ping), nil
+	}
+}
+
+func newPool(c RedisConfig, dial func() (redis.Conn, error), testOnBorrow func(redis.Conn, time.Time) error) *redis.Pool {
+	return &redis.Pool{
+		MaxIdle:      c.MaxIdle,
+		MaxActive:    c.MaxActive,
+		IdleTimeout:  c.IdleTimeout,
+		Dial:         dial,
+		TestOnBorrow: testOnBorrow,
+	}
+}
+
+// dialOptions authenticates with AUTH, or with ACL AUTH if there is a
+// username, and sets up TLS.
+func dialOptions(c TLSConfig, username string, password string) ([]redis.DialOption, error) {
+	options := []redis.DialOption{redis.DialUsername(username), redis.DialPassword(password)}
+	if !c.Enabled {
+		return options, nil
+	}
+
+	tlsConfig := &tls.Config{ServerName: c.ServerName, MinVersion: tls.VersionTLS12}
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("redis ca file: %w", err)
+		}
+
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			roots = x509.NewCertPool()
+		}
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("redis ca file: no certificate found in %v", c.CAFile)
+		}
+		tlsConfig.RootCAs = roots
+	}
+
+	return append(options, redis.DialUseTLS(true), redis.DialTLSConfig(tlsConfig)), nil
+}
+
+func ping(c redis.Conn, _ time.Time) error {
+	_, err := c.Do("PING")
+	return err
+}
+
+// checkMaster fails on connections to a server that is not a master
+// anymore, so the pool drops them after a failover.
+func checkMaster(c redis.Conn, _ time.Time) error {
+	role, err := redis.Values(c.Do("ROLE"))
+	if err != nil {
+		return err
+	}
+	if len(role) == 0 {
+		return errors.New("empty ROLE reply")
+	}
+
+	if r, _ := redis.String(role[0], nil); r != "master" {
+		return fmt.Errorf("server is a %v, not a master", r)
+	}
+	return nil
+}
+
+// sentinel finds the master of a deployment monitored by Redis Sentinel.
+type sentinel struct {
+	addresses []string
+	master    string
+	dial      func(string) (redis.Conn, error)
+}
+
+// dialMaster connects to the master the first sentinel to answer names.
+func (s sentinel) dialMaster(dial func(string) (redis.Conn, error)) (redis.Conn, error) {
+	address, err := s.masterAddress()
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := dial(address)
+	if err != nil {
+		return nil, err
+	}
+
+	// a sentinel may not have seen the failover yet
+	if err := checkMaster(c, time.Now()); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("%v: %w", address, err)
+	}
+	return c, nil
+}
+
+func (s sentinel) masterAddress() (string, error) {
+	var errs []error
+	for _, a := range s.addresses {
+		address, err := s.ask(a)
+		if err == nil {
+			return address, nil
+		}
+		errs = append(errs, fmt.Errorf("sentinel %v: %w", a, err))
+	}
+	return "", fmt.Errorf("no master %q found: %w", s.master, errors.Join(errs...))
+}
+
+func (s sentinel) ask(address string) (string, error) {
+	c, err := s.dial(address)
+	if err != nil {
+		return "", err
+	}
+	defer c.Close()
+
+	hostPort, err := redis.Strings(c.Do("SENTINEL", "get-master-addr-by-name", s.master))
+	if err == redis.ErrNil {
+		return "", errors.New("unknown master")
+	}
+	if err != nil {
+		return "", err
+	}
+	if len(hostPort) != 2 {
+		return "", fmt.Errorf("unexpected reply %v", hostPort)
+	}
+
+	return net.JoinHostPort(hostPort[0], hostPort[1]), nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/rafaeljusto/redigomock"
+)
+
+func TestSentinelDialsTheMaster(t *testing.T) {
+	down := errors.New("connection refused")
+	s1 := redigomock.NewConn()
+	s1.Command("SENTINEL", "get-master-addr-by-name", "mymaster").Expect([]interface{}{[]byte("10.0.0.2"), []byte("6379")})
+	master := redigomock.NewConn()
+	master.Command("ROLE").Expect([]interface{}{[]byte("master"), int64(0), []interface{}{}})
+
+	s := sentinel{
+		addresses: []string{"s0:26379", "s1:26379"},
+		master:    "mymaster",
+		dial: func(address string) (redis.Conn, error) {
+			if address == "s0:26379" {
+				return nil, down
+			}
+			return s1, nil
+		},
+	}
+
+	dialed := ""
+	_, err := s.dialMaster(func(address string) (redis.Conn, error) {
+		dialed = address
+		return master, nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if dialed != "10.0.0.2:6379" {
+		t.Fatalf("expected the master to be dialed but got %v", dialed)
+	}
+}
+
+func TestSentinelRejectsStaleMaster(t *testing.T) {
+	s1 := redigomock.NewConn()
+	s1.Command("SENTINEL", "get-master-addr-by-name", "mymaster").Expect([]interface{}{[]byte("10.0.0.2"), []byte("6379")})
+	replica := redigomock.NewConn()
+	replica.Command("ROLE").Expect([]interface{}{[]byte("slave"), []byte("10.0.0.3"), int64(6379), []byte("connected"), int64(0)})
+
+	s := sentinel{
+		addresses: []string{"s1:26379"},
+		master:    "mymaster",
+		dial:      func(string) (redis.Conn, error) { return s1, nil },
+	}
+
+	if _, err := s.dialMaster(func(string) (redis.Conn, error) { return replica, nil }); err == nil {
+		t.Fatal("a replica should not be used as master")
+	}
+}
+
+func TestCheckMasterAfterFailover(t *testing.T) {
+	conn := redigomock.NewConn()
+	conn.Command("ROLE").Expect([]interface{}{[]byte("slave"), []byte("10.0.0.3"), int64(6379), []byte("connected"), int64(0)})
+
+	if err := checkMaster(conn, time.Now()); err == nil {
+		t.Fatal("a demoted master should fail the borrow test")
+	}
+}
+
+func TestInvalidCAFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "ca.pem")
+	os.WriteFile(file, []byte("not a certificate"), 0600)
+
+	if _, err := dialOptions(TLSConfig{Enabled: true, CAFile: file}, "", ""); err == nil {
+		t.Fatal("a CA file without certificates should be rejected")
+	}
+
+	if _, err := dialOptions(TLSConfig{Enabled: true, CAFile: file + ".missing"}, "", ""); err == nil {
+		t.Fatal("a missing CA file should be rejected")
+	}
+}
@@ -1,37 +1,172 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"strconv"
+	"time"
 
 	"github.com/gomodule/redigo/redis"
+	"github.com/google/uuid"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type MatchRepo interface {
-	Get(string) (*Match, error)
-	Save(*Match)
-	GetWaitingMatch() (*Match, error)
-	AddWaitingMatch(*Match)
-	Lock(id string) error
+	Get(context.Context, string) (*Match, error)
+	Save(context.Context, *Match) error
+	GetWaitingMatch(context.Context) (*Match, error)
+	AddWaitingMatch(context.Context, *Match) error
+	// Lock locks a match for LockTTL and returns the token that owns the
+	// lock. It fails with ErrMatchLocked if another owner has it.
+	Lock(ctx context.Context, id string) (string, error)
+	// ExtendLock locks the match for LockTTL again, as long as token still
+	// owns the lock, or fails with ErrLockLost.
+	ExtendLock(ctx context.Context, id string, token string) error
+	// Unlock releases the lock if token still owns it.
+	Unlock(ctx context.Context, id string, token string) error
+	// GetRematch returns the rematch of a match, nil if none was offered.
+	GetRematch(ctx context.Context, matchId string) (*Rematch, error)
+	SaveRematch(context.Context, *Rematch) error
+	// Ping checks that the repository can be reached.
+	Ping(context.Context) error
 }
 
+var (
+	ErrMatchLocked = errors.New("match is locked")
+	ErrLockLost    = errors.New("match lock expired or taken over")
+)
+
+var (
+	// the lock is only touched by the owner of the token it holds
+	extendLockScript = redis.NewScript(1, `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("EXPIRE", KEYS[1], ARGV[2]) end return 0`)
+	unlockScript     = redis.NewScript(1, `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) end return 0`)
+)
+
 type RedisRepo struct {
-	connPool *redis.Pool
+	connPool connSource
+	config   RedisConfig
+}
+
+// Keys of a match share its id as hash tag so they live on the same cluster
+// node. Sets indexing every match or tournament are a key of their own, and
+// are written after the keys they point to.
+func matchKey(id string) string {
+	return fmt.Sprintf("match:{%v}", id)
+}
+
+func lockKey(matchId string) string {
+	return fmt.Sprintf("match:{%v}:lock", matchId)
+}
+
+func rematchKey(matchId string) string {
+	return fmt.Sprintf("match:{%v}:rematch", matchId)
+}
+
+func tournamentKey(id string) string {
+	return fmt.Sprintf("tournament:{%v}", id)
+}
+
+func tournamentMatchKey(matchId string) string {
+	return fmt.Sprintf("tournament_match:{%v}", matchId)
+}
+
+func seriesKey(id string) string {
+	return fmt.Sprintf("series:{%v}", id)
 }
 
-func newMatchRepo(connPool *redis.Pool) MatchRepo {
-	mr := RedisRepo{connPool: connPool}
+func playerMatchesKey(playerId string) string {
+	return fmt.Sprintf("player:{%v}:matches", playerId)
+}
+
+// playerHistoryKey holds a copy of each finished match of the player, by
+// match id, so their history is read with one command.
+func playerHistoryKey(playerId string) string {
+	return fmt.Sprintf("player:{%v}:history", playerId)
+}
+
+func ratingKey(playerId string) string {
+	return fmt.Sprintf("player:{%v}:rating", playerId)
+}
+
+func leaderboardKey(b Leaderboard) string {
+	variant := "all"
+	if b.Variant != allVariants {
+		variant = strconv.Itoa(b.Variant)
+	}
+	return fmt.Sprintf("leaderboard:{%v:%v:%v}", b.By, variant, b.Window)
+}
+
+// Keys of older versions, without hash tags. Matches and tournaments are
+// still read from them, and saved under their new key on their next change.
+func legacyMatchKey(id string) string {
+	return fmt.Sprintf("match:%v", id)
+}
+
+func legacyTournamentKey(id string) string {
+	return fmt.Sprintf("tournament:%v", id)
+}
+
+func legacyTournamentMatchKey(matchId string) string {
+	return fmt.Sprintf("tournament_match:%v", matchId)
+}
+
+// getOrLegacy gets key, or legacyKey if key is not set.
+func getOrLegacy(conn redis.Conn, key string, legacyKey string) (string, error) {
+	value, err := redis.String(conn.Do("GET", key))
+	if err == redis.ErrNil {
+		return redis.String(conn.Do("GET", legacyKey))
+	}
+	return value, err
+}
+
+func newMatchRepo(connPool connSource, c RedisConfig) MatchRepo {
+	mr := RedisRepo{connPool: connPool, config: c}
 	return &mr
 }
 
-func (r *RedisRepo) Get(id string) (*Match, error) {
-	conn := r.connPool.Get()
+// conn returns a pooled connection bound to ctx, or one failing every
+// command if none could be had.
+func (r *RedisRepo) conn(ctx context.Context) redis.Conn {
+	c, err := r.connPool.GetContext(ctx)
+	if err != nil {
+		c = errorConn{err}
+	}
+	return instrumentedConn{contextConn{Conn: c, ctx: ctx, timeout: r.config.CommandTimeout}}
+}
+
+// contextConn runs every command with the deadline of its context, capped
+// at timeout, in a span of its own. A command that times out closes the
+// connection.
+type contextConn struct {
+	redis.Conn
+	ctx     context.Context
+	timeout time.Duration
+}
+
+func (c contextConn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
+	defer cancel()
+
+	_, span := tracer.Start(ctx, "redis "+commandName,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemRedis, semconv.DBOperation(commandName)))
+	reply, err := redis.DoContext(c.Conn, ctx, commandName, args...)
+	endSpan(span, err)
+
+	return reply, err
+}
+
+func (r *RedisRepo) Get(ctx context.Context, id string) (*Match, error) {
+	conn := r.conn(ctx)
 	defer conn.Close()
 
-	matchKey := fmt.Sprintf("match:%v", id)
-	
-	matchStr, err := redis.String(conn.Do("GET", matchKey))
+	matchStr, err := getOrLegacy(conn, matchKey(id), legacyMatchKey(id))
+	if err == redis.ErrNil {
+		return nil, ErrMatchNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -42,69 +177,586 @@ func (r *RedisRepo) Get(id string) (*Match, error) {
 	return &m, err
 }
 
-func (r *RedisRepo) GetWaitingMatch() (*Match, error) {
-	conn := r.connPool.Get()
+func (r *RedisRepo) GetWaitingMatch(ctx context.Context) (*Match, error) {
+	conn := r.conn(ctx)
 	defer conn.Close()
 
 	mId, err := redis.String(conn.Do("SPOP", "waiting_match"))
 	if err != nil {
-		log.Print("no waiting match - ", err)
+		logger(ctx).Debug("no waiting match", "error", err)
 		return nil, err
 	}
 
-	return r.Get(mId)
+	return r.Get(ctx, mId)
 }
 
-func (r *RedisRepo) AddWaitingMatch(m *Match) {
-	matchKey := fmt.Sprintf("match:%v", m.Id)
+// AddWaitingMatch saves the match before listing it as waiting, so a
+// waiting id always has its match.
+func (r *RedisRepo) AddWaitingMatch(ctx context.Context, m *Match) error {
+	if err := r.Save(ctx, m); err != nil {
+		return err
+	}
+
+	conn := r.conn(ctx)
+	defer conn.Close()
+
+	_, err := conn.Do("SADD", "waiting_match", m.Id)
+	return err
+}
+
+func (r *RedisRepo) Save(ctx context.Context, m *Match) error {
 	matchValue, err := json.Marshal(m)
-	checkFatalError(err)
+	if err != nil {
+		return err
+	}
+
+	conn := r.conn(ctx)
+	defer conn.Close()
+
+	_, err = conn.Do("SET", matchKey(m.Id), matchValue)
+	return err
+}
+
+// Lock is safe on a single master only. Replicas and cluster failovers may
+// lose a lock, see https://redis.io/topics/distlock, which ExtendLock then
+// reports.
+func (r *RedisRepo) Lock(ctx context.Context, id string) (string, error) {
+	conn := r.conn(ctx)
+	defer conn.Close()
+
+	token := uuid.NewString()
+	reply, err := conn.Do("SET", lockKey(id), token, "EX", r.lockSeconds(), "NX")
+	switch {
+	case err != nil:
+		lockAttempts.WithLabelValues("error").Inc()
+		return "", err
+	case reply == nil:
+		lockAttempts.WithLabelValues("contended").Inc()
+		return "", ErrMatchLocked
+	default:
+		lockAttempts.WithLabelValues("acquired").Inc()
+		return token, nil
+	}
+}
+
+func (r *RedisRepo) ExtendLock(ctx context.Context, id string, token string) error {
+	conn := r.conn(ctx)
+	defer conn.Close()
+
+	extended, err := redis.Bool(extendLockScript.Do(conn, lockKey(id), token, r.lockSeconds()))
+	if err != nil {
+		return err
+	}
+	if !extended {
+		return ErrLockLost
+	}
+	return nil
+}
+
+func (r *RedisRepo) Unlock(ctx context.Context, id string, token string) error {
+	conn := r.conn(ctx)
+	defer conn.Close()
+
+	released, err := redis.Bool(unlockScript.Do(conn, lockKey(id), token))
+	if err != nil {
+		return err
+	}
+	if !released {
+		return ErrLockLost
+	}
+	return nil
+}
+
+func (r *RedisRepo) lockSeconds() int {
+	return int(r.config.LockTTL.Seconds())
+}
 
-	conn := r.connPool.Get()
+func (r *RedisRepo) GetRematch(ctx context.Context, matchId string) (*Rematch, error) {
+	conn := r.conn(ctx)
 	defer conn.Close()
 
-	err = conn.Send("MULTI")
-	checkFatalError(err)
+	rematchStr, err := redis.String(conn.Do("GET", rematchKey(matchId)))
+	if err == redis.ErrNil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rematch := Rematch{}
+	if err := json.Unmarshal([]byte(rematchStr), &rematch); err != nil {
+		return nil, err
+	}
+	return &rematch, nil
+}
+
+func (r *RedisRepo) SaveRematch(ctx context.Context, rematch *Rematch) error {
+	rematchValue, err := json.Marshal(rematch)
+	if err != nil {
+		return err
+	}
 
-	err = conn.Send("SET", matchKey, matchValue)
-	checkFatalError(err)
+	conn := r.conn(ctx)
+	defer conn.Close()
 
-	err = conn.Send("SADD", "waiting_match", m.Id)
-	checkFatalError(err)
+	_, err = conn.Do("SET", rematchKey(rematch.MatchId), rematchValue)
+	return err
+}
 
-	_, err = conn.Do("EXEC")
-	checkFatalError(err)
+func (r *RedisRepo) Ping(ctx context.Context) error {
+	conn := r.conn(ctx)
+	defer conn.Close()
+
+	_, err := conn.Do("PING")
+	return err
+}
+
+type TournamentRepo interface {
+	GetTournament(context.Context, string) (*Tournament, error)
+	ListTournaments(context.Context) ([]*Tournament, error)
+	AddTournament(context.Context, *Tournament) error
+	// UpdateTournament saves the changes f makes to the tournament. f is
+	// called again if the tournament changed in the meantime.
+	UpdateTournament(context.Context, string, func(*Tournament) error) (*Tournament, error)
+	GetMatchTournament(context.Context, string) (string, error)
+}
+
+const (
+	maxUpdateRetries int = 10
+)
+
+func newTournamentRepo(connPool connSource, c RedisConfig) TournamentRepo {
+	tr := RedisRepo{connPool: connPool, config: c}
+	return &tr
+}
+
+func (r *RedisRepo) GetTournament(ctx context.Context, id string) (*Tournament, error) {
+	conn := r.conn(ctx)
+	defer conn.Close()
+
+	return decodeTournament(getOrLegacy(conn, tournamentKey(id), legacyTournamentKey(id)))
+}
+
+// getTournament reads the tournament from its key only, as the legacy key
+// may be on another cluster node than the one a transaction is bound to.
+func getTournament(conn redis.Conn, id string) (*Tournament, error) {
+	return decodeTournament(redis.String(conn.Do("GET", tournamentKey(id))))
+}
+
+func decodeTournament(tournamentStr string, err error) (*Tournament, error) {
+	if err == redis.ErrNil {
+		return nil, ErrTournamentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	t := Tournament{}
+	err = json.Unmarshal([]byte(tournamentStr), &t)
+
+	return &t, err
+}
+
+func (r *RedisRepo) ListTournaments(ctx context.Context) ([]*Tournament, error) {
+	conn := r.conn(ctx)
+	defer conn.Close()
+
+	ids, err := redis.Strings(conn.Do("SMEMBERS", "tournaments"))
+	if err != nil {
+		return nil, err
+	}
+
+	tournaments := []*Tournament{}
+	for _, id := range ids {
+		t, err := decodeTournament(getOrLegacy(conn, tournamentKey(id), legacyTournamentKey(id)))
+		if err != nil {
+			logger(ctx).Error("failed to get tournament", "tournament_id", id, "error", err)
+			continue
+		}
+		tournaments = append(tournaments, t)
+	}
 
+	return tournaments, nil
 }
 
-func (r *RedisRepo) Save(m *Match) {
-	matchKey := fmt.Sprintf("match:%v", m.Id)
+func (r *RedisRepo) AddTournament(ctx context.Context, t *Tournament) error {
+	tournamentValue, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+
+	conn := r.conn(ctx)
+	defer conn.Close()
+
+	if _, err := conn.Do("SET", tournamentKey(t.Id), tournamentValue); err != nil {
+		return err
+	}
+
+	_, err = conn.Do("SADD", "tournaments", t.Id)
+	return err
+}
+
+// UpdateTournament indexes new matches before saving the tournament, on a
+// connection of their own since they are not in the tournament's slot. An
+// index left by an update that is retried points to a tournament without
+// that match, which MatchFinished ignores.
+func (r *RedisRepo) UpdateTournament(ctx context.Context, id string, f func(*Tournament) error) (*Tournament, error) {
+	conn := r.conn(ctx)
+	defer conn.Close()
+
+	for i := 0; i < maxUpdateRetries; i++ {
+		if _, err := conn.Do("WATCH", tournamentKey(id)); err != nil {
+			return nil, err
+		}
+
+		t, err := getTournament(conn, id)
+		if err == ErrTournamentNotFound {
+			conn.Do("UNWATCH")
+			if err := r.moveLegacyTournament(ctx, id); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil {
+			conn.Do("UNWATCH")
+			return nil, err
+		}
+
+		knownMatches := map[string]bool{}
+		for _, g := range t.Games {
+			knownMatches[g.MatchId] = true
+		}
+
+		if err := f(t); err != nil {
+			conn.Do("UNWATCH")
+			return nil, err
+		}
+
+		tournamentValue, err := json.Marshal(t)
+		if err != nil {
+			conn.Do("UNWATCH")
+			return nil, err
+		}
+
+		if err := r.indexMatches(ctx, t, knownMatches); err != nil {
+			conn.Do("UNWATCH")
+			return nil, err
+		}
+
+		conn.Send("MULTI")
+		conn.Send("SET", tournamentKey(id), tournamentValue)
+
+		reply, err := conn.Do("EXEC")
+		if err != nil {
+			return nil, err
+		}
+
+		// a nil reply means the tournament changed after WATCH
+		if reply != nil {
+			return t, nil
+		}
+		logger(ctx).Debug("tournament changed while updating, retrying", "tournament_id", id)
+	}
+
+	return nil, fmt.Errorf("tournament %v: too many concurrent updates", id)
+}
+
+// moveLegacyTournament saves a tournament of an older version under its
+// key, unless it is there already, so it can be watched while updated.
+func (r *RedisRepo) moveLegacyTournament(ctx context.Context, id string) error {
+	conn := r.conn(ctx)
+	defer conn.Close()
+
+	tournamentStr, err := redis.String(conn.Do("GET", legacyTournamentKey(id)))
+	if err == redis.ErrNil {
+		return ErrTournamentNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.Do("SET", tournamentKey(id), tournamentStr, "NX")
+	return err
+}
+
+func (r *RedisRepo) indexMatches(ctx context.Context, t *Tournament, known map[string]bool) error {
+	conn := r.conn(ctx)
+	defer conn.Close()
+
+	for _, g := range t.Games {
+		if g.MatchId != "" && !known[g.MatchId] {
+			if _, err := conn.Do("SET", tournamentMatchKey(g.MatchId), t.Id); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (r *RedisRepo) GetMatchTournament(ctx context.Context, matchId string) (string, error) {
+	conn := r.conn(ctx)
+	defer conn.Close()
+
+	return getOrLegacy(conn, tournamentMatchKey(matchId), legacyTournamentMatchKey(matchId))
+}
+
+type SeriesRepo interface {
+	GetSeries(context.Context, string) (*Series, error)
+	AddSeries(context.Context, *Series) error
+	// UpdateSeries saves the changes f makes to the series. f is called
+	// again if the series changed in the meantime.
+	UpdateSeries(context.Context, string, func(*Series) error) (*Series, error)
+}
+
+func newSeriesRepo(connPool connSource, c RedisConfig) SeriesRepo {
+	sr := RedisRepo{connPool: connPool, config: c}
+	return &sr
+}
+
+func (r *RedisRepo) GetSeries(ctx context.Context, id string) (*Series, error) {
+	conn := r.conn(ctx)
+	defer conn.Close()
+
+	return getSeries(conn, id)
+}
+
+func getSeries(conn redis.Conn, id string) (*Series, error) {
+	seriesStr, err := redis.String(conn.Do("GET", seriesKey(id)))
+	if err == redis.ErrNil {
+		return nil, ErrSeriesNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s := Series{}
+	err = json.Unmarshal([]byte(seriesStr), &s)
+
+	return &s, err
+}
+
+func (r *RedisRepo) AddSeries(ctx context.Context, s *Series) error {
+	seriesValue, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	conn := r.conn(ctx)
+	defer conn.Close()
+
+	_, err = conn.Do("SET", seriesKey(s.Id), seriesValue)
+	return err
+}
+
+func (r *RedisRepo) UpdateSeries(ctx context.Context, id string, f func(*Series) error) (*Series, error) {
+	conn := r.conn(ctx)
+	defer conn.Close()
+
+	for i := 0; i < maxUpdateRetries; i++ {
+		if _, err := conn.Do("WATCH", seriesKey(id)); err != nil {
+			return nil, err
+		}
+
+		s, err := getSeries(conn, id)
+		if err != nil {
+			conn.Do("UNWATCH")
+			return nil, err
+		}
+
+		if err := f(s); err != nil {
+			conn.Do("UNWATCH")
+			return nil, err
+		}
+
+		seriesValue, err := json.Marshal(s)
+		if err != nil {
+			conn.Do("UNWATCH")
+			return nil, err
+		}
+
+		conn.Send("MULTI")
+		conn.Send("SET", seriesKey(id), seriesValue)
+
+		reply, err := conn.Do("EXEC")
+		if err != nil {
+			return nil, err
+		}
+
+		// a nil reply means the series changed after WATCH
+		if reply != nil {
+			return s, nil
+		}
+		logger(ctx).Debug("series changed while updating, retrying", "series_id", id)
+	}
+
+	return nil, fmt.Errorf("series %v: too many concurrent updates", id)
+}
+
+type PlayerRepo interface {
+	// GetRating returns the rating of the player, initialRating if they
+	// were never rated.
+	GetRating(context.Context, string) (int, error)
+	// AddRating changes the rating of the player by delta and returns the
+	// new rating.
+	AddRating(ctx context.Context, playerId string, delta int) (int, error)
+	// AddFinishedMatch saves the match and adds it to the history of both
+	// players.
+	AddFinishedMatch(context.Context, Match) error
+	// GetPlayerMatches returns limit matches of the player's history from
+	// offset, newest first, all of them if limit is negative, and the size
+	// of the history.
+	GetPlayerMatches(ctx context.Context, playerId string, offset int, limit int) ([]Match, int, error)
+	// SetLeaderboardScore sets the score of the player on the leaderboard.
+	SetLeaderboardScore(ctx context.Context, b Leaderboard, alias string, score int) error
+	// AddLeaderboardScore adds delta to the score of the player on the
+	// leaderboard, listing them with delta if they were not.
+	AddLeaderboardScore(ctx context.Context, b Leaderboard, alias string, delta int) error
+	// GetLeaderboard returns limit entries of the leaderboard from offset,
+	// highest score first, and how many players it lists.
+	GetLeaderboard(ctx context.Context, b Leaderboard, offset int, limit int) ([]LeaderboardEntry, int, error)
+}
+
+func newPlayerRepo(connPool connSource, c RedisConfig) PlayerRepo {
+	pr := RedisRepo{connPool: connPool, config: c}
+	return &pr
+}
+
+func (r *RedisRepo) GetRating(ctx context.Context, playerId string) (int, error) {
+	conn := r.conn(ctx)
+	defer conn.Close()
+
+	rating, err := redis.Int(conn.Do("GET", ratingKey(playerId)))
+	if err == redis.ErrNil {
+		return initialRating, nil
+	}
+	return rating, err
+}
+
+func (r *RedisRepo) AddRating(ctx context.Context, playerId string, delta int) (int, error) {
+	conn := r.conn(ctx)
+	defer conn.Close()
+
+	if _, err := conn.Do("SET", ratingKey(playerId), initialRating, "NX"); err != nil {
+		return 0, err
+	}
+	return redis.Int(conn.Do("INCRBY", ratingKey(playerId), delta))
+}
+
+// AddFinishedMatch scores histories by the time the match finished, so
+// they stay in order whatever order matches are added in.
+func (r *RedisRepo) AddFinishedMatch(ctx context.Context, m Match) error {
 	matchValue, err := json.Marshal(m)
-	checkFatalError(err)
+	if err != nil {
+		return err
+	}
 
-	conn := r.connPool.Get()
+	conn := r.conn(ctx)
 	defer conn.Close()
 
-	_, err = conn.Do("SET", matchKey, matchValue)
-	checkFatalError(err)
+	if _, err := conn.Do("SET", matchKey(m.Id), matchValue); err != nil {
+		return err
+	}
+	for _, playerId := range []string{m.P1, m.P2} {
+		if _, err := conn.Do("HSET", playerHistoryKey(playerId), m.Id, matchValue); err != nil {
+			return err
+		}
+		if _, err := conn.Do("ZADD", playerMatchesKey(playerId), m.FinishedAt.UnixMilli(), m.Id); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-//I know this will not work well on a distributed Redis
-// see: https://redis.io/topics/distlock
-func (r *RedisRepo) Lock(id string) error {
-	conn := r.connPool.Get()
+func (r *RedisRepo) GetPlayerMatches(ctx context.Context, playerId string, offset int, limit int) ([]Match, int, error) {
+	conn := r.conn(ctx)
 	defer conn.Close()
-	
-	_, err := conn.Do("SET", id, "locked", "EX", 1, "NX")
 
+	total, err := redis.Int(conn.Do("ZCARD", playerMatchesKey(playerId)))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	stop := -1
+	if limit >= 0 {
+		stop = offset + limit - 1
+	}
+	matches := []Match{}
+	if limit == 0 || offset >= total {
+		return matches, total, nil
+	}
+
+	ids, err := redis.Strings(conn.Do("ZREVRANGE", playerMatchesKey(playerId), offset, stop))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	values, err := redis.ByteSlices(conn.Do("HMGET", redis.Args{}.Add(playerHistoryKey(playerId)).AddFlat(ids)...))
+	if err != nil {
+		return nil, 0, err
+	}
+	for i, id := range ids {
+		m := &Match{}
+		if values[i] != nil {
+			err = json.Unmarshal(values[i], m)
+		} else {
+			// finished before histories kept copies, the match lives in a
+			// slot of its own
+			m, err = r.Get(ctx, id)
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		matches = append(matches, *m)
+	}
+	return matches, total, nil
+}
+
+func (r *RedisRepo) SetLeaderboardScore(ctx context.Context, b Leaderboard, alias string, score int) error {
+	conn := r.conn(ctx)
+	defer conn.Close()
+
+	_, err := conn.Do("ZADD", leaderboardKey(b), score, alias)
+	return err
+}
+
+func (r *RedisRepo) AddLeaderboardScore(ctx context.Context, b Leaderboard, alias string, delta int) error {
+	conn := r.conn(ctx)
+	defer conn.Close()
+
+	_, err := conn.Do("ZINCRBY", leaderboardKey(b), delta, alias)
 	return err
 }
 
-//Better handling needed, but no time.
-//http server on main.go will handle it and send a 500
-func checkFatalError(err error) {
+// GetLeaderboard ranks players by their position, so players with the same
+// score have ranks of their own.
+func (r *RedisRepo) GetLeaderboard(ctx context.Context, b Leaderboard, offset int, limit int) ([]LeaderboardEntry, int, error) {
+	conn := r.conn(ctx)
+	defer conn.Close()
+
+	total, err := redis.Int(conn.Do("ZCARD", leaderboardKey(b)))
 	if err != nil {
-		log.Println(err)
-		panic(err)
+		return nil, 0, err
+	}
+
+	entries := []LeaderboardEntry{}
+	if limit == 0 || offset >= total {
+		return entries, total, nil
+	}
+
+	reply, err := redis.Values(conn.Do("ZREVRANGE", leaderboardKey(b), offset, offset+limit-1, "WITHSCORES"))
+	if err != nil {
+		return nil, 0, err
+	}
+	for i := 0; i+1 < len(reply); i += 2 {
+		alias, err := redis.String(reply[i], nil)
+		if err != nil {
+			return nil, 0, err
+		}
+		score, err := redis.Int(reply[i+1], nil)
+		if err != nil {
+			return nil, 0, err
+		}
+		entries = append(entries, LeaderboardEntry{Rank: offset + i/2 + 1, Alias: alias, Score: score})
 	}
+	return entries, total, nil
 }
@@ -1,9 +1,11 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"reflect"
 	"testing"
 
 	"github.com/gomodule/redigo/redis"
@@ -15,20 +17,18 @@ func TestAddWaitingMatchSavesMatchAndWaitingId(t *testing.T) {
 	conn := redigomock.NewConn()
 	repo := newMatchRepo(&redis.Pool{
 		Dial: func() (redis.Conn, error) {
-			return conn, nil
+			return contextMock{conn}, nil
 		},
-	})
+	}, testConfig.Redis)
 
 	m := Match{Id: uuid.NewString()}
 	matchValue, _ := json.Marshal(m)
-	matchKey := fmt.Sprintf("match:%v", m.Id)
+	matchKey := fmt.Sprintf("match:{%v}", m.Id)
 
-	conn.Command("MULTI").Expect("OK")
 	conn.Command("SET", matchKey, matchValue).Expect("OK")
 	conn.Command("SADD", "waiting_match", m.Id).Expect("OK")
-	conn.Command("EXEC").Expect("OK")
 
-	repo.AddWaitingMatch(&m)
+	repo.AddWaitingMatch(context.Background(), &m)
 
 	if err := conn.ExpectationsWereMet(); err != nil {
 		t.Fatalf("expectations were not met: %v", err)
@@ -40,17 +40,17 @@ func TestGet(t *testing.T) {
 	conn := redigomock.NewConn()
 	repo := newMatchRepo(&redis.Pool{
 		Dial: func() (redis.Conn, error) {
-			return conn, nil
+			return contextMock{conn}, nil
 		},
-	})
+	}, testConfig.Redis)
 
 	m := Match{Id: uuid.NewString()}
 
 	matchValue, _ := json.Marshal(m)
-	matchKey := fmt.Sprintf("match:%v", m.Id)
+	matchKey := fmt.Sprintf("match:{%v}", m.Id)
 	conn.Command("GET", matchKey).Expect(matchValue)
 
-	repo.Get(m.Id)
+	repo.Get(context.Background(), m.Id)
 
 	if err := conn.ExpectationsWereMet(); err != nil {
 		t.Fatalf("expectations were not met: %v", err)
@@ -62,16 +62,16 @@ func TestGetFail(t *testing.T) {
 	conn := redigomock.NewConn()
 	repo := newMatchRepo(&redis.Pool{
 		Dial: func() (redis.Conn, error) {
-			return conn, nil
+			return contextMock{conn}, nil
 		},
-	})
+	}, testConfig.Redis)
 
 	mId := uuid.NewString()
 
-	matchKey := fmt.Sprintf("match:%v", mId)
+	matchKey := fmt.Sprintf("match:{%v}", mId)
 	conn.Command("GET", matchKey).ExpectError(errors.New("erro"))
 
-	_, err := repo.Get(mId)
+	_, err := repo.Get(context.Background(), mId)
 	if err == nil {
 		t.Fatalf("error expected")
 	}
@@ -82,22 +82,41 @@ func TestGetFail(t *testing.T) {
 
 }
 
+func TestGetLegacyMatch(t *testing.T) {
+	conn := redigomock.NewConn()
+	repo := newMatchRepo(&redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			return contextMock{conn}, nil
+		},
+	}, testConfig.Redis)
+
+	m := Match{Id: uuid.NewString(), P1: uuid.NewString()}
+	matchValue, _ := json.Marshal(m)
+	conn.Command("GET", fmt.Sprintf("match:{%v}", m.Id)).Expect(nil)
+	conn.Command("GET", fmt.Sprintf("match:%v", m.Id)).Expect(matchValue)
+
+	legacy, err := repo.Get(context.Background(), m.Id)
+	if err != nil || legacy.P1 != m.P1 {
+		t.Fatalf("expected the match saved by an older version but got %+v, %v", legacy, err)
+	}
+}
+
 func TestGetWaitingMatch(t *testing.T) {
 	conn := redigomock.NewConn()
 	repo := newMatchRepo(&redis.Pool{
 		Dial: func() (redis.Conn, error) {
-			return conn, nil
+			return contextMock{conn}, nil
 		},
-	})
+	}, testConfig.Redis)
 
 	m := Match{Id: uuid.NewString()}
 	conn.Command("SPOP", "waiting_match").Expect(m.Id)
 
 	matchValue, _ := json.Marshal(m)
-	matchKey := fmt.Sprintf("match:%v", m.Id)
+	matchKey := fmt.Sprintf("match:{%v}", m.Id)
 	conn.Command("GET", matchKey).Expect(matchValue)
 
-	repo.GetWaitingMatch()
+	repo.GetWaitingMatch(context.Background())
 
 	if err := conn.ExpectationsWereMet(); err != nil {
 		t.Fatalf("expectations were not met: %v", err)
@@ -109,13 +128,13 @@ func TestGetWaitingMatchFail(t *testing.T) {
 	conn := redigomock.NewConn()
 	repo := newMatchRepo(&redis.Pool{
 		Dial: func() (redis.Conn, error) {
-			return conn, nil
+			return contextMock{conn}, nil
 		},
-	})
+	}, testConfig.Redis)
 
 	conn.Command("SPOP", "waiting_match").ExpectError(errors.New("error"))
 
-	_, err := repo.GetWaitingMatch()
+	_, err := repo.GetWaitingMatch(context.Background())
 	if err == nil {
 		t.Fatalf("error expected")
 	}
@@ -130,17 +149,17 @@ func TestSaveMatch(t *testing.T) {
 	conn := redigomock.NewConn()
 	repo := newMatchRepo(&redis.Pool{
 		Dial: func() (redis.Conn, error) {
-			return conn, nil
+			return contextMock{conn}, nil
 		},
-	})
+	}, testConfig.Redis)
 
 	m := Match{Id: uuid.NewString()}
 
 	matchValue, _ := json.Marshal(m)
-	matchKey := fmt.Sprintf("match:%v", m.Id)
+	matchKey := fmt.Sprintf("match:{%v}", m.Id)
 	conn.Command("SET", matchKey, matchValue).Expect("Ok!")
 
-	repo.Save(&m)
+	repo.Save(context.Background(), &m)
 
 	if err := conn.ExpectationsWereMet(); err != nil {
 		t.Fatalf("expectations were not met: %v", err)
@@ -152,18 +171,42 @@ func TestLockMatch(t *testing.T) {
 	conn := redigomock.NewConn()
 	repo := newMatchRepo(&redis.Pool{
 		Dial: func() (redis.Conn, error) {
-			return conn, nil
+			return contextMock{conn}, nil
 		},
-	})
+	}, testConfig.Redis)
 
 	mId := uuid.NewString()
 
-	conn.Command("SET", mId, "locked", "EX", 1, "NX").Expect("Ok!")
+	var args []interface{}
+	conn.GenericCommand("SET").Handle(func(a []interface{}) (interface{}, error) {
+		args = a
+		return "OK", nil
+	})
 
-	repo.Lock(mId)
+	token, err := repo.Lock(context.Background(), mId)
+	if err != nil || token == "" {
+		t.Fatalf("expected a lock token but got %q, %v", token, err)
+	}
 
-	if err := conn.ExpectationsWereMet(); err != nil {
-		t.Fatalf("expectations were not met: %v", err)
+	expected := fmt.Sprint([]interface{}{fmt.Sprintf("match:{%v}:lock", mId), token, "EX", 10, "NX"})
+	if fmt.Sprint(args) != expected {
+		t.Fatalf("expected SET %v but got %v", expected, args)
+	}
+
+}
+
+func TestLockLockedMatch(t *testing.T) {
+	conn := redigomock.NewConn()
+	repo := newMatchRepo(&redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			return contextMock{conn}, nil
+		},
+	}, testConfig.Redis)
+
+	conn.GenericCommand("SET").Expect(nil)
+
+	if _, err := repo.Lock(context.Background(), uuid.NewString()); err != ErrMatchLocked {
+		t.Fatalf("expected ErrMatchLocked but got %v", err)
 	}
 
 }
@@ -172,15 +215,15 @@ func TestFailLockMatch(t *testing.T) {
 	conn := redigomock.NewConn()
 	repo := newMatchRepo(&redis.Pool{
 		Dial: func() (redis.Conn, error) {
-			return conn, nil
+			return contextMock{conn}, nil
 		},
-	})
+	}, testConfig.Redis)
 
 	mId := uuid.NewString()
 
-	conn.Command("SET", mId, "locked", "EX", 1, "NX").ExpectError(errors.New("error"))
+	conn.GenericCommand("SET").ExpectError(errors.New("error"))
 
-	err := repo.Lock(mId)
+	_, err := repo.Lock(context.Background(), mId)
 	if err == nil {
 		t.Fatalf("error expected")
 	}
@@ -190,3 +233,424 @@ func TestFailLockMatch(t *testing.T) {
 	}
 
 }
+
+func TestUnlockChecksOwner(t *testing.T) {
+	conn := redigomock.NewConn()
+	repo := newMatchRepo(&redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			return contextMock{conn}, nil
+		},
+	}, testConfig.Redis)
+
+	mId := uuid.NewString()
+	lockKey := fmt.Sprintf("match:{%v}:lock", mId)
+
+	conn.Command("EVALSHA", unlockScript.Hash(), 1, lockKey, "mine").Expect(int64(1))
+	conn.Command("EVALSHA", unlockScript.Hash(), 1, lockKey, "theirs").Expect(int64(0))
+
+	if err := repo.Unlock(context.Background(), mId, "mine"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := repo.Unlock(context.Background(), mId, "theirs"); err != ErrLockLost {
+		t.Fatalf("expected ErrLockLost but got %v", err)
+	}
+
+}
+
+func TestExtendLock(t *testing.T) {
+	conn := redigomock.NewConn()
+	repo := newMatchRepo(&redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			return contextMock{conn}, nil
+		},
+	}, testConfig.Redis)
+
+	mId := uuid.NewString()
+	lockKey := fmt.Sprintf("match:{%v}:lock", mId)
+
+	conn.Command("EVALSHA", extendLockScript.Hash(), 1, lockKey, "mine", 10).Expect(int64(1))
+	conn.Command("EVALSHA", extendLockScript.Hash(), 1, lockKey, "expired", 10).Expect(int64(0))
+
+	if err := repo.ExtendLock(context.Background(), mId, "mine"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := repo.ExtendLock(context.Background(), mId, "expired"); err != ErrLockLost {
+		t.Fatalf("expected ErrLockLost but got %v", err)
+	}
+
+}
+
+func TestAddTournamentSavesTournamentAndId(t *testing.T) {
+	conn := redigomock.NewConn()
+	repo := newTournamentRepo(&redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			return contextMock{conn}, nil
+		},
+	}, testConfig.Redis)
+
+	tr := Tournament{Id: uuid.NewString(), Format: SwissFormat}
+	tournamentValue, _ := json.Marshal(tr)
+	tournamentKey := fmt.Sprintf("tournament:{%v}", tr.Id)
+
+	conn.Command("SET", tournamentKey, tournamentValue).Expect("OK")
+	conn.Command("SADD", "tournaments", tr.Id).Expect("OK")
+
+	repo.AddTournament(context.Background(), &tr)
+
+	if err := conn.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations were not met: %v", err)
+	}
+}
+
+func TestGetMissingTournament(t *testing.T) {
+	conn := redigomock.NewConn()
+	repo := newTournamentRepo(&redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			return contextMock{conn}, nil
+		},
+	}, testConfig.Redis)
+
+	id := uuid.NewString()
+	conn.Command("GET", fmt.Sprintf("tournament:{%v}", id)).Expect(nil)
+	conn.Command("GET", fmt.Sprintf("tournament:%v", id)).Expect(nil)
+
+	_, err := repo.GetTournament(context.Background(), id)
+	if err != ErrTournamentNotFound {
+		t.Fatalf("expected ErrTournamentNotFound but got %v", err)
+	}
+}
+
+func TestUpdateTournamentMovesLegacyTournament(t *testing.T) {
+	conn := redigomock.NewConn()
+	repo := newTournamentRepo(&redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			return contextMock{conn}, nil
+		},
+	}, testConfig.Redis)
+
+	tr := Tournament{Id: uuid.NewString(), Format: SwissFormat}
+	tournamentValue, _ := json.Marshal(tr)
+	tournamentKey := fmt.Sprintf("tournament:{%v}", tr.Id)
+
+	conn.Command("WATCH", tournamentKey).Expect("OK")
+	conn.Command("GET", tournamentKey).Expect(nil).Expect(tournamentValue)
+	conn.Command("UNWATCH").Expect("OK")
+	conn.Command("GET", fmt.Sprintf("tournament:%v", tr.Id)).Expect(tournamentValue)
+	moved := conn.Command("SET", tournamentKey, string(tournamentValue), "NX").Expect("OK")
+	conn.Command("MULTI").Expect("OK")
+	conn.GenericCommand("SET").Expect("OK")
+	conn.Command("EXEC").Expect([]interface{}{"OK"})
+
+	updated, err := repo.UpdateTournament(context.Background(), tr.Id, func(t *Tournament) error {
+		t.Round = 1
+		return nil
+	})
+	if err != nil || updated.Round != 1 {
+		t.Fatalf("expected the legacy tournament to be updated but got %+v, %v", updated, err)
+	}
+	if conn.Stats(moved) != 1 {
+		t.Fatal("the legacy tournament should be saved under its new key")
+	}
+}
+
+func TestUpdateTournamentIndexesNewMatches(t *testing.T) {
+	conn := redigomock.NewConn()
+	repo := newTournamentRepo(&redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			return contextMock{conn}, nil
+		},
+	}, testConfig.Redis)
+
+	tr := Tournament{Id: uuid.NewString(), Format: SwissFormat}
+	tournamentValue, _ := json.Marshal(tr)
+	tournamentKey := fmt.Sprintf("tournament:{%v}", tr.Id)
+	matchId := uuid.NewString()
+
+	conn.Command("WATCH", tournamentKey).Expect("OK")
+	conn.Command("GET", tournamentKey).Expect(tournamentValue)
+	conn.Command("SET", fmt.Sprintf("tournament_match:{%v}", matchId), tr.Id).Expect("OK")
+	conn.Command("MULTI").Expect("OK")
+	conn.GenericCommand("SET").Expect("OK")
+	conn.Command("EXEC").Expect([]interface{}{"OK"})
+
+	updated, err := repo.UpdateTournament(context.Background(), tr.Id, func(t *Tournament) error {
+		t.Games = append(t.Games, TournamentGame{MatchId: matchId})
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(updated.Games) != 1 {
+		t.Fatalf("update was not applied: %v", updated)
+	}
+
+	if err := conn.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations were not met: %v", err)
+	}
+}
+
+func TestUpdateSeriesRetriesWhenItChanged(t *testing.T) {
+	conn := redigomock.NewConn()
+	repo := newSeriesRepo(&redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			return contextMock{conn}, nil
+		},
+	}, testConfig.Redis)
+
+	s := Series{Id: uuid.NewString(), BestOf: 3, Status: runningStatus}
+	seriesValue, _ := json.Marshal(s)
+	seriesKey := fmt.Sprintf("series:{%v}", s.Id)
+
+	conn.Command("WATCH", seriesKey).Expect("OK")
+	conn.Command("GET", seriesKey).Expect(seriesValue)
+	conn.Command("MULTI").Expect("OK")
+	conn.GenericCommand("SET").Expect("OK")
+	// changed after WATCH the first time
+	conn.Command("EXEC").Expect(nil).Expect([]interface{}{"OK"})
+
+	calls := 0
+	updated, err := repo.UpdateSeries(context.Background(), s.Id, func(s *Series) error {
+		calls++
+		s.Wins[0]++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if calls != 2 || updated.Wins != [2]int{1, 0} {
+		t.Fatalf("expected the update to be applied again on the series read again, got %+v after %v calls", updated, calls)
+	}
+}
+
+func TestUpdateTournamentDoesNotSaveOnError(t *testing.T) {
+	conn := redigomock.NewConn()
+	repo := newTournamentRepo(&redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			return contextMock{conn}, nil
+		},
+	}, testConfig.Redis)
+
+	tr := Tournament{Id: uuid.NewString(), Format: SwissFormat}
+	tournamentValue, _ := json.Marshal(tr)
+	tournamentKey := fmt.Sprintf("tournament:{%v}", tr.Id)
+
+	conn.Command("WATCH", tournamentKey).Expect("OK")
+	conn.Command("GET", tournamentKey).Expect(tournamentValue)
+	conn.Command("UNWATCH").Expect("OK")
+	multi := conn.Command("MULTI").Expect("OK")
+
+	_, err := repo.UpdateTournament(context.Background(), tr.Id, func(t *Tournament) error {
+		return ErrRegistrationClosed
+	})
+	if err != ErrRegistrationClosed {
+		t.Fatalf("expected ErrRegistrationClosed but got %v", err)
+	}
+
+	if conn.Stats(multi) != 0 {
+		t.Fatal("tournament should not be saved")
+	}
+}
+
+func TestAddFinishedMatchIndexesBothPlayers(t *testing.T) {
+	conn := redigomock.NewConn()
+	repo := newPlayerRepo(&redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			return contextMock{conn}, nil
+		},
+	}, testConfig.Redis)
+
+	m := finishedMatch("p1", "p2", newBoard(), nil, nil)
+	matchValue, _ := json.Marshal(m)
+
+	conn.Command("SET", fmt.Sprintf("match:{%v}", m.Id), matchValue).Expect("OK")
+	h1 := conn.Command("HSET", "player:{p1}:history", m.Id, matchValue).Expect(int64(1))
+	h2 := conn.Command("HSET", "player:{p2}:history", m.Id, matchValue).Expect(int64(1))
+	p1 := conn.Command("ZADD", "player:{p1}:matches", m.FinishedAt.UnixMilli(), m.Id).Expect(int64(1))
+	p2 := conn.Command("ZADD", "player:{p2}:matches", m.FinishedAt.UnixMilli(), m.Id).Expect(int64(1))
+
+	if err := repo.AddFinishedMatch(context.Background(), m); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if conn.Stats(p1) != 1 || conn.Stats(p2) != 1 || conn.Stats(h1) != 1 || conn.Stats(h2) != 1 {
+		t.Fatal("the match should be in the history of both players")
+	}
+}
+
+func TestGetPlayerMatchesReadsAPage(t *testing.T) {
+	conn := redigomock.NewConn()
+	repo := newPlayerRepo(&redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			return contextMock{conn}, nil
+		},
+	}, testConfig.Redis)
+
+	m := Match{Id: uuid.NewString()}
+	matchValue, _ := json.Marshal(m)
+
+	conn.Command("ZCARD", "player:{p1}:matches").Expect(int64(30))
+	page := conn.Command("ZREVRANGE", "player:{p1}:matches", 20, 29).Expect([]interface{}{[]byte(m.Id)})
+	conn.Command("HMGET", "player:{p1}:history", m.Id).Expect([]interface{}{matchValue})
+
+	matches, total, err := repo.GetPlayerMatches(context.Background(), "p1", 20, 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if conn.Stats(page) != 1 || total != 30 || len(matches) != 1 || matches[0].Id != m.Id {
+		t.Fatalf("expected the page from the newest 20th match, got %v of %v", matches, total)
+	}
+}
+
+func TestGetPlayerMatchesReadsOlderMatchesOneByOne(t *testing.T) {
+	conn := redigomock.NewConn()
+	repo := newPlayerRepo(&redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			return contextMock{conn}, nil
+		},
+	}, testConfig.Redis)
+
+	kept, older := Match{Id: uuid.NewString()}, Match{Id: uuid.NewString()}
+	keptValue, _ := json.Marshal(kept)
+	olderValue, _ := json.Marshal(older)
+
+	conn.Command("ZCARD", "player:{p1}:matches").Expect(int64(2))
+	conn.Command("ZREVRANGE", "player:{p1}:matches", 0, 1).Expect([]interface{}{[]byte(kept.Id), []byte(older.Id)})
+	conn.Command("HMGET", "player:{p1}:history", kept.Id, older.Id).Expect([]interface{}{keptValue, nil})
+	get := conn.Command("GET", fmt.Sprintf("match:{%v}", older.Id)).Expect(olderValue)
+
+	matches, _, err := repo.GetPlayerMatches(context.Background(), "p1", 0, 2)
+	if err != nil || len(matches) != 2 || matches[0].Id != kept.Id || matches[1].Id != older.Id {
+		t.Fatalf("expected both matches but got %v, %v", matches, err)
+	}
+	if conn.Stats(get) != 1 {
+		t.Fatal("only the match missing from the history should be read on its own")
+	}
+}
+
+func TestAddRatingStartsFromTheInitialRating(t *testing.T) {
+	conn := redigomock.NewConn()
+	repo := newPlayerRepo(&redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			return contextMock{conn}, nil
+		},
+	}, testConfig.Redis)
+
+	initial := conn.Command("SET", "player:{p1}:rating", initialRating, "NX").Expect("OK")
+	conn.Command("INCRBY", "player:{p1}:rating", -16).Expect(int64(1484))
+
+	rating, err := repo.AddRating(context.Background(), "p1", -16)
+	if err != nil || rating != 1484 || conn.Stats(initial) != 1 {
+		t.Fatalf("expected 1484 but got %v, %v", rating, err)
+	}
+
+	conn.Command("GET", "player:{p2}:rating").ExpectError(redis.ErrNil)
+	if rating, err := repo.GetRating(context.Background(), "p2"); err != nil || rating != initialRating {
+		t.Fatalf("expected players never rated to have the initial rating, got %v, %v", rating, err)
+	}
+}
+
+func TestRematchIsKeptNextToItsMatch(t *testing.T) {
+	conn := redigomock.NewConn()
+	repo := newMatchRepo(&redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			return contextMock{conn}, nil
+		},
+	}, testConfig.Redis)
+
+	mId := uuid.NewString()
+	conn.Command("GET", fmt.Sprintf("match:{%v}:rematch", mId)).ExpectError(redis.ErrNil)
+	if r, err := repo.GetRematch(context.Background(), mId); r != nil || err != nil {
+		t.Fatalf("expected no rematch but got %v, %v", r, err)
+	}
+
+	r := Rematch{MatchId: mId, OfferedBy: "p1"}
+	rematchValue, _ := json.Marshal(r)
+	save := conn.Command("SET", fmt.Sprintf("match:{%v}:rematch", mId), rematchValue).Expect("OK")
+	if err := repo.SaveRematch(context.Background(), &r); err != nil || conn.Stats(save) != 1 {
+		t.Fatalf("expected the rematch to be saved, got %v", err)
+	}
+}
+
+func TestGetLeaderboardRanksAPage(t *testing.T) {
+	conn := redigomock.NewConn()
+	repo := newPlayerRepo(&redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			return contextMock{conn}, nil
+		},
+	}, testConfig.Redis)
+
+	b := Leaderboard{By: WinsLeaderboard, Variant: 4, Window: "2026-10"}
+	conn.Command("ZCARD", "leaderboard:{wins:4:2026-10}").Expect(int64(12))
+	conn.Command("ZREVRANGE", "leaderboard:{wins:4:2026-10}", 10, 19, "WITHSCORES").Expect([]interface{}{[]byte("a1"), []byte("3"), []byte("a2"), []byte("0")})
+
+	entries, total, err := repo.GetLeaderboard(context.Background(), b, 10, 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []LeaderboardEntry{{Rank: 11, Alias: "a1", Score: 3}, {Rank: 12, Alias: "a2", Score: 0}}
+	if total != 12 || !reflect.DeepEqual(entries, expected) {
+		t.Fatalf("expected %v of 12 but got %v of %v", expected, entries, total)
+	}
+}
+
+func TestPing(t *testing.T) {
+	conn := redigomock.NewConn()
+	repo := newMatchRepo(&redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			return contextMock{conn}, nil
+		},
+	}, testConfig.Redis)
+
+	conn.Command("PING").ExpectError(errors.New("connection refused"))
+
+	if err := repo.Ping(context.Background()); err == nil {
+		t.Fatal("ping should fail when redis does")
+	}
+}
+
+func TestCanceledContextSkipsCommand(t *testing.T) {
+	conn := redigomock.NewConn()
+	repo := newMatchRepo(&redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			return contextMock{conn}, nil
+		},
+	}, testConfig.Redis)
+
+	mId := uuid.NewString()
+	cmd := conn.Command("GET", fmt.Sprintf("match:{%v}", mId)).Expect("{}")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := repo.Get(ctx, mId)
+
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled but got %v", err)
+	}
+
+	if conn.Stats(cmd) != 0 {
+		t.Fatal("command should not be sent once the context is done")
+	}
+}
+
+// contextMock lets redigomock, which does not know about contexts, serve
+// DoContext.
+type contextMock struct {
+	*redigomock.Conn
+}
+
+func (c contextMock) DoContext(ctx context.Context, commandName string, args ...interface{}) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.Do(commandName, args...)
+}
+
+func (c contextMock) ReceiveContext(ctx context.Context) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.Receive()
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/dacruz/mancala/game"
+	"github.com/google/uuid"
+)
+
+// go test -run Random -rules.games 1000000 plays a million games.
+var randomGames = flag.Int("rules.games", 2000, "random games played by the rules tests")
+
+const (
+	// random games so far ended in less than a hundred moves
+	maxGameMoves int = 10000
+	maxLaps      int = 1000
+)
+
+// TestRandomGamesKeepInvariants plays random legal games through
+// executeMove, checking every move.
+func TestRandomGamesKeepInvariants(t *testing.T) {
+	games := *randomGames
+	if testing.Short() {
+		games = 100
+	}
+
+	rnd := rand.New(rand.NewSource(1))
+	for g := 0; g < games; g++ {
+		stones := 1 + rnd.Intn(game.Stones*2)
+		playRandomGame(t, rnd, stones)
+	}
+}
+
+func playRandomGame(t *testing.T, rnd *rand.Rand, stones int) {
+	d := &MancalaDealer{}
+	m := Match{Id: uuid.NewString(), P1: uuid.NewString(), P2: uuid.NewString(), Board: MancalaBoard(game.NewBoardOf(stones))}
+	m.Turn = m.P1
+
+	for moves := 0; ; moves++ {
+		if moves > maxGameMoves {
+			t.Fatalf("game with %v stones did not end after %v moves: %v", stones, maxGameMoves, m.Board)
+		}
+
+		legal := d.LegalMoves(m, m.Turn)
+		if game.Over(game.Board(m.Board)) {
+			if len(legal) != 0 {
+				t.Fatalf("finished game has legal moves %v: %v", legal, m.Board)
+			}
+			return
+		}
+		if len(legal) == 0 {
+			t.Fatalf("game is not over but has no legal moves: %v", m.Board)
+		}
+
+		pit := legal[rnd.Intn(len(legal))]
+		if err := checkMove(m, pit, m.Turn); err != nil {
+			t.Fatalf("legal move %v rejected: %v", pit, err)
+		}
+
+		before := copyMatch(m)
+		moved, err := executeMove(Move{ctx: context.Background(), pit: pit, match: copyMatch(m)})
+		if err != nil {
+			t.Fatalf("move %v on %v did not end: %v", pit, before.Board, err)
+		}
+		m = moved.match
+		checkInvariants(t, before, pit, m, stones)
+
+		mover := m.Turn
+		m.passTurn()
+		if m.Turn == mover {
+			t.Fatalf("the turn should pass after every move: %v", before.Board)
+		}
+	}
+}
+
+// checkInvariants fails if after does not follow from sowing pit of before.
+func checkInvariants(t *testing.T, before Match, pit int, after Match, stones int) {
+	t.Helper()
+	mover := before.side(before.Turn)
+
+	total := 0
+	for side := range after.Board {
+		for i, s := range after.Board[side] {
+			if s < 0 {
+				t.Fatalf("pit %v of side %v is negative after sowing %v of %v: %v", i, side, pit, before.Board, after.Board)
+			}
+			total += s
+		}
+	}
+	if total != 2*game.Pits*stones {
+		t.Fatalf("%v stones after sowing %v of %v, expected %v: %v", total, pit, before.Board, 2*game.Pits*stones, after.Board)
+	}
+
+	if after.Board[1-mover][game.Store] != before.Board[1-mover][game.Store] {
+		t.Fatalf("sowing %v of %v changed the opponent's store: %v", pit, before.Board, after.Board)
+	}
+	if after.Board[mover][game.Store] < before.Board[mover][game.Store] {
+		t.Fatalf("sowing %v of %v took stones from the store: %v", pit, before.Board, after.Board)
+	}
+	if after.Turn != before.Turn {
+		t.Fatalf("sowing changed the turn")
+	}
+
+	expected, ok := referencePlay(before.Board, mover, pit)
+	if !ok || !reflect.DeepEqual(MancalaBoard(expected), after.Board) {
+		t.Fatalf("sowing %v of %v gave %v, the reference gives %v", pit, before.Board, after.Board, expected)
+	}
+}
+
+// TestExecuteMoveMatchesReference plays every pit of random boards, legal
+// or not, on both implementations.
+func TestExecuteMoveMatchesReference(t *testing.T) {
+	rnd := rand.New(rand.NewSource(2))
+	for i := 0; i < 100000; i++ {
+		board := MancalaBoard{make([]int, game.Pits+1), make([]int, game.Pits+1)}
+		for side := range board {
+			for pit := range board[side] {
+				board[side][pit] = rnd.Intn(3) * rnd.Intn(8)
+			}
+		}
+		compareWithReference(t, board, rnd.Intn(2), rnd.Intn(game.Pits))
+	}
+}
+
+// FuzzExecuteMove compares executeMove and the reference on any board. The
+// first 14 bytes are the pits and stores, the next one the player.
+func FuzzExecuteMove(f *testing.F) {
+	f.Add([]byte{6, 6, 6, 6, 6, 6, 0, 6, 6, 6, 6, 6, 6, 0, 0}, uint8(0))
+	f.Add([]byte{0, 0, 0, 0, 1, 1, 0, 0, 0, 0, 0, 0, 1, 0, 0}, uint8(4))
+	f.Add([]byte{1, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 1, 10, 0, 0}, uint8(4))
+	f.Add([]byte{0, 0, 0, 0, 0, 1, 0, 5, 0, 0, 0, 0, 1, 5, 1}, uint8(5))
+
+	f.Fuzz(func(t *testing.T, bs []byte, pit uint8) {
+		if len(bs) < 2*(game.Pits+1)+1 {
+			return
+		}
+
+		board := MancalaBoard{make([]int, game.Pits+1), make([]int, game.Pits+1)}
+		for i := 0; i < 2*(game.Pits+1); i++ {
+			// keeps the boards small enough to be played by people
+			board[i/(game.Pits+1)][i%(game.Pits+1)] = int(bs[i] % 32)
+		}
+		compareWithReference(t, board, int(bs[2*(game.Pits+1)]%2), int(pit)%game.Pits)
+	})
+}
+
+func compareWithReference(t *testing.T, board MancalaBoard, side int, pit int) {
+	t.Helper()
+
+	m := Match{Id: "fuzz", P1: "p1", P2: "p2", Turn: "p1", Board: board}
+	if side == 1 {
+		m.Turn = "p2"
+	}
+	before := copyMatch(m)
+
+	moved, err := executeMove(Move{ctx: context.Background(), pit: pit, match: copyMatch(m)})
+	expected, ok := referencePlay(before.Board, side, pit)
+
+	if (err == nil) != ok {
+		t.Fatalf("sowing %v of %v for side %v: executeMove says %v, the reference %v", pit, before.Board, side, err, ok)
+	}
+	if ok && !reflect.DeepEqual(MancalaBoard(expected), moved.match.Board) {
+		t.Fatalf("sowing %v of %v for side %v gave %v, the reference gives %v", pit, before.Board, side, moved.match.Board, expected)
+	}
+}
+
+// referencePlay is a second, independent reading of the rules, walking the
+// stones pit by pit instead of on a linear board:
+//   - stones are sown counterclockwise, skipping the opponent's store
+//   - a move ending in a non-empty pit of the player's side goes on with the
+//     stones of that pit
+//   - a move ending in an empty pit of the player's side captures that stone
+//     and the opponent's pit with the same number
+//
+// It returns false for an empty pit and for moves that do not end.
+func referencePlay(b MancalaBoard, mover int, pit int) ([][]int, bool) {
+	board := [][]int{append([]int{}, b[0]...), append([]int{}, b[1]...)}
+	if board[mover][pit] == 0 {
+		return nil, false
+	}
+
+	side, i := mover, pit
+	for lap := 0; lap < maxLaps; lap++ {
+		stones := board[side][i]
+		board[side][i] = 0
+		for ; stones > 0; stones-- {
+			side, i = nextPit(side, i, mover)
+			board[side][i]++
+		}
+
+		if side != mover || i == game.Store {
+			return board, true
+		}
+		if board[side][i] == 1 {
+			board[mover][game.Store] += board[1-mover][i] + 1
+			board[mover][i] = 0
+			board[1-mover][i] = 0
+			return board, true
+		}
+	}
+	return nil, false
+}
+
+// nextPit is the pit after i of side when mover sows.
+func nextPit(side int, i int, mover int) (int, int) {
+	switch {
+	case i < game.Pits-1:
+		return side, i + 1
+	case i == game.Pits-1 && side == mover:
+		return side, game.Store
+	default:
+		// from the opponent's last pit or the mover's store
+		return 1 - side, 0
+	}
+}
+
+func copyMatch(m Match) Match {
+	m.Board = MancalaBoard{append([]int{}, m.Board[0]...), append([]int{}, m.Board[1]...)}
+	return m
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+const (
+	waitingStatus = "waiting"
+
+	// most games a series can be the best of
+	maxBestOf = 99
+)
+
+var (
+	ErrSeriesNotFound = errors.New("series not found")
+	ErrInvalidBestOf  = errors.New("a series is the best of an odd number of games")
+	ErrSeriesFull     = errors.New("series has two players already")
+)
+
+// Series is the best of BestOf games between two players, who take turns
+// to start. Drawn games are replayed, so the series is over once a player
+// wins most of them.
+type Series struct {
+	Id     string
+	BestOf int
+	// in the order they joined, the first one starting the first game
+	Players []string
+	// of each player
+	Wins  [2]int
+	Draws int
+	// oldest first, the last one being played while the series is running
+	MatchIds []string
+	Status   string
+}
+
+// winner returns the index in Players of the winner, or -1 while the
+// series is not over.
+func (s Series) winner() int {
+	for i, wins := range s.Wins {
+		if wins > s.BestOf/2 {
+			return i
+		}
+	}
+	return -1
+}
+
+// game returns the number of the match in the series, from 1, or 0 if the
+// match is not one of its games.
+func (s Series) game(matchId string) int {
+	for i, id := range s.MatchIds {
+		if id == matchId {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// side returns the index of the player in Players.
+func (s Series) side(playerId string) int {
+	if len(s.Players) > 1 && s.Players[1] == playerId {
+		return 1
+	}
+	return 0
+}
+
+// Referee plays series between two players, starting a match for each of
+// their games.
+type Referee interface {
+	// CreateSeries creates a series waiting for a second player and returns
+	// the id of the first one.
+	CreateSeries(ctx context.Context, bestOf int) (*Series, string, error)
+	GetSeries(context.Context, string) (*Series, error)
+	// JoinSeries adds the second player to the series, starting its first
+	// game, and returns their id.
+	JoinSeries(context.Context, string) (*Series, string, error)
+	MatchFinished(context.Context, Match)
+}
+
+type SeriesReferee struct {
+	repo   SeriesRepo
+	dealer Dealer
+}
+
+func newReferee(r SeriesRepo, d Dealer) Referee {
+	return &SeriesReferee{repo: r, dealer: d}
+}
+
+func (r *SeriesReferee) CreateSeries(ctx context.Context, bestOf int) (*Series, string, error) {
+	if bestOf < 1 || bestOf%2 == 0 || bestOf > maxBestOf {
+		return nil, "", ErrInvalidBestOf
+	}
+
+	s := Series{Id: uuid.NewString(), BestOf: bestOf, Players: []string{uuid.NewString()}, MatchIds: []string{}, Status: waitingStatus}
+	if err := r.repo.AddSeries(ctx, &s); err != nil {
+		return nil, "", err
+	}
+	logger(ctx).Info("series created", "series_id", s.Id, "best_of", s.BestOf)
+
+	return &s, s.Players[0], nil
+}
+
+func (r *SeriesReferee) GetSeries(ctx context.Context, id string) (*Series, error) {
+	return r.repo.GetSeries(ctx, id)
+}
+
+// JoinSeries starts the first game of the series before adding it, so
+// the series never waits for a match that does not exist. When the series
+// is joined meanwhile, the match started is left unplayed.
+func (r *SeriesReferee) JoinSeries(ctx context.Context, id string) (*Series, string, error) {
+	s, err := r.repo.GetSeries(ctx, id)
+	if err != nil {
+		return nil, "", err
+	}
+	if s.Status != waitingStatus {
+		return nil, "", ErrSeriesFull
+	}
+
+	playerId := uuid.NewString()
+	m, err := r.dealer.StartSeriesMatch(ctx, s.Id, uuid.NewString(), s.Players[0], playerId)
+	if err != nil {
+		return nil, "", err
+	}
+
+	s, err = r.repo.UpdateSeries(ctx, id, func(s *Series) error {
+		if s.Status != waitingStatus {
+			return ErrSeriesFull
+		}
+		s.Players = append(s.Players, playerId)
+		s.MatchIds = []string{m.Id}
+		s.Status = runningStatus
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	logger(ctx).Info("series started", "series_id", s.Id)
+
+	return s, playerId, nil
+}
+
+// score adds the result of the match to the series, returning false if
+// it was scored already.
+func (s *Series) score(m Match) bool {
+	if s.Status != runningStatus || s.game(m.Id) != len(s.MatchIds) {
+		return false
+	}
+
+	switch result(m.Board, m.side(s.Players[0])) {
+	case 1:
+		s.Wins[0]++
+	case 0:
+		s.Wins[1]++
+	default:
+		s.Draws++
+	}
+	if s.winner() >= 0 {
+		s.Status = finishedStatus
+	}
+	return true
+}
+
+// MatchFinished scores the game of the match and starts the next one,
+// with the players on each other's side, unless the series is over.
+// Matches outside series are ignored. Like in JoinSeries, the next game
+// is started before it is added to the series; when it cannot be, the
+// match is left unscored.
+func (r *SeriesReferee) MatchFinished(ctx context.Context, m Match) {
+	if m.Series == "" {
+		return
+	}
+	ctx = withLogFields(ctx, "series_id", m.Series)
+
+	s, err := r.repo.GetSeries(ctx, m.Series)
+	if err != nil {
+		logger(ctx).Error("failed to score series match", "error", err)
+		return
+	}
+	next := ""
+	if scored := *s; scored.score(m) && scored.Status == runningStatus {
+		next = uuid.NewString()
+		if _, err := r.dealer.StartSeriesMatch(ctx, s.Id, next, m.P2, m.P1); err != nil {
+			logger(ctx).Error("failed to start series match", "match_id", next, "error", err)
+			return
+		}
+	}
+
+	s, err = r.repo.UpdateSeries(ctx, m.Series, func(s *Series) error {
+		if s.score(m) && s.Status == runningStatus && next != "" {
+			s.MatchIds = append(s.MatchIds, next)
+		}
+		return nil
+	})
+	if err != nil {
+		logger(ctx).Error("failed to score series match", "error", err)
+		return
+	}
+	logger(ctx).Info("series match scored", "wins", s.Wins, "draws", s.Draws, "status", s.Status)
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// testSeries is served by StubReferee, running its second game.
+var testSeries = Series{
+	Id:       uuid.NewString(),
+	BestOf:   3,
+	Players:  []string{uuid.NewString(), uuid.NewString()},
+	Wins:     [2]int{1, 0},
+	MatchIds: []string{uuid.NewString(), uuid.NewString()},
+	Status:   runningStatus,
+}
+
+var p1Wins = MancalaBoard{{0, 0, 0, 0, 0, 0, 40}, {0, 0, 0, 0, 0, 0, 32}}
+var draw = MancalaBoard{{0, 0, 0, 0, 0, 0, 36}, {0, 0, 0, 0, 0, 0, 36}}
+
+func newTestReferee() (*SeriesReferee, *RecordingDealer) {
+	dealer := &RecordingDealer{}
+	return &SeriesReferee{repo: &StubSeriesRepo{series: map[string]*Series{}}, dealer: dealer}, dealer
+}
+
+// finishNext finishes the last match started with board.
+func finishNext(r *SeriesReferee, d *RecordingDealer, board MancalaBoard) Match {
+	m := d.started[len(d.started)-1]
+	m.Board = board
+	r.MatchFinished(context.Background(), m)
+	return m
+}
+
+func TestCreateSeriesWithInvalidBestOf(t *testing.T) {
+	r, _ := newTestReferee()
+
+	for _, bestOf := range []int{-1, 0, 2, maxBestOf + 2} {
+		if _, _, err := r.CreateSeries(context.Background(), bestOf); err != ErrInvalidBestOf {
+			t.Fatalf("best of %v: expected ErrInvalidBestOf but got %v", bestOf, err)
+		}
+	}
+}
+
+func TestJoinSeriesStartsTheFirstGame(t *testing.T) {
+	r, d := newTestReferee()
+	s, first, _ := r.CreateSeries(context.Background(), 3)
+
+	s, second, err := r.JoinSeries(context.Background(), s.Id)
+	if err != nil || s.Status != runningStatus {
+		t.Fatalf("expected the series to start but got %+v, %v", s, err)
+	}
+	if len(d.started) != 1 || d.started[0].P1 != first || d.started[0].P2 != second || d.started[0].Series != s.Id {
+		t.Fatalf("expected the first game, started by the creator, but got %+v", d.started)
+	}
+
+	if _, _, err := r.JoinSeries(context.Background(), s.Id); err != ErrSeriesFull {
+		t.Fatalf("expected ErrSeriesFull but got %v", err)
+	}
+}
+
+func TestSeriesAlternatesAndEndsOnMajority(t *testing.T) {
+	r, d := newTestReferee()
+	s, first, _ := r.CreateSeries(context.Background(), 3)
+	r.JoinSeries(context.Background(), s.Id)
+
+	game1 := finishNext(r, d, p1Wins)
+	if len(d.started) != 2 || d.started[1].P1 != game1.P2 {
+		t.Fatalf("expected the second player to start the next game but got %+v", d.started)
+	}
+
+	// the creator is P2 of the second game, and draws are replayed
+	finishNext(r, d, draw)
+	if len(d.started) != 3 || d.started[2].P1 != first {
+		t.Fatalf("expected the draw to be replayed, the creator starting, but got %+v", d.started)
+	}
+
+	last := finishNext(r, d, p1Wins)
+	s, _ = r.GetSeries(context.Background(), s.Id)
+	if s.Status != finishedStatus || s.Wins != [2]int{2, 0} || s.Draws != 1 || s.winner() != 0 {
+		t.Fatalf("expected the creator to win 2-0 but got %+v", s)
+	}
+	if len(d.started) != 3 {
+		t.Fatalf("no game should start once the series is over, got %+v", d.started)
+	}
+
+	// a result is only scored once
+	r.MatchFinished(context.Background(), last)
+	if s, _ = r.GetSeries(context.Background(), s.Id); s.Wins != [2]int{2, 0} {
+		t.Fatalf("expected the result to be scored once but got %+v", s)
+	}
+}
+
+func TestJoinSeriesFailingToStartTheFirstGame(t *testing.T) {
+	r, d := newTestReferee()
+	s, _, _ := r.CreateSeries(context.Background(), 3)
+
+	d.startErr = errors.New("save failed")
+	if _, _, err := r.JoinSeries(context.Background(), s.Id); err != d.startErr {
+		t.Fatalf("expected the start error but got %v", err)
+	}
+	if s, _ := r.GetSeries(context.Background(), s.Id); s.Status != waitingStatus || len(s.Players) != 1 || len(s.MatchIds) != 0 {
+		t.Fatalf("expected the series to wait for a second player but got %+v", s)
+	}
+
+	d.startErr = nil
+	if _, _, err := r.JoinSeries(context.Background(), s.Id); err != nil {
+		t.Fatalf("expected the series to be joined on retry but got %v", err)
+	}
+}
+
+func TestSeriesFailingToStartTheNextGame(t *testing.T) {
+	r, d := newTestReferee()
+	s, _, _ := r.CreateSeries(context.Background(), 3)
+	r.JoinSeries(context.Background(), s.Id)
+
+	d.startErr = errors.New("save failed")
+	finishNext(r, d, p1Wins)
+
+	s, _ = r.GetSeries(context.Background(), s.Id)
+	if len(s.MatchIds) != 1 || s.Wins != [2]int{0, 0} {
+		t.Fatalf("expected no game to be added for a match not started but got %+v", s)
+	}
+}
+
+func TestMatchOutsideSeriesIsIgnored(t *testing.T) {
+	r, d := newTestReferee()
+
+	r.MatchFinished(context.Background(), Match{Id: uuid.NewString(), Board: p1Wins})
+
+	if len(d.started) != 0 {
+		t.Fatal("no match should be started")
+	}
+}
+
+func TestNewMatchSeriesResponse(t *testing.T) {
+	response := newMatchSeriesResponse(&testSeries, testSeries.MatchIds[0], testSeries.Players[1])
+
+	expected := MatchSeriesResponse{Id: testSeries.Id, BestOf: 3, Game: 1, Wins: 0, Losses: 1, Status: runningStatus, NextMatch: testSeries.MatchIds[1]}
+	if *response != expected {
+		t.Fatalf("expected %+v but got %+v", expected, *response)
+	}
+}
+
+func TestCreateSeries(t *testing.T) {
+	res := doJSONRequest("POST", "http://localhost:8080/api/v1/series", `{"best_of": 3}`, t)
+
+	series := SeriesResponse{}
+	json.NewDecoder(res.Body).Decode(&series)
+	if res.StatusCode != http.StatusCreated || series.Id != testSeries.Id || series.Me == nil || *series.Me != 0 {
+		t.Fatalf("expected 201 with the series of the creator, but got %v %+v", res.StatusCode, series)
+	}
+	if location := res.Header.Get("Location"); location != "/api/v1/series/"+testSeries.Id {
+		t.Fatalf("expected the location of the series, but got %v", location)
+	}
+
+	cookies := res.Cookies()
+	if len(cookies) != 1 || cookies[0].Name != playerCookieConst || cookies[0].Value != testSeries.Players[0] {
+		t.Fatalf("expected the player cookie of the creator, but got %v", cookies)
+	}
+}
+
+func TestCreateSeriesRequestWithInvalidBestOf(t *testing.T) {
+	res := doJSONRequest("POST", "http://localhost:8080/api/v1/series", `{"best_of": 4}`, t)
+
+	e := ErrorMessage{}
+	json.NewDecoder(res.Body).Decode(&e)
+	if res.StatusCode != http.StatusBadRequest || e.Code != "invalid_best_of" {
+		t.Fatalf("expected 400 invalid_best_of, but got %v %+v", res.StatusCode, e)
+	}
+}
+
+func TestGetSeries(t *testing.T) {
+	res := execute2xxRequest("GET", "http://localhost:8080/api/v1/series/"+testSeries.Id, t)
+
+	bs, _ := ioutil.ReadAll(res.Body)
+	series := SeriesResponse{}
+	if err := json.Unmarshal(bs, &series); err != nil {
+		t.Fatalf("invalid response: %v", string(bs))
+	}
+
+	if series.Wins != [2]int{1, 0} || len(series.Matches) != 2 || series.Me != nil || series.Winner != nil {
+		t.Fatalf("unexpected series: %+v", series)
+	}
+	for _, p := range testSeries.Players {
+		if strings.Contains(string(bs), p) {
+			t.Fatalf("player ids should not be sent: %v", string(bs))
+		}
+	}
+}
+
+func TestJoinFullSeries(t *testing.T) {
+	res := doJSONRequest("POST", "http://localhost:8080/api/v1/series/"+testSeries.Id+"/players", "", t)
+
+	e := ErrorMessage{}
+	json.NewDecoder(res.Body).Decode(&e)
+	if res.StatusCode != http.StatusConflict || e.Code != "series_full" {
+		t.Fatalf("expected 409 series_full, but got %v %+v", res.StatusCode, e)
+	}
+}
+
+func TestGetUnknownSeries(t *testing.T) {
+	res, err := http.Get("http://localhost:8080/api/v1/series/" + uuid.NewString())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer res.Body.Close()
+
+	e := ErrorMessage{}
+	json.NewDecoder(res.Body).Decode(&e)
+	if res.StatusCode != http.StatusNotFound || e.Code != "series_not_found" {
+		t.Fatalf("expected 404 series_not_found but got %v %+v", res.StatusCode, e)
+	}
+}
+
+type StubReferee struct{}
+
+func (r *StubReferee) CreateSeries(ctx context.Context, bestOf int) (*Series, string, error) {
+	if bestOf != 3 {
+		return nil, "", ErrInvalidBestOf
+	}
+	return &testSeries, testSeries.Players[0], nil
+}
+
+func (r *StubReferee) GetSeries(ctx context.Context, id string) (*Series, error) {
+	if id != testSeries.Id {
+		return nil, ErrSeriesNotFound
+	}
+	return &testSeries, nil
+}
+
+func (r *StubReferee) JoinSeries(ctx context.Context, id string) (*Series, string, error) {
+	if _, err := r.GetSeries(ctx, id); err != nil {
+		return nil, "", err
+	}
+	return nil, "", ErrSeriesFull
+}
+
+func (r *StubReferee) MatchFinished(ctx context.Context, m Match) {}
+
+type StubSeriesRepo struct {
+	series map[string]*Series
+}
+
+func (r *StubSeriesRepo) GetSeries(ctx context.Context, id string) (*Series, error) {
+	s, ok := r.series[id]
+	if !ok {
+		return nil, ErrSeriesNotFound
+	}
+	c := *s
+	c.Players = append([]string{}, s.Players...)
+	c.MatchIds = append([]string{}, s.MatchIds...)
+	return &c, nil
+}
+
+func (r *StubSeriesRepo) AddSeries(ctx context.Context, s *Series) error {
+	r.series[s.Id] = s
+	return nil
+}
+
+func (r *StubSeriesRepo) UpdateSeries(ctx context.Context, id string, f func(*Series) error) (*Series, error) {
+	s, err := r.GetSeries(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := f(s); err != nil {
+		return nil, err
+	}
+	r.series[id] = s
+	return s, nil
+}
@@ -1,53 +1,248 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
 	"strconv"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/julienschmidt/httprouter"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 const (
 	playerCookieConst = "player_id"
 )
 
-type ErrorMessage struct {
-	Message string `json:"error"`
+type HealthResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
 }
 
 type MatchResponse struct {
 	Id     string  `json:"match"`
-	Board   [][]int `json:"board"`
+	Board  [][]int `json:"board"`
 	MyTurn bool    `json:"my_turn"`
+	// pits of the player's side that can be sown now
+	LegalMoves []int `json:"legal_moves"`
+	// none until the first move is made
+	LastMove *LastMoveResponse `json:"last_move,omitempty"`
+	// the match this one is a rematch of
+	PreviousMatch string `json:"previous_match,omitempty"`
+	// none until a player of the finished match offers one
+	Rematch *RematchResponse `json:"rematch,omitempty"`
+	// none for matches outside series
+	Series *MatchSeriesResponse `json:"series,omitempty"`
+}
+
+// MatchSeriesResponse is the series of a match as the player sees it.
+type MatchSeriesResponse struct {
+	Id     string `json:"id"`
+	BestOf int    `json:"best_of"`
+	// of the match in the series, from 1
+	Game   int    `json:"game"`
+	Wins   int    `json:"wins"`
+	Losses int    `json:"losses"`
+	Draws  int    `json:"draws"`
+	Status string `json:"status"`
+	// the game after this one, once it is over and the series is not
+	NextMatch string `json:"next_match,omitempty"`
+}
+
+type LastMoveResponse struct {
+	Pit int `json:"pit"`
+	// made by the player, or else by their opponent
+	Mine bool `json:"mine"`
+}
+
+type RematchResponse struct {
+	// offered by the player, or else by their opponent
+	Mine bool `json:"mine"`
+	// none until the rematch is accepted
+	NextMatch string `json:"next_match,omitempty"`
+}
+
+type TournamentRequest struct {
+	Name   string `json:"name"`
+	Format string `json:"format"`
+	Rounds int    `json:"rounds"`
+}
+
+type RegistrationRequest struct {
+	Name string `json:"name"`
+}
+
+type TournamentResponse struct {
+	Id        string                   `json:"id"`
+	Name      string                   `json:"name"`
+	Format    string                   `json:"format"`
+	Status    string                   `json:"status"`
+	Round     int                      `json:"round"`
+	Rounds    int                      `json:"rounds,omitempty"`
+	Players   []string                 `json:"players"`
+	Games     []TournamentGameResponse `json:"games"`
+	Standings []StandingResponse       `json:"standings"`
+}
+
+type TournamentGameResponse struct {
+	Round    int       `json:"round"`
+	Match    string    `json:"match,omitempty"`
+	Players  [2]string `json:"players"`
+	Scores   [2]int    `json:"scores"`
+	Finished bool      `json:"finished"`
+	MyGame   bool      `json:"my_game"`
+}
+
+type StandingResponse struct {
+	Rank     int     `json:"rank"`
+	Player   string  `json:"player"`
+	Played   int     `json:"played"`
+	Wins     int     `json:"wins"`
+	Draws    int     `json:"draws"`
+	Losses   int     `json:"losses"`
+	Byes     int     `json:"byes"`
+	Points   float64 `json:"points"`
+	Buchholz float64 `json:"buchholz"`
+	Margin   int     `json:"margin"`
 }
 
 type Handler struct {
-	dealer Dealer	
+	dealer      Dealer
+	opponent    Opponent
+	organizer   Organizer
+	scorekeeper Scorekeeper
+	referee     Referee
+	// seconds rejected moves are told to wait
+	retryAfter     string
+	streamInterval time.Duration
+	// closed when the server shuts down, ending the event streams
+	stopping chan struct{}
 }
 
-func startServer(d Dealer) error {
-	log.SetFlags(log.LstdFlags | log.Lshortfile)
-	h := Handler{dealer: d}
-	
+// newServer serves the game API. o plays matches requested with
+// GET /?opponent=bot and may be nil.
+func newServer(c ServerConfig, d Dealer, o Opponent, t Organizer, k Scorekeeper, s Referee) *http.Server {
+	h := Handler{
+		dealer:         d,
+		opponent:       o,
+		organizer:      t,
+		scorekeeper:    k,
+		referee:        s,
+		retryAfter:     strconv.Itoa(int(c.RetryAfter.Seconds())),
+		streamInterval: c.StreamInterval,
+		stopping:       make(chan struct{}),
+	}
 
+	// the original API, kept for existing clients
 	router := httprouter.New()
-	router.GET("/", h.joinMatch)
-	router.GET("/:matchId", h.getMatch)
-	router.PUT("/:matchId/:pit", h.move)
+	router.GET("/", route("/", deprecated(apiPrefix+"/matches", h.joinMatch)))
+	router.GET("/:matchId", route("/:matchId", deprecated(apiPrefix+"/matches/{id}", h.getMatch)))
+	router.PUT("/:matchId/:pit", route("/:matchId/:pit", deprecated(apiPrefix+"/matches/{id}/moves", h.move)))
 
-	return http.ListenAndServe(":8080", router)
+	// httprouter does not allow /tournaments next to /:matchId
+	tournaments := httprouter.New()
+	tournaments.GET("/tournaments", route("/tournaments", h.listTournaments))
+	tournaments.POST("/tournaments", route("/tournaments", h.createTournament))
+	tournaments.GET("/tournaments/:tournamentId", route("/tournaments/:tournamentId", h.getTournament))
+	tournaments.POST("/tournaments/:tournamentId/players", route("/tournaments/:tournamentId/players", h.registerPlayer))
+	tournaments.POST("/tournaments/:tournamentId/start", route("/tournaments/:tournamentId/start", h.startTournament))
+
+	mux := http.NewServeMux()
+	mux.Handle("/", router)
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/healthz", h.healthz)
+	mux.HandleFunc("/readyz", h.readyz)
+	mux.Handle("/tournaments", tournaments)
+	mux.Handle("/tournaments/", tournaments)
+	mux.Handle(apiPrefix+"/", newAPIRouter(h))
+	mux.Handle(webPrefix, newWebHandler())
+
+	srv := &http.Server{Addr: c.Address, Handler: mux}
+	// Shutdown would wait for the streams until it times out
+	srv.RegisterOnShutdown(func() { close(h.stopping) })
+	return srv
+}
+
+// route instruments and traces h and tags its log lines with a request id.
+func route(path string, h httprouter.Handle) httprouter.Handle {
+	return instrument(path, withTracing(path, withRequestLog(h)))
+}
+
+// healthz answers as long as the process can serve requests.
+func (h Handler) healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	bs, _ := json.Marshal(HealthResponse{Status: "ok"})
+	w.Write(bs)
+}
+
+// readyz answers 503 while the dealer cannot take moves, so the replica
+// gets no traffic.
+func (h Handler) readyz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := h.dealer.Ready(r.Context()); err != nil {
+		logger(r.Context()).Warn("not ready", "error", err)
+		bs, _ := json.Marshal(HealthResponse{Status: "unavailable", Error: err.Error()})
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write(bs)
+		return
+	}
+
+	bs, _ := json.Marshal(HealthResponse{Status: "ready"})
+	w.Write(bs)
 }
 
 func (h Handler) joinMatch(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	defer handle5xx(w)
-	defer setContectType(w)
+	defer handle5xx(r.Context(), w)
+	setContectType(w)
+
+	// any other opponent used to be ignored
+	opponent := ""
+	if r.URL.Query().Get("opponent") == "bot" {
+		opponent = "bot"
+	}
+	h.join(r.Context(), opponent, http.StatusOK, w)
+}
 
-	match, playerId := h.dealer.JoinMatch()
+// join joins a waiting match, or starts one against the bot, and answers
+// status with the match and the player cookie.
+func (h Handler) join(ctx context.Context, opponent string, status int, w http.ResponseWriter) {
+	var match *Match
+	var playerId string
+	var err error
+	myTurn := false
 
-	response := MatchResponse{Id: match.Id, Board: match.Board, MyTurn: false}
+	switch opponent {
+	case "":
+		match, playerId, err = h.dealer.JoinMatch(ctx)
+		if err != nil {
+			writeError(ctx, err, nil, w)
+			return
+		}
+	case "bot":
+		if h.opponent == nil {
+			writeError(ctx, errNoBot, nil, w)
+			return
+		}
+
+		match, err = h.dealer.StartMatch(ctx, uuid.NewString(), uuid.NewString(), uuid.NewString())
+		if err != nil {
+			writeError(ctx, err, nil, w)
+			return
+		}
+		playerId, myTurn = match.P1, true
+		// the bot keeps playing after the request is done
+		h.opponent.Play(context.WithoutCancel(ctx), match.Id, match.P2)
+	default:
+		writeError(ctx, errUnknownOpponent, map[string]interface{}{"opponent": opponent}, w)
+		return
+	}
+
+	response := MatchResponse{Id: match.Id, Board: match.Board, MyTurn: myTurn, LegalMoves: h.dealer.LegalMoves(*match, playerId)}
 	bs, _ := json.Marshal(response)
 
 	cookie := &http.Cookie{
@@ -56,96 +251,317 @@ func (h Handler) joinMatch(w http.ResponseWriter, r *http.Request, ps httprouter
 	}
 	http.SetCookie(w, cookie)
 
+	if status == http.StatusCreated {
+		w.Header().Set("Location", apiPrefix+"/matches/"+match.Id)
+	}
+	w.WriteHeader(status)
 	w.Write(bs)
 }
 
 func (h Handler) getMatch(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	defer handle5xx(w)
-	defer setContectType(w)
+	defer handle5xx(r.Context(), w)
+	setContectType(w)
 
 	matchIdParam := ps.ByName("matchId")
 
-	playerCookie, err := r.Cookie(playerCookieConst)
+	ctx := withLogFields(r.Context(), "match_id", matchIdParam)
+
+	playerId, err := player(r, w)
 	if err != nil {
-		log.Print("ERROR - player cookie missing")
-		writeErrorResponse("not your match", http.StatusUnauthorized, w)
+		writeError(ctx, err, nil, w)
 		return
 	}
-	http.SetCookie(w, playerCookie)
+	ctx = withLogFields(ctx, "player_id", playerId)
 
-	match, err := h.dealer.GetMatch(matchIdParam, playerCookie.Value)
+	response, err := h.matchResponse(ctx, matchIdParam, playerId)
 	if err != nil {
-		log.Printf("ERROR - match %v not found: %v", matchIdParam, err)
-		msg := fmt.Sprintf("match %v not found", matchIdParam)
-		writeErrorResponse(msg, http.StatusNotFound, w)
+		writeError(ctx, err, map[string]interface{}{"match": matchIdParam}, w)
 		return
 	}
 
-	myTurn := h.dealer.PlayerTurn(*match, playerCookie.Value)
+	bs, _ := json.Marshal(response)
+	w.Write(bs)
+}
 
-	if playerCookie.Value == match.P2 {
-		tmp := match.Board[0]
-		match.Board[0] = match.Board[1]
-		match.Board[1] = tmp
+// matchResponse is the match as playerId sees it, with their side of the
+// board first.
+func (h Handler) matchResponse(ctx context.Context, matchId string, playerId string) (MatchResponse, error) {
+	match, err := h.dealer.GetMatch(ctx, matchId, playerId)
+	if err != nil {
+		return MatchResponse{}, err
 	}
 
-	response := MatchResponse{Id: match.Id, Board: match.Board, MyTurn: myTurn}
-	bs, _ := json.Marshal(response)
-	w.Write(bs)
+	response := MatchResponse{
+		Id:            match.Id,
+		Board:         match.Board,
+		MyTurn:        h.dealer.PlayerTurn(*match, playerId),
+		LegalMoves:    h.dealer.LegalMoves(*match, playerId),
+		PreviousMatch: match.Previous,
+	}
+	if playerId == match.P2 {
+		response.Board = [][]int{match.Board[1], match.Board[0]}
+	}
+	if match.LastMove != nil {
+		response.LastMove = &LastMoveResponse{Pit: match.LastMove.Pit, Mine: match.LastMove.Player == playerId}
+	}
+	rematch, err := h.dealer.GetRematch(ctx, *match)
+	if err != nil {
+		return MatchResponse{}, err
+	}
+	if rematch != nil {
+		response.Rematch = newRematchResponse(*rematch, playerId)
+	}
+
+	if match.Series != "" {
+		s, err := h.referee.GetSeries(ctx, match.Series)
+		if err != nil {
+			return MatchResponse{}, err
+		}
+		response.Series = newMatchSeriesResponse(s, match.Id, playerId)
+	}
+	return response, nil
+}
+
+func newMatchSeriesResponse(s *Series, matchId string, playerId string) *MatchSeriesResponse {
+	me := s.side(playerId)
+	response := &MatchSeriesResponse{
+		Id:     s.Id,
+		BestOf: s.BestOf,
+		Game:   s.game(matchId),
+		Wins:   s.Wins[me],
+		Losses: s.Wins[1-me],
+		Draws:  s.Draws,
+		Status: s.Status,
+	}
+	if response.Game > 0 && response.Game < len(s.MatchIds) {
+		response.NextMatch = s.MatchIds[response.Game]
+	}
+	return response
 }
 
 func (h Handler) move(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	defer handle5xx(w)
-	defer setContectType(w)
+	defer handle5xx(r.Context(), w)
+	setContectType(w)
 
-	matchIdParam := ps.ByName("matchId")
+	matchId := ps.ByName("matchId")
 	pit, _ := strconv.Atoi(ps.ByName("pit"))
+	ctx, err := h.makeMove(r, matchId, pit, w)
 
-	playerCookie, err := r.Cookie(playerCookieConst)
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusAccepted)
+	case errors.Is(err, ErrNotYourTurn), errors.Is(err, ErrMoveConflict):
+		// the original API answers moves that cannot be made now this way
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		h.writeMoveError(ctx, err, matchId, pit, w)
+	}
+}
+
+// makeMove makes the move of the player in the cookie. The context
+// returned has the log fields of the move.
+func (h Handler) makeMove(r *http.Request, matchId string, pit int, w http.ResponseWriter) (context.Context, error) {
+	ctx := withLogFields(r.Context(), "match_id", matchId)
+
+	playerId, err := player(r, w)
+	if err != nil {
+		return ctx, err
+	}
+	ctx = withLogFields(ctx, "player_id", playerId)
+
+	m, err := h.dealer.GetMatch(ctx, matchId, playerId)
 	if err != nil {
-		log.Print("ERROR - player cookie missing")
-		writeErrorResponse("not your match", http.StatusUnauthorized, w)
+		return ctx, err
+	}
+
+	return ctx, h.dealer.MakeMove(ctx, pit, *m, playerId)
+}
+
+// writeMoveError tells moves rejected because the server is busy when to
+// try again.
+func (h Handler) writeMoveError(ctx context.Context, err error, matchId string, pit int, w http.ResponseWriter) {
+	if errors.Is(err, ErrDealerClosed) || errors.Is(err, ErrQueueFull) {
+		w.Header().Set("Retry-After", h.retryAfter)
+	}
+	writeError(ctx, err, map[string]interface{}{"match": matchId, "pit": pit}, w)
+}
+
+func (h Handler) createTournament(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	defer handle5xx(r.Context(), w)
+	setContectType(w)
+
+	req := TournamentRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(r.Context(), fmt.Errorf("%w: %v", errInvalidRequest, err), map[string]interface{}{"reason": err.Error()}, w)
 		return
 	}
-	http.SetCookie(w, playerCookie)
 
-	m, err := h.dealer.GetMatch(matchIdParam, playerCookie.Value)
+	t, err := h.organizer.CreateTournament(r.Context(), req.Name, req.Format, req.Rounds)
 	if err != nil {
-		log.Printf("ERROR - match %v not found: %v", matchIdParam, err)
-		msg := fmt.Sprintf("match %v not found", matchIdParam)
-		writeErrorResponse(msg, http.StatusNotFound, w)
+		writeError(r.Context(), err, map[string]interface{}{"format": req.Format, "rounds": req.Rounds}, w)
 		return
 	}
 
-	validMove, err := h.dealer.MakeMove(pit, *m, playerCookie.Value)
+	bs, _ := json.Marshal(newTournamentResponse(t, ""))
+	w.WriteHeader(http.StatusCreated)
+	w.Write(bs)
+}
+
+func (h Handler) listTournaments(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	defer handle5xx(r.Context(), w)
+	setContectType(w)
+
+	ts, err := h.organizer.ListTournaments(r.Context())
 	if err != nil {
-		log.Printf("ERROR - invalid move: %v", err)
-		writeErrorResponse("invalid move", http.StatusBadRequest, w)
+		writeError(r.Context(), err, nil, w)
 		return
 	}
 
-	if validMove {
-		w.WriteHeader(http.StatusAccepted)
+	response := []TournamentResponse{}
+	for _, t := range ts {
+		response = append(response, newTournamentResponse(t, ""))
+	}
+
+	bs, _ := json.Marshal(response)
+	w.Write(bs)
+}
+
+func (h Handler) getTournament(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	defer handle5xx(r.Context(), w)
+	setContectType(w)
+
+	tournamentIdParam := ps.ByName("tournamentId")
+	ctx := withLogFields(r.Context(), "tournament_id", tournamentIdParam)
+
+	t, err := h.organizer.GetTournament(ctx, tournamentIdParam)
+	if err != nil {
+		writeError(ctx, err, map[string]interface{}{"tournament": tournamentIdParam}, w)
+		return
+	}
+
+	playerId := ""
+	if playerCookie, err := r.Cookie(playerCookieConst); err == nil {
+		playerId = playerCookie.Value
+	}
+
+	bs, _ := json.Marshal(newTournamentResponse(t, playerId))
+	w.Write(bs)
+}
+
+func (h Handler) registerPlayer(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	defer handle5xx(r.Context(), w)
+	setContectType(w)
+
+	tournamentIdParam := ps.ByName("tournamentId")
+	ctx := withLogFields(r.Context(), "tournament_id", tournamentIdParam)
+
+	req := RegistrationRequest{}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(ctx, fmt.Errorf("%w: %v", errInvalidRequest, err), map[string]interface{}{"reason": err.Error()}, w)
+			return
+		}
+	}
+
+	t, playerId, err := h.organizer.Register(ctx, tournamentIdParam, req.Name)
+	if err != nil {
+		writeError(ctx, err, map[string]interface{}{"tournament": tournamentIdParam}, w)
+		return
+	}
+
+	cookie := &http.Cookie{
+		Name:  playerCookieConst,
+		Value: playerId,
+	}
+	http.SetCookie(w, cookie)
+
+	bs, _ := json.Marshal(newTournamentResponse(t, playerId))
+	w.WriteHeader(http.StatusCreated)
+	w.Write(bs)
+}
+
+func (h Handler) startTournament(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	defer handle5xx(r.Context(), w)
+	setContectType(w)
+
+	tournamentIdParam := ps.ByName("tournamentId")
+	ctx := withLogFields(r.Context(), "tournament_id", tournamentIdParam)
+
+	t, err := h.organizer.Start(ctx, tournamentIdParam)
+	if err != nil {
+		writeError(ctx, err, map[string]interface{}{"tournament": tournamentIdParam}, w)
 		return
 	}
 
-	w.WriteHeader(http.StatusNoContent)
+	bs, _ := json.Marshal(newTournamentResponse(t, ""))
+	w.Write(bs)
+}
+
+// newTournamentResponse hides player ids, which are also their
+// credentials. Games of playerId are flagged as my_game.
+func newTournamentResponse(t *Tournament, playerId string) TournamentResponse {
+	response := TournamentResponse{
+		Id:        t.Id,
+		Name:      t.Name,
+		Format:    t.Format,
+		Status:    t.Status,
+		Round:     t.Round,
+		Rounds:    t.Rounds,
+		Players:   []string{},
+		Games:     []TournamentGameResponse{},
+		Standings: []StandingResponse{},
+	}
+
+	for _, p := range t.Players {
+		response.Players = append(response.Players, p.Name)
+	}
+
+	for _, g := range t.Games {
+		gr := TournamentGameResponse{Round: g.Round, Match: g.MatchId, Scores: g.Scores, Finished: g.Finished}
+		for i, p := range g.Players {
+			if p == noPlayer {
+				continue
+			}
+			gr.Players[i] = t.Players[p].Name
+			gr.MyGame = gr.MyGame || (playerId != "" && t.Players[p].Id == playerId)
+		}
+		response.Games = append(response.Games, gr)
+	}
+
+	for i, s := range t.Standings() {
+		response.Standings = append(response.Standings, StandingResponse{
+			Rank:     i + 1,
+			Player:   t.Players[s.Player].Name,
+			Played:   s.Played,
+			Wins:     s.Wins,
+			Draws:    s.Draws,
+			Losses:   s.Losses,
+			Byes:     s.Byes,
+			Points:   s.Points,
+			Buchholz: s.Buchholz,
+			Margin:   s.Margin,
+		})
+	}
+
+	return response
 }
 
 func setContectType(w http.ResponseWriter) {
-	w.Header().Add("Content-Type", "application/json")
+	w.Header().Set("Content-Type", "application/json")
 }
 
-func writeErrorResponse(msg string, statusCode int, w http.ResponseWriter) {
-	errMsg := ErrorMessage{Message: msg}
-	errorBs, _ := json.Marshal(errMsg)
-	w.WriteHeader(statusCode)
-	w.Write(errorBs)
+// player returns the id in the player cookie, and sends the cookie back.
+func player(r *http.Request, w http.ResponseWriter) (string, error) {
+	playerCookie, err := r.Cookie(playerCookieConst)
+	if err != nil {
+		return "", errMissingPlayer
+	}
+	http.SetCookie(w, playerCookie)
+	return playerCookie.Value, nil
 }
 
-func handle5xx(w http.ResponseWriter) {
+func handle5xx(ctx context.Context, w http.ResponseWriter) {
 	if r := recover(); r != nil {
-		log.Println("ERROR - InternalServerError: ", r)
-		w.WriteHeader(http.StatusInternalServerError)
+		writeError(ctx, fmt.Errorf("panic: %v", r), nil, w)
 	}
 }
@@ -1,22 +1,40 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/google/uuid"
+	"net"
+	"reflect"
 
 	"io/ioutil"
 	"net/http"
+	"strings"
 	"testing"
 	"time"
 )
 
 type StubDealer struct{}
 
+type StubOpponent struct {
+	played chan string
+}
+
+var stubOpponent = &StubOpponent{played: make(chan string, 1)}
+
 func init() {
-	go startServer(&StubDealer{})
-	time.Sleep(0)
+	go newServer(testConfig.Server, &StubDealer{}, stubOpponent, &StubOrganizer{}, &StubScorekeeper{}, &StubReferee{}).ListenAndServe()
+
+	// wait for the server, the first tests to run may need it
+	for i := 0; i < 100; i++ {
+		if c, err := net.Dial("tcp", "localhost:8080"); err == nil {
+			c.Close()
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
 }
 
 func TestJoinMatch(t *testing.T) {
@@ -37,6 +55,32 @@ func TestJoinMatch(t *testing.T) {
 	}
 }
 
+func TestJoinBotMatch(t *testing.T) {
+	res := execute2xxRequest("GET", "http://localhost:8080/?opponent=bot", t)
+
+	bs, _ := ioutil.ReadAll(res.Body)
+	match := MatchResponse{}
+	json.Unmarshal(bs, &match)
+
+	if !match.MyTurn {
+		t.Fatal("it should be my turn against a bot")
+	}
+
+	p1Cookie := getCookieByName(playerCookieConst, res.Cookies())
+	if p1Cookie.Value != testMatch.P1 {
+		t.Fatalf("expected to play as P1 %v but got %v", testMatch.P1, p1Cookie.Value)
+	}
+
+	select {
+	case botId := <-stubOpponent.played:
+		if botId != testMatch.P2 {
+			t.Fatalf("expected bot to play as P2 %v but got %v", testMatch.P2, botId)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("bot did not join the match")
+	}
+}
+
 func TestGetMatch(t *testing.T) {
 	url := fmt.Sprintf("http://localhost:8080/%v", testMatch.Id)
 
@@ -97,17 +141,16 @@ func TestGetNotMyMatch(t *testing.T) {
 	cookie := http.Cookie{Name: playerCookieConst, Value: uuid.NewString()}
 	res := execute4xxRequest("GET", url, t, &cookie)
 
-	if res.StatusCode != 404 {
-		t.Fatalf("expected 404, but got status code %v", res.StatusCode)
+	if res.StatusCode != 403 {
+		t.Fatalf("expected 403, but got status code %v", res.StatusCode)
 	}
 
 	bs, _ := ioutil.ReadAll(res.Body)
 	err := ErrorMessage{}
 	json.Unmarshal(bs, &err)
 
-	expectedMsg := fmt.Sprintf("match %v not found", testMatch.Id)
-	if err.Message != expectedMsg {
-		t.Fatalf("wrong error message: %v", err.Message)
+	if err.Code != "not_participant" || err.Details["match"] != testMatch.Id {
+		t.Fatalf("wrong error: %v", string(bs))
 	}
 
 }
@@ -127,6 +170,10 @@ func TestGetMatchOnMyTurn(t *testing.T) {
 		t.Fatal("it should by my turn")
 	}
 
+	if !reflect.DeepEqual(matchResponse.LegalMoves, []int{1}) {
+		t.Fatalf("expected the legal moves of the player but got %v", matchResponse.LegalMoves)
+	}
+
 }
 
 func TestGetMatchKeepsCookie(t *testing.T) {
@@ -158,9 +205,11 @@ func TestGetMatchWithUnkownId(t *testing.T) {
 	err := ErrorMessage{}
 	json.Unmarshal(bs, &err)
 
-	expectedMsg := fmt.Sprintf("match %v not found", id)
-	if err.Message != expectedMsg {
-		t.Fatalf("wrong error message: %v", err.Message)
+	if err.Code != "match_not_found" || err.Message != "match not found" || err.Details["match"] != id.String() {
+		t.Fatalf("wrong error: %v", string(bs))
+	}
+	if err.LegacyMessage != err.Message {
+		t.Fatalf("the message should be kept in error for older clients: %v", string(bs))
 	}
 
 }
@@ -234,6 +283,23 @@ func TestMakeInvalidMove(t *testing.T) {
 	}
 }
 
+func TestMakeMoveWhenBusy(t *testing.T) {
+	url := fmt.Sprintf("http://localhost:8080/%v/%v", testMatch.Id, fullQueuePit)
+
+	cookie := http.Cookie{Name: playerCookieConst, Value: testMatch.P1}
+	res, err := doRequest("PUT", url, []*http.Cookie{&cookie})
+	if err != nil {
+		t.Fatal("failed to execute http put")
+	}
+
+	if res.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, but got status code %v", res.StatusCode)
+	}
+	if res.Header.Get("Retry-After") != "1" {
+		t.Fatalf("expected Retry-After 1 but got %q", res.Header.Get("Retry-After"))
+	}
+}
+
 func TestMakeMoveKeepsCookie(t *testing.T) {
 	url := fmt.Sprintf("http://localhost:8080/%v/%v", testMatch.Id, 1)
 
@@ -248,6 +314,103 @@ func TestMakeMoveKeepsCookie(t *testing.T) {
 
 }
 
+func TestCreateTournament(t *testing.T) {
+	body := strings.NewReader(`{"name":"office cup","format":"swiss","rounds":3}`)
+	res, err := http.Post("http://localhost:8080/tournaments", "application/json", body)
+	if err != nil {
+		t.Fatal("failed to execute http post")
+	}
+
+	if res.StatusCode != 201 {
+		t.Fatalf("expected 201, but got status code %v", res.StatusCode)
+	}
+
+	bs, _ := ioutil.ReadAll(res.Body)
+	tournament := TournamentResponse{}
+	json.Unmarshal(bs, &tournament)
+
+	if tournament.Name != "office cup" || tournament.Format != SwissFormat {
+		t.Fatalf("unexpected tournament: %v", string(bs))
+	}
+}
+
+func TestCreateInvalidTournament(t *testing.T) {
+	body := strings.NewReader(`{"name":"office cup","format":"knockout"}`)
+	res, err := http.Post("http://localhost:8080/tournaments", "application/json", body)
+	if err != nil {
+		t.Fatal("failed to execute http post")
+	}
+
+	if res.StatusCode != 400 {
+		t.Fatalf("expected 400, but got status code %v", res.StatusCode)
+	}
+}
+
+func TestGetTournament(t *testing.T) {
+	url := fmt.Sprintf("http://localhost:8080/tournaments/%v", testTournament.Id)
+
+	cookie := http.Cookie{Name: playerCookieConst, Value: testTournament.Players[0].Id}
+	res := execute2xxRequest("GET", url, t, &cookie)
+
+	bs, _ := ioutil.ReadAll(res.Body)
+	tournament := TournamentResponse{}
+	json.Unmarshal(bs, &tournament)
+
+	if tournament.Id != testTournament.Id {
+		t.Fatalf("wrong tournament. expected %v but got %v", testTournament.Id, tournament.Id)
+	}
+
+	if strings.Contains(string(bs), testTournament.Players[0].Id) {
+		t.Fatal("player ids should not be visible")
+	}
+
+	if !tournament.Games[0].MyGame {
+		t.Fatal("game should be flagged as mine")
+	}
+
+	if tournament.Standings[0].Player != "alice" {
+		t.Fatalf("expected alice to lead but got %v", tournament.Standings[0].Player)
+	}
+}
+
+func TestGetUnknownTournament(t *testing.T) {
+	url := fmt.Sprintf("http://localhost:8080/tournaments/%v", uuid.New())
+
+	res := execute4xxRequest("GET", url, t)
+
+	if res.StatusCode != 404 {
+		t.Fatalf("expected 404, but got status code %v", res.StatusCode)
+	}
+}
+
+func TestRegisterPlayer(t *testing.T) {
+	url := fmt.Sprintf("http://localhost:8080/tournaments/%v/players", testTournament.Id)
+
+	res, err := http.Post(url, "application/json", strings.NewReader(`{"name":"carol"}`))
+	if err != nil {
+		t.Fatal("failed to execute http post")
+	}
+
+	if res.StatusCode != 201 {
+		t.Fatalf("expected 201, but got status code %v", res.StatusCode)
+	}
+
+	playerCookie := getCookieByName(playerCookieConst, res.Cookies())
+	if playerCookie == nil || playerCookie.Value == "" {
+		t.Fatal("player cookie not set")
+	}
+}
+
+func TestStartTournamentTwice(t *testing.T) {
+	url := fmt.Sprintf("http://localhost:8080/tournaments/%v/start", testTournament.Id)
+
+	res := execute4xxRequest("POST", url, t)
+
+	if res.StatusCode != 409 {
+		t.Fatalf("expected 409, but got status code %v", res.StatusCode)
+	}
+}
+
 func getCookieByName(name string, cl []*http.Cookie) *http.Cookie {
 	for _, c := range cl {
 		if c.Name == name {
@@ -258,6 +421,26 @@ func getCookieByName(name string, cl []*http.Cookie) *http.Cookie {
 	return nil
 }
 
+func TestHealthz(t *testing.T) {
+	res := execute2xxRequest("GET", "http://localhost:8080/healthz", t)
+
+	health := HealthResponse{}
+	json.NewDecoder(res.Body).Decode(&health)
+	if health.Status != "ok" {
+		t.Fatalf("expected status ok but got %v", health.Status)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	res := execute2xxRequest("GET", "http://localhost:8080/readyz", t)
+
+	health := HealthResponse{}
+	json.NewDecoder(res.Body).Decode(&health)
+	if health.Status != "ready" {
+		t.Fatalf("expected status ready but got %v", health.Status)
+	}
+}
+
 func execute2xxRequest(method string, url string, t *testing.T, cookies ...*http.Cookie) *http.Response {
 	res, err := doRequest(method, url, cookies)
 	if err != nil {
@@ -299,13 +482,36 @@ func doRequest(method string, url string, cookies []*http.Cookie) (*http.Respons
 }
 
 var panicGenerator = uuid.NewString()
-var testMatch = Match{Id: uuid.NewString(), P1: uuid.NewString(), P2: uuid.NewString(), Board: [][]int{{0,0},{1,1}}}
+var testTournament = Tournament{
+	Id:      uuid.NewString(),
+	Name:    "test",
+	Format:  RoundRobinFormat,
+	Status:  runningStatus,
+	Round:   1,
+	Players: []TournamentPlayer{{Id: uuid.NewString(), Name: "alice"}, {Id: uuid.NewString(), Name: "bob"}},
+	Games:   []TournamentGame{{Round: 1, MatchId: uuid.NewString(), Players: [2]int{0, 1}, Scores: [2]int{40, 32}, Finished: true}},
+}
+var testMatch = Match{Id: uuid.NewString(), P1: uuid.NewString(), P2: uuid.NewString(), Board: [][]int{{0, 0}, {1, 1}}}
+
+// testRematch of testMatch is offered by P2, and accepted by P1.
+var testRematch = Rematch{MatchId: testMatch.Id, OfferedBy: testMatch.P2}
+var testNextMatchId = uuid.NewString()
+
+func (s *StubDealer) JoinMatch(ctx context.Context) (*Match, string, error) {
+	return &testMatch, uuid.NewString(), nil
+}
 
-func (s *StubDealer) JoinMatch() (*Match, string) {
-	return &testMatch, uuid.NewString()
+func (s *StubDealer) StartMatch(ctx context.Context, matchId string, p1 string, p2 string) (*Match, error) {
+	return &testMatch, nil
 }
 
-func (s *StubDealer) GetMatch(matchId string, playerId string) (*Match, error) {
+func (s *StubDealer) StartSeriesMatch(ctx context.Context, seriesId string, matchId string, p1 string, p2 string) (*Match, error) {
+	return &testMatch, nil
+}
+
+func (s *StubDealer) OnMatchFinished(f func(context.Context, Match)) {}
+
+func (s *StubDealer) GetMatch(ctx context.Context, matchId string, playerId string) (*Match, error) {
 	if testMatch.Id == matchId {
 		if testMatch.P1 == playerId || testMatch.P2 == playerId {
 			return &testMatch, nil
@@ -316,17 +522,103 @@ func (s *StubDealer) GetMatch(matchId string, playerId string) (*Match, error) {
 		panic("panic!")
 	}
 
-	return &Match{}, errors.New("not found")
+	if testMatch.Id == matchId {
+		return nil, ErrNotParticipant
+	}
+	return nil, ErrMatchNotFound
+
+}
+
+func (s *StubDealer) Rematch(ctx context.Context, matchId string, playerId string) (*Rematch, error) {
+	if _, err := s.GetMatch(ctx, matchId, playerId); err != nil {
+		return nil, err
+	}
+	r := testRematch
+	if playerId != r.OfferedBy {
+		r.NextMatchId = testNextMatchId
+	}
+	return &r, nil
+}
+
+func (s *StubDealer) GetRematch(ctx context.Context, m Match) (*Rematch, error) {
+	if m.Id == testRematch.MatchId {
+		return &testRematch, nil
+	}
+	return nil, nil
+}
 
+func (s *StubDealer) Ready(ctx context.Context) error {
+	return nil
+}
+
+func (s *StubDealer) Close(ctx context.Context) error {
+	return nil
 }
 
 func (s *StubDealer) PlayerTurn(match Match, playerId string) bool {
 	return true
 }
 
-func (d *StubDealer) MakeMove(pit int, match Match, playerId string) (bool, error) {
+func (s *StubDealer) LegalMoves(match Match, playerId string) []int {
+	if playerId != match.P1 {
+		return []int{}
+	}
+	return []int{1}
+}
+
+// moves to fullQueuePit are rejected as if the queue was full
+const fullQueuePit = 5
+
+func (d *StubDealer) MakeMove(ctx context.Context, pit int, match Match, playerId string) error {
 	if pit < 0 {
-		return false, errors.New("")
+		return ErrInvalidPit
+	}
+	if pit == fullQueuePit {
+		return ErrQueueFull
+	}
+	if match.P1 != playerId {
+		return ErrNotYourTurn
+	}
+	return nil
+}
+
+func (o *StubOpponent) Play(ctx context.Context, matchId string, playerId string) {
+	o.played <- playerId
+}
+
+func (o *StubOpponent) Close(ctx context.Context) error {
+	return nil
+}
+
+type StubOrganizer struct{}
+
+func (o *StubOrganizer) CreateTournament(ctx context.Context, name string, format string, rounds int) (*Tournament, error) {
+	if format != SwissFormat {
+		return nil, ErrInvalidFormat
+	}
+	return &Tournament{Id: uuid.NewString(), Name: name, Format: format, Rounds: rounds, Status: registeringStatus}, nil
+}
+
+func (o *StubOrganizer) GetTournament(ctx context.Context, id string) (*Tournament, error) {
+	if id == testTournament.Id {
+		return &testTournament, nil
 	}
-	return match.P1 == playerId, nil
+	return nil, ErrTournamentNotFound
+}
+
+func (o *StubOrganizer) ListTournaments(ctx context.Context) ([]*Tournament, error) {
+	return []*Tournament{&testTournament}, nil
 }
+
+func (o *StubOrganizer) Register(ctx context.Context, tournamentId string, name string) (*Tournament, string, error) {
+	if tournamentId != testTournament.Id {
+		return nil, "", ErrTournamentNotFound
+	}
+	return &testTournament, uuid.NewString(), nil
+}
+
+func (o *StubOrganizer) Start(ctx context.Context, id string) (*Tournament, error) {
+	return nil, ErrRegistrationClosed
+}
+
+func (o *StubOrganizer) MatchFinished(ctx context.Context, m Match) {}
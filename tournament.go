@@ -0,0 +1,456 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+
+	"github.com/dacruz/mancala/game"
+	"github.com/dacruz/mancala/pairing"
+	"github.com/gomodule/redigo/redis"
+	"github.com/google/uuid"
+)
+
+const (
+	RoundRobinFormat        = "roundrobin"
+	SingleEliminationFormat = "single_elimination"
+	DoubleEliminationFormat = "double_elimination"
+	SwissFormat             = "swiss"
+
+	registeringStatus = "registering"
+	runningStatus     = "running"
+	finishedStatus    = "finished"
+
+	// Players index of the empty seat of a bye
+	noPlayer = -1
+)
+
+var (
+	ErrTournamentNotFound = errors.New("tournament not found")
+	ErrInvalidFormat      = errors.New("invalid tournament format")
+	ErrRegistrationClosed = errors.New("registration is closed")
+	ErrNotEnoughPlayers   = errors.New("at least 2 players are needed")
+	ErrInvalidRounds      = errors.New("invalid number of rounds")
+
+	// the tournament changed since it was read
+	errTournamentChanged = errors.New("tournament changed")
+)
+
+type TournamentPlayer struct {
+	Id   string
+	Name string
+}
+
+// TournamentGame is one game of a tournament. Players holds the indexes
+// of the players in Tournament.Players, P1 first. A bye is a finished game
+// without a match and noPlayer as second player.
+type TournamentGame struct {
+	Round    int
+	MatchId  string
+	Players  [2]int
+	Scores   [2]int
+	Finished bool
+}
+
+func (g TournamentGame) bye() bool {
+	return g.Players[1] == noPlayer
+}
+
+// winner returns the index in Players of the winner, or -1 on a draw.
+func (g TournamentGame) winner() int {
+	switch {
+	case g.bye() || g.Scores[0] > g.Scores[1]:
+		return 0
+	case g.Scores[1] > g.Scores[0]:
+		return 1
+	}
+	return -1
+}
+
+type Tournament struct {
+	Id      string
+	Name    string
+	Format  string
+	Rounds  int
+	Status  string
+	Round   int
+	Players []TournamentPlayer
+	Games   []TournamentGame
+}
+
+type Standing struct {
+	Player   int
+	Played   int
+	Wins     int
+	Draws    int
+	Losses   int
+	Byes     int
+	Points   float64
+	Buchholz float64
+	Margin   int
+	// last round the player played, used to rank eliminated players
+	LastRound int
+}
+
+type Organizer interface {
+	CreateTournament(ctx context.Context, name string, format string, rounds int) (*Tournament, error)
+	GetTournament(context.Context, string) (*Tournament, error)
+	ListTournaments(context.Context) ([]*Tournament, error)
+	Register(ctx context.Context, tournamentId string, name string) (*Tournament, string, error)
+	Start(context.Context, string) (*Tournament, error)
+	MatchFinished(context.Context, Match)
+}
+
+type TournamentOrganizer struct {
+	repo   TournamentRepo
+	dealer Dealer
+}
+
+func newOrganizer(r TournamentRepo, d Dealer) Organizer {
+	return &TournamentOrganizer{repo: r, dealer: d}
+}
+
+func (o *TournamentOrganizer) CreateTournament(ctx context.Context, name string, format string, rounds int) (*Tournament, error) {
+	switch format {
+	case RoundRobinFormat, SingleEliminationFormat, DoubleEliminationFormat, SwissFormat:
+	default:
+		return nil, ErrInvalidFormat
+	}
+
+	if rounds < 0 {
+		return nil, ErrInvalidRounds
+	}
+
+	t := Tournament{Id: uuid.NewString(), Name: name, Format: format, Rounds: rounds, Status: registeringStatus}
+	if err := o.repo.AddTournament(ctx, &t); err != nil {
+		return nil, fmt.Errorf("unable to create tournament: %w", err)
+	}
+	logger(ctx).Info("tournament created", "tournament_id", t.Id, "format", t.Format)
+
+	return &t, nil
+}
+
+func (o *TournamentOrganizer) GetTournament(ctx context.Context, id string) (*Tournament, error) {
+	return o.repo.GetTournament(ctx, id)
+}
+
+func (o *TournamentOrganizer) ListTournaments(ctx context.Context) ([]*Tournament, error) {
+	return o.repo.ListTournaments(ctx)
+}
+
+// Register adds a player to a tournament that has not started yet and
+// returns the new player's id.
+func (o *TournamentOrganizer) Register(ctx context.Context, tournamentId string, name string) (*Tournament, string, error) {
+	p := TournamentPlayer{Id: uuid.NewString(), Name: name}
+
+	t, err := o.update(ctx, tournamentId, func(t *Tournament) ([]TournamentGame, error) {
+		if t.Status != registeringStatus {
+			return nil, ErrRegistrationClosed
+		}
+
+		if p.Name == "" {
+			p.Name = fmt.Sprintf("player %v", len(t.Players)+1)
+		}
+		t.Players = append(t.Players, p)
+		return nil, nil
+	})
+
+	return t, p.Id, err
+}
+
+// Start closes the registration and pairs the first round.
+func (o *TournamentOrganizer) Start(ctx context.Context, id string) (*Tournament, error) {
+	return o.update(ctx, id, func(t *Tournament) ([]TournamentGame, error) {
+		if t.Status != registeringStatus {
+			return nil, ErrRegistrationClosed
+		}
+
+		if len(t.Players) < 2 {
+			return nil, ErrNotEnoughPlayers
+		}
+
+		t.Status = runningStatus
+		switch t.Format {
+		case RoundRobinFormat:
+			t.Rounds = pairing.Rounds(len(t.Players))
+		case SwissFormat:
+			if t.Rounds == 0 {
+				t.Rounds = int(math.Ceil(math.Log2(float64(len(t.Players)))))
+			}
+		}
+
+		return t.pairNextRound(), nil
+	})
+}
+
+// MatchFinished records the result of a tournament match and, once the
+// round is over, pairs the next one. Matches outside tournaments are
+// ignored.
+func (o *TournamentOrganizer) MatchFinished(ctx context.Context, m Match) {
+	tournamentId, err := o.repo.GetMatchTournament(ctx, m.Id)
+	// the match is not in a tournament
+	if err == redis.ErrNil {
+		return
+	}
+	if err != nil {
+		logger(ctx).Error("failed to get match tournament", "match_id", m.Id, "error", err)
+		return
+	}
+
+	ctx = withLogFields(ctx, "tournament_id", tournamentId)
+	t, err := o.update(ctx, tournamentId, func(t *Tournament) ([]TournamentGame, error) {
+		return t.record(m), nil
+	})
+	if err != nil {
+		logger(ctx).Error("failed to record tournament match", "error", err)
+		return
+	}
+
+	logger(ctx).Info("tournament match recorded", "round", t.Round, "status", t.Status)
+}
+
+// update applies f to a copy of the tournament and saves it once the
+// matches of the games f returns are started, so no game waits for a match
+// that does not exist. When the tournament changes meanwhile, f is applied
+// again to the new one and the matches started are left unplayed.
+func (o *TournamentOrganizer) update(ctx context.Context, id string, f func(*Tournament) ([]TournamentGame, error)) (*Tournament, error) {
+	for i := 0; i < maxUpdateRetries; i++ {
+		read, err := o.repo.GetTournament(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+
+		t := read.clone()
+		newGames, err := f(t)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, g := range newGames {
+			if _, err := o.dealer.StartMatch(ctx, g.MatchId, t.Players[g.Players[0]].Id, t.Players[g.Players[1]].Id); err != nil {
+				return nil, fmt.Errorf("unable to start tournament match: %w", err)
+			}
+		}
+
+		saved, err := o.repo.UpdateTournament(ctx, id, func(stored *Tournament) error {
+			if !reflect.DeepEqual(stored, read) {
+				return errTournamentChanged
+			}
+			*stored = *t
+			return nil
+		})
+		if err == errTournamentChanged {
+			logger(ctx).Debug("tournament changed while starting its matches, retrying", "tournament_id", id)
+			continue
+		}
+		return saved, err
+	}
+
+	return nil, fmt.Errorf("tournament %v: too many concurrent updates", id)
+}
+
+// clone copies the tournament, so changing the copy leaves it as it is.
+func (t *Tournament) clone() *Tournament {
+	c := *t
+	c.Players = append(t.Players[:0:0], t.Players...)
+	c.Games = append(t.Games[:0:0], t.Games...)
+	return &c
+}
+
+// record stores the result of m and returns the games to be played next.
+func (t *Tournament) record(m Match) []TournamentGame {
+	for i := range t.Games {
+		g := &t.Games[i]
+		if g.MatchId != m.Id || g.Finished {
+			continue
+		}
+
+		g.Scores = [2]int{game.Score(game.Board(m.Board), 0), game.Score(game.Board(m.Board), 1)}
+		g.Finished = true
+
+		// elimination games need a winner, draws are replayed
+		if t.lives() > 0 && g.winner() < 0 {
+			replay := TournamentGame{Round: g.Round, MatchId: uuid.NewString(), Players: [2]int{g.Players[1], g.Players[0]}}
+			t.Games = append(t.Games, replay)
+			return []TournamentGame{replay}
+		}
+
+		if t.roundIsOver() {
+			return t.pairNextRound()
+		}
+		return nil
+	}
+
+	return nil
+}
+
+func (t *Tournament) roundIsOver() bool {
+	for _, g := range t.Games {
+		if g.Round == t.Round && !g.Finished {
+			return false
+		}
+	}
+	return true
+}
+
+// lives is the number of games a player can lose before being
+// eliminated, 0 for formats without elimination.
+func (t *Tournament) lives() int {
+	switch t.Format {
+	case SingleEliminationFormat:
+		return 1
+	case DoubleEliminationFormat:
+		return 2
+	}
+	return 0
+}
+
+// pairNextRound adds the games of the next round, or finishes the
+// tournament. It returns the games that need a match.
+func (t *Tournament) pairNextRound() []TournamentGame {
+	standings := t.Standings()
+	hadBye := func(p int) bool { return standings[t.standingOf(standings, p)].Byes > 0 }
+
+	var pairs [][2]int
+	bye := -1
+
+	switch t.Format {
+	case RoundRobinFormat:
+		if t.Round < t.Rounds {
+			pairs, bye = pairing.RoundRobin(len(t.Players), t.Round)
+		}
+	case SwissFormat:
+		if t.Round < t.Rounds {
+			ranking := []int{}
+			for _, s := range standings {
+				ranking = append(ranking, s.Player)
+			}
+			pairs, bye = pairing.Swiss(ranking, t.played, hadBye)
+		}
+	default:
+		losses := make([]int, len(t.Players))
+		for _, s := range standings {
+			losses[s.Player] = s.Losses
+		}
+		if len(pairing.Active(losses, t.lives())) > 1 {
+			pairs, bye = pairing.Elimination(losses, t.lives(), hadBye)
+		}
+	}
+
+	if len(pairs) == 0 {
+		t.Status = finishedStatus
+		return nil
+	}
+
+	t.Round++
+	newGames := []TournamentGame{}
+	for _, p := range pairs {
+		g := TournamentGame{Round: t.Round, MatchId: uuid.NewString(), Players: p}
+		newGames = append(newGames, g)
+		t.Games = append(t.Games, g)
+	}
+
+	if bye >= 0 {
+		t.Games = append(t.Games, TournamentGame{Round: t.Round, Players: [2]int{bye, noPlayer}, Finished: true})
+	}
+
+	return newGames
+}
+
+func (t *Tournament) played(a int, b int) bool {
+	for _, g := range t.Games {
+		if (g.Players[0] == a && g.Players[1] == b) || (g.Players[0] == b && g.Players[1] == a) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *Tournament) standingOf(standings []Standing, player int) int {
+	for i, s := range standings {
+		if s.Player == player {
+			return i
+		}
+	}
+	return -1
+}
+
+// Standings ranks players by points, then by Buchholz score (the points of
+// their opponents), then by stone margin, then by registration order. In
+// elimination tournaments players still in the running and players that
+// lasted longer come first.
+func (t *Tournament) Standings() []Standing {
+	standings := make([]Standing, len(t.Players))
+	opponents := make([][]int, len(t.Players))
+	for i := range standings {
+		standings[i].Player = i
+	}
+
+	for _, g := range t.Games {
+		if !g.Finished {
+			continue
+		}
+
+		if g.bye() {
+			s := &standings[g.Players[0]]
+			s.Byes++
+			s.Points++
+			s.LastRound = g.Round
+			continue
+		}
+
+		winner := g.winner()
+		for side, p := range g.Players {
+			s := &standings[p]
+			s.Played++
+			s.Margin += g.Scores[side] - g.Scores[1-side]
+			s.LastRound = g.Round
+			opponents[p] = append(opponents[p], g.Players[1-side])
+
+			switch winner {
+			case -1:
+				s.Draws++
+				s.Points += 0.5
+			case side:
+				s.Wins++
+				s.Points++
+			default:
+				s.Losses++
+			}
+		}
+	}
+
+	for i := range standings {
+		for _, o := range opponents[i] {
+			standings[i].Buchholz += standings[o].Points
+		}
+	}
+
+	lives := t.lives()
+	sort.SliceStable(standings, func(i, j int) bool {
+		a, b := standings[i], standings[j]
+		if lives > 0 {
+			if (a.Losses < lives) != (b.Losses < lives) {
+				return a.Losses < lives
+			}
+			if a.LastRound != b.LastRound {
+				return a.LastRound > b.LastRound
+			}
+		}
+		if a.Points != b.Points {
+			return a.Points > b.Points
+		}
+		if a.Buchholz != b.Buchholz {
+			return a.Buchholz > b.Buchholz
+		}
+		if a.Margin != b.Margin {
+			return a.Margin > b.Margin
+		}
+		return a.Player < b.Player
+	})
+
+	return standings
+}
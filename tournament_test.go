@@ -0,0 +1,338 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+type StubTournamentRepo struct {
+	tournaments map[string]*Tournament
+	matches     map[string]string
+	// returned by GetTournament instead of the tournament
+	getErr error
+}
+
+type RecordingDealer struct {
+	StubDealer
+	started []Match
+	// returned by StartMatch instead of starting one
+	startErr error
+}
+
+func newTestOrganizer() (*TournamentOrganizer, *RecordingDealer) {
+	repo := &StubTournamentRepo{tournaments: map[string]*Tournament{}, matches: map[string]string{}}
+	dealer := &RecordingDealer{}
+	return &TournamentOrganizer{repo: repo, dealer: dealer}, dealer
+}
+
+func newTestTournament(o *TournamentOrganizer, format string, players int, t *testing.T) *Tournament {
+	tournament, err := o.CreateTournament(context.Background(), "test", format, 0)
+	if err != nil {
+		t.Fatalf("failed to create tournament: %v", err)
+	}
+
+	for i := 0; i < players; i++ {
+		if _, _, err := o.Register(context.Background(), tournament.Id, ""); err != nil {
+			t.Fatalf("failed to register: %v", err)
+		}
+	}
+
+	tournament, err = o.Start(context.Background(), tournament.Id)
+	if err != nil {
+		t.Fatalf("failed to start: %v", err)
+	}
+
+	return tournament
+}
+
+// playAll finishes every started match, P1 winning, until no new match is
+// started.
+func playAll(o *TournamentOrganizer, d *RecordingDealer) {
+	for len(d.started) > 0 {
+		m := d.started[0]
+		d.started = d.started[1:]
+		m.Board = MancalaBoard{{0, 0, 0, 0, 0, 0, 40}, {0, 0, 0, 0, 0, 0, 32}}
+		o.MatchFinished(context.Background(), m)
+	}
+}
+
+func TestCreateTournamentWithInvalidFormat(t *testing.T) {
+	o, _ := newTestOrganizer()
+
+	if _, err := o.CreateTournament(context.Background(), "test", "knockout", 0); err != ErrInvalidFormat {
+		t.Fatalf("expected ErrInvalidFormat but got %v", err)
+	}
+}
+
+func TestRegisterNamesPlayers(t *testing.T) {
+	o, _ := newTestOrganizer()
+	tournament, _ := o.CreateTournament(context.Background(), "test", RoundRobinFormat, 0)
+
+	tournament, playerId, _ := o.Register(context.Background(), tournament.Id, "")
+
+	if tournament.Players[0].Id != playerId || tournament.Players[0].Name != "player 1" {
+		t.Fatalf("unexpected player %v", tournament.Players[0])
+	}
+}
+
+func TestRegisterAfterStart(t *testing.T) {
+	o, _ := newTestOrganizer()
+	tournament := newTestTournament(o, RoundRobinFormat, 2, t)
+
+	if _, _, err := o.Register(context.Background(), tournament.Id, "late"); err != ErrRegistrationClosed {
+		t.Fatalf("expected ErrRegistrationClosed but got %v", err)
+	}
+}
+
+func TestStartWithoutPlayers(t *testing.T) {
+	o, _ := newTestOrganizer()
+	tournament, _ := o.CreateTournament(context.Background(), "test", SwissFormat, 0)
+	o.Register(context.Background(), tournament.Id, "alone")
+
+	if _, err := o.Start(context.Background(), tournament.Id); err != ErrNotEnoughPlayers {
+		t.Fatalf("expected ErrNotEnoughPlayers but got %v", err)
+	}
+}
+
+func TestStartCreatesMatchesForFirstRound(t *testing.T) {
+	o, d := newTestOrganizer()
+	tournament := newTestTournament(o, RoundRobinFormat, 4, t)
+
+	if tournament.Round != 1 || len(d.started) != 2 {
+		t.Fatalf("expected 2 matches in round 1 but got %v in round %v", len(d.started), tournament.Round)
+	}
+
+	for _, m := range d.started {
+		if m.P1 == "" || m.P2 == "" || m.P1 == m.P2 {
+			t.Fatalf("invalid match players %v and %v", m.P1, m.P2)
+		}
+	}
+}
+
+func TestStartFailingToStartMatches(t *testing.T) {
+	o, d := newTestOrganizer()
+	tournament, _ := o.CreateTournament(context.Background(), "test", RoundRobinFormat, 0)
+	o.Register(context.Background(), tournament.Id, "")
+	o.Register(context.Background(), tournament.Id, "")
+
+	d.startErr = errors.New("save failed")
+	if _, err := o.Start(context.Background(), tournament.Id); !errors.Is(err, d.startErr) {
+		t.Fatalf("expected the start error but got %v", err)
+	}
+	if tournament, _ = o.GetTournament(context.Background(), tournament.Id); tournament.Status != registeringStatus || len(tournament.Games) != 0 {
+		t.Fatalf("expected the tournament to be left registering but got %+v", tournament)
+	}
+
+	d.startErr = nil
+	if tournament, err := o.Start(context.Background(), tournament.Id); err != nil || len(tournament.Games) != len(d.started) {
+		t.Fatalf("expected the tournament to start on retry but got %+v, %v", tournament, err)
+	}
+}
+
+func TestRoundRobinTournament(t *testing.T) {
+	o, d := newTestOrganizer()
+	tournament := newTestTournament(o, RoundRobinFormat, 5, t)
+
+	playAll(o, d)
+
+	tournament, _ = o.GetTournament(context.Background(), tournament.Id)
+	if tournament.Status != finishedStatus {
+		t.Fatalf("tournament should be finished but is %v", tournament.Status)
+	}
+
+	for _, s := range tournament.Standings() {
+		if s.Played != 4 || s.Byes != 1 {
+			t.Fatalf("every player should play 4 games and sit out once: %+v", s)
+		}
+	}
+}
+
+func TestSingleEliminationTournament(t *testing.T) {
+	o, d := newTestOrganizer()
+	tournament := newTestTournament(o, SingleEliminationFormat, 8, t)
+
+	playAll(o, d)
+
+	tournament, _ = o.GetTournament(context.Background(), tournament.Id)
+	if tournament.Status != finishedStatus || tournament.Round != 3 {
+		t.Fatalf("expected tournament finished after 3 rounds but was %v after %v", tournament.Status, tournament.Round)
+	}
+
+	winner := tournament.Standings()[0]
+	if winner.Wins != 3 || winner.Losses != 0 {
+		t.Fatalf("winner should have won every game: %+v", winner)
+	}
+}
+
+func TestDoubleEliminationTournament(t *testing.T) {
+	o, d := newTestOrganizer()
+	tournament := newTestTournament(o, DoubleEliminationFormat, 4, t)
+
+	playAll(o, d)
+
+	tournament, _ = o.GetTournament(context.Background(), tournament.Id)
+	if tournament.Status != finishedStatus {
+		t.Fatalf("tournament should be finished but is %v", tournament.Status)
+	}
+
+	standings := tournament.Standings()
+	if standings[0].Losses > 1 {
+		t.Fatalf("winner should have lost at most once: %+v", standings[0])
+	}
+	for _, s := range standings[1:] {
+		if s.Losses != 2 {
+			t.Fatalf("everyone but the winner should be eliminated: %+v", s)
+		}
+	}
+}
+
+func TestSwissTournament(t *testing.T) {
+	o, d := newTestOrganizer()
+	tournament := newTestTournament(o, SwissFormat, 8, t)
+
+	if tournament.Rounds != 3 {
+		t.Fatalf("expected 3 rounds for 8 players but got %v", tournament.Rounds)
+	}
+
+	playAll(o, d)
+
+	tournament, _ = o.GetTournament(context.Background(), tournament.Id)
+	if tournament.Status != finishedStatus {
+		t.Fatalf("tournament should be finished but is %v", tournament.Status)
+	}
+
+	if tournament.Standings()[0].Points != 3 {
+		t.Fatalf("expected a winner with 3 points: %+v", tournament.Standings()[0])
+	}
+}
+
+func TestEliminationDrawIsReplayed(t *testing.T) {
+	o, d := newTestOrganizer()
+	tournament := newTestTournament(o, SingleEliminationFormat, 2, t)
+
+	m := d.started[0]
+	d.started = nil
+	m.Board = MancalaBoard{{0, 0, 0, 0, 0, 0, 36}, {0, 0, 0, 0, 0, 0, 36}}
+	o.MatchFinished(context.Background(), m)
+
+	if len(d.started) != 1 || d.started[0].P1 != m.P2 {
+		t.Fatalf("expected a replay with sides swapped but got %v", d.started)
+	}
+
+	tournament, _ = o.GetTournament(context.Background(), tournament.Id)
+	if tournament.Status != runningStatus {
+		t.Fatalf("tournament should still be running but is %v", tournament.Status)
+	}
+}
+
+func TestReplayFailingToStart(t *testing.T) {
+	o, d := newTestOrganizer()
+	tournament := newTestTournament(o, SingleEliminationFormat, 2, t)
+
+	m := d.started[0]
+	d.started = nil
+	d.startErr = errors.New("save failed")
+	m.Board = MancalaBoard{{0, 0, 0, 0, 0, 0, 36}, {0, 0, 0, 0, 0, 0, 36}}
+	o.MatchFinished(context.Background(), m)
+
+	tournament, _ = o.GetTournament(context.Background(), tournament.Id)
+	if len(tournament.Games) != 1 || tournament.Games[0].Finished {
+		t.Fatalf("expected no game to be added for a match not started but got %+v", tournament.Games)
+	}
+}
+
+func TestGetTournamentWithRepoError(t *testing.T) {
+	o, _ := newTestOrganizer()
+	repoErr := errors.New("connection refused")
+	o.repo.(*StubTournamentRepo).getErr = repoErr
+
+	if _, err := o.GetTournament(context.Background(), "any"); err != repoErr {
+		t.Fatalf("expected the repo error but got %v", err)
+	}
+}
+
+func TestMatchOutsideTournamentIsIgnored(t *testing.T) {
+	o, d := newTestOrganizer()
+
+	o.MatchFinished(context.Background(), Match{Id: "not in a tournament"})
+
+	if len(d.started) != 0 {
+		t.Fatal("no match should be started")
+	}
+}
+
+func (d *RecordingDealer) StartMatch(ctx context.Context, matchId string, p1 string, p2 string) (*Match, error) {
+	if d.startErr != nil {
+		return nil, d.startErr
+	}
+	m := Match{Id: matchId, P1: p1, P2: p2, Turn: p1, Board: newBoard()}
+	d.started = append(d.started, m)
+	return &m, nil
+}
+
+func (d *RecordingDealer) StartSeriesMatch(ctx context.Context, seriesId string, matchId string, p1 string, p2 string) (*Match, error) {
+	m, err := d.StartMatch(ctx, matchId, p1, p2)
+	if err != nil {
+		return nil, err
+	}
+	m.Series = seriesId
+	d.started[len(d.started)-1] = *m
+	return m, nil
+}
+
+func (r *StubTournamentRepo) GetTournament(ctx context.Context, id string) (*Tournament, error) {
+	if r.getErr != nil {
+		return nil, r.getErr
+	}
+	t, ok := r.tournaments[id]
+	if !ok {
+		return nil, ErrTournamentNotFound
+	}
+	c := *t
+	c.Players = append([]TournamentPlayer{}, t.Players...)
+	c.Games = append([]TournamentGame{}, t.Games...)
+	return &c, nil
+}
+
+func (r *StubTournamentRepo) ListTournaments(ctx context.Context) ([]*Tournament, error) {
+	ts := []*Tournament{}
+	for _, t := range r.tournaments {
+		ts = append(ts, t)
+	}
+	return ts, nil
+}
+
+func (r *StubTournamentRepo) AddTournament(ctx context.Context, t *Tournament) error {
+	r.tournaments[t.Id] = t
+	return nil
+}
+
+func (r *StubTournamentRepo) UpdateTournament(ctx context.Context, id string, f func(*Tournament) error) (*Tournament, error) {
+	t, err := r.GetTournament(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := f(t); err != nil {
+		return nil, err
+	}
+
+	for _, g := range t.Games {
+		if g.MatchId != "" {
+			r.matches[g.MatchId] = t.Id
+		}
+	}
+	r.tournaments[id] = t
+	return t, nil
+}
+
+func (r *StubTournamentRepo) GetMatchTournament(ctx context.Context, matchId string) (string, error) {
+	id, ok := r.matches[matchId]
+	if !ok {
+		return "", redis.ErrNil
+	}
+	return id, nil
+}
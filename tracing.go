@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	serviceName = "mancala"
+
+	otlpExporter   = "otlp"
+	stdoutExporter = "stdout"
+)
+
+var tracer = otel.Tracer("github.com/dacruz/mancala")
+
+// startTracing installs the global tracer provider. exporter is otlp,
+// configured with the standard OTEL_EXPORTER_OTLP_* variables, stdout, or
+// empty to disable tracing. The returned function flushes pending spans.
+func startTracing(ctx context.Context, exporter string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var e sdktrace.SpanExporter
+	var err error
+	switch exporter {
+	case "":
+		return func(context.Context) error { return nil }, nil
+	case otlpExporter:
+		e, err = otlptracehttp.New(ctx)
+	case stdoutExporter:
+		e, err = stdouttrace.New()
+	default:
+		err = fmt.Errorf("unknown trace exporter %q", exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(e),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(serviceName))),
+	)
+	otel.SetTracerProvider(tp)
+
+	return tp.Shutdown, nil
+}
+
+// withTracing starts a server span for the request, continuing the trace of
+// the caller if it sent a traceparent header.
+func withTracing(route string, h httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, r.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(semconv.HTTPRequestMethodKey.String(r.Method), semconv.HTTPRoute(route)))
+		defer span.End()
+
+		if span.SpanContext().IsValid() {
+			ctx = withLogFields(ctx, "trace_id", span.SpanContext().TraceID().String())
+		}
+
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		h(sw, r.WithContext(ctx), ps)
+
+		span.SetAttributes(semconv.HTTPResponseStatusCode(sw.status))
+		if sw.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(sw.status))
+		}
+	}
+}
+
+// queued starts the span of a move waiting in one of the dealer's queues.
+// The worker that takes the move ends it with dequeued.
+func queued(ctx context.Context, queue string) context.Context {
+	ctx, _ = tracer.Start(ctx, "queue "+queue, trace.WithAttributes(attribute.String("queue", queue)))
+	return ctx
+}
+
+func dequeued(ctx context.Context) {
+	trace.SpanFromContext(ctx).End()
+}
+
+// endSpan ends span, recording err if there is one.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
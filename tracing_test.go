@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	spanRecorder     = tracetest.NewSpanRecorder()
+	spanRecorderOnce sync.Once
+)
+
+// recordSpans installs spanRecorder. The global provider can only be set
+// once for tracer to pick it up, so tests share it and filter by trace.
+func recordSpans() {
+	spanRecorderOnce.Do(func() {
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spanRecorder)))
+		otel.SetTextMapPropagator(propagation.TraceContext{})
+	})
+}
+
+func spanNames(traceId trace.TraceID) []string {
+	names := []string{}
+	for _, s := range spanRecorder.Ended() {
+		if s.SpanContext().TraceID() == traceId {
+			names = append(names, s.Name())
+		}
+	}
+	return names
+}
+
+func TestMoveIsTracedThroughTheQueues(t *testing.T) {
+	recordSpans()
+
+	in := make(chan Move, 1)
+	out := make(chan Move, 1)
+	d := MancalaDealer{repo: &StubRepo{}}
+
+	ctx, root := tracer.Start(context.Background(), "test")
+
+	p1Id := uuid.NewString()
+	match := Match{Id: uuid.NewString(), P1: p1Id, P2: uuid.NewString(), Turn: p1Id, Board: MancalaBoard{{1, 0, 0, 0, 0, 0, 0}, {1, 0, 0, 0, 0, 0, 0}}}
+
+	in <- Move{ctx: queued(ctx, "moves"), pit: 0, match: match}
+	close(in)
+	handleMove(&d, lane{moves: in, completed: out})
+	close(out)
+	handleMoveCompleted(&d, out)
+	root.End()
+
+	expected := []string{"queue moves", "sow", "queue completed", "complete move", "test"}
+	names := spanNames(root.SpanContext().TraceID())
+	if len(names) != len(expected) {
+		t.Fatalf("expected spans %v but got %v", expected, names)
+	}
+	for i := range expected {
+		if names[i] != expected[i] {
+			t.Fatalf("expected spans %v but got %v", expected, names)
+		}
+	}
+}
+
+func TestRequestContinuesCallersTrace(t *testing.T) {
+	recordSpans()
+
+	ctx, caller := tracer.Start(context.Background(), "caller")
+	defer caller.End()
+
+	req := httptest.NewRequest("GET", "/abc", nil)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	var handled trace.SpanContext
+	h := withTracing("/:matchId", func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		handled = trace.SpanContextFromContext(r.Context())
+	})
+	h(httptest.NewRecorder(), req, nil)
+
+	if handled.TraceID() != caller.SpanContext().TraceID() {
+		t.Fatal("request should be traced in the caller's trace")
+	}
+
+	names := spanNames(caller.SpanContext().TraceID())
+	if len(names) != 1 || names[0] != "GET /:matchId" {
+		t.Fatalf("expected a GET /:matchId span but got %v", names)
+	}
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+const (
+	webPrefix = "/play/"
+)
+
+// webFiles is the browser client. It plays through the /api/v1 routes.
+//
+//go:embed web
+var webFiles embed.FS
+
+func newWebHandler() http.Handler {
+	files, _ := fs.Sub(webFiles, "web")
+	return http.StripPrefix(webPrefix, http.FileServer(http.FS(files)))
+}
@@ -0,0 +1,267 @@
+// Browser client of the mancala server. It plays through /api/v1 and
+// follows the match on its event stream.
+//
+// Boards come from the server with the player's side first, so the player
+// always sits at the bottom and sows counterclockwise, left to right.
+'use strict';
+
+const API = '/api/v1';
+const PITS = 6;
+const STORE = PITS;
+const STEP = 180; // ms an animation step stays on screen
+
+const $ = (id) => document.getElementById(id);
+
+let match = null; // last state the server sent
+let shown = null; // board on screen, behind match while animating
+let moving = false; // a move of the player is on its way
+let events = null;
+// animations are played one after the other
+let queue = Promise.resolve();
+
+// request calls the API and throws the server's message on errors.
+async function request(method, path, body) {
+  const res = await fetch(API + path, {
+    method,
+    credentials: 'same-origin',
+    headers: body ? { 'Content-Type': 'application/json' } : {},
+    body: body ? JSON.stringify(body) : undefined,
+  });
+  const text = await res.text();
+  const data = text ? JSON.parse(text) : null;
+  if (!res.ok) {
+    throw new Error((data && data.message) || res.statusText);
+  }
+  return data;
+}
+
+async function newMatch(opponent) {
+  try {
+    start(await request('POST', '/matches', opponent ? { opponent } : null));
+  } catch (e) {
+    status(e.message);
+  }
+}
+
+// resume follows the match in the address after a reload.
+async function resume(id) {
+  try {
+    start(await request('GET', '/matches/' + encodeURIComponent(id)));
+  } catch (e) {
+    status(e.message);
+    history.replaceState(null, '', location.pathname);
+  }
+}
+
+function start(m) {
+  if (events) {
+    events.close();
+  }
+  history.replaceState(null, '', '#' + m.match);
+  match = m;
+  shown = m.board;
+  moving = false;
+  $('lobby').hidden = true;
+  $('board').hidden = false;
+  show();
+
+  events = new EventSource(API + '/matches/' + encodeURIComponent(m.match) + '/events');
+  events.addEventListener('match', (e) => {
+    const next = JSON.parse(e.data);
+    queue = queue.then(() => update(next));
+  });
+  events.onerror = () => {
+    // the browser connects again unless the server refused the stream
+    if (events.readyState === EventSource.CLOSED) {
+      status('Lost the match, reload the page to follow it again');
+    }
+  };
+}
+
+// update shows the state the server sent, replaying the move that led to
+// it when the board on screen is the one it was made on.
+async function update(m) {
+  if (m.last_move && !sameBoard(shown, m.board)) {
+    const move = play(shown, m.last_move.mine ? 0 : 1, m.last_move.pit);
+    if (move && sameBoard(move.board, m.board)) {
+      await animate(move);
+    }
+  }
+
+  match = m;
+  shown = m.board;
+  if (m.my_turn) {
+    moving = false;
+  }
+  show();
+
+  if (over(m.board)) {
+    events.close();
+    $('lobby').hidden = false;
+  }
+}
+
+async function move(pit) {
+  if (moving || !match.legal_moves.includes(pit)) {
+    return;
+  }
+  moving = true;
+  const before = shown;
+  show();
+
+  try {
+    await request('POST', '/matches/' + encodeURIComponent(match.match) + '/moves', { pit });
+  } catch (e) {
+    moving = false;
+    show();
+    status(e.message);
+    return;
+  }
+
+  // the stream may have shown the move already
+  queue = queue.then(async () => {
+    if (sameBoard(shown, before)) {
+      const move = play(before, 0, pit);
+      await animate(move);
+      shown = move.board;
+      show();
+    }
+  });
+}
+
+// play mirrors the server's rules: relay sowing that skips the opponent's
+// store, and a capture when the last stone lands in an empty pit of the
+// player. It returns the board after the move and the steps to show.
+function play(board, side, pit) {
+  const l = board[side].concat(board[1 - side]);
+  const cell = (i) => (i <= STORE ? [side, i] : [1 - side, i - STORE - 1]);
+  const steps = [];
+
+  if (l[pit] === 0) {
+    return null;
+  }
+  for (let lap = 0; lap < 1000; lap++) {
+    let stones = l[pit];
+    l[pit] = 0;
+    steps.push({ board: fromLinear(l, side), marks: [[cell(pit), 'sowing']] });
+
+    let i = pit;
+    for (; stones > 0; stones--) {
+      i = (i + 1) % (l.length - 1);
+      l[i]++;
+      steps.push({ board: fromLinear(l, side), marks: [[cell(pit), 'sowing'], [cell(i), 'drop']] });
+    }
+
+    if (i >= PITS || l[i] <= 1) {
+      if (i < PITS && l[i] === 1) {
+        const captured = [[cell(i), 'captured'], [cell(i + PITS + 1), 'captured']];
+        steps.push({ board: fromLinear(l, side), marks: captured });
+        l[STORE] += l[i + PITS + 1] + 1;
+        l[i] = 0;
+        l[i + PITS + 1] = 0;
+        steps.push({ board: fromLinear(l, side), marks: [[cell(STORE), 'captured']] });
+      }
+      return { board: fromLinear(l, side), steps };
+    }
+    pit = i;
+  }
+  return null;
+}
+
+function fromLinear(l, side) {
+  const b = [];
+  b[side] = l.slice(0, STORE + 1);
+  b[1 - side] = l.slice(STORE + 1);
+  return b;
+}
+
+async function animate(move) {
+  for (const step of move.steps) {
+    render(step.board, [], step.marks);
+    await new Promise((resolve) => setTimeout(resolve, STEP));
+  }
+}
+
+// show renders the board on screen and whose turn it is.
+function show() {
+  const playable =
+    match.my_turn && match.legal_moves.length > 0 && !moving && sameBoard(shown, match.board);
+  render(shown, playable ? match.legal_moves : [], []);
+
+  const scores = [score(shown, 0), score(shown, 1)];
+  $('scores').hidden = false;
+  $('scores').textContent = `You ${scores[0]} · Opponent ${scores[1]}`;
+
+  if (over(shown)) {
+    if (scores[0] > scores[1]) {
+      status(`You won ${scores[0]} to ${scores[1]}`);
+    } else if (scores[0] < scores[1]) {
+      status(`You lost ${scores[0]} to ${scores[1]}`);
+    } else {
+      status(`Draw, ${scores[0]} each`);
+    }
+  } else if (playable) {
+    status('Your turn');
+  } else {
+    // also when no opponent has joined yet
+    status('Waiting for your opponent');
+  }
+}
+
+function render(board, legal, marks) {
+  const el = $('board');
+  el.replaceChildren();
+
+  for (const side of [0, 1]) {
+    for (let i = 0; i <= STORE; i++) {
+      const cell = document.createElement('div');
+      cell.className = 'cell';
+      cell.textContent = board[side][i];
+      cell.dataset.cell = side + ':' + i;
+
+      if (i === STORE) {
+        cell.classList.add('store');
+        cell.style.gridColumn = side === 0 ? '8' : '1';
+        cell.title = side === 0 ? 'Your store' : "Opponent's store";
+      } else {
+        // the opponent's pits run right to left, above the player's
+        cell.style.gridRow = side === 0 ? '2' : '1';
+        cell.style.gridColumn = side === 0 ? String(i + 2) : String(7 - i);
+      }
+
+      if (side === 0 && legal.includes(i)) {
+        cell.classList.add('legal');
+        cell.addEventListener('click', () => move(i));
+      }
+      el.appendChild(cell);
+    }
+  }
+
+  for (const [[side, i], mark] of marks) {
+    el.querySelector(`[data-cell="${side}:${i}"]`).classList.add(mark);
+  }
+}
+
+function status(text) {
+  $('status').textContent = text;
+}
+
+function score(board, side) {
+  return board[side].reduce((a, b) => a + b, 0);
+}
+
+function over(board) {
+  const empty = (side) => board[side].slice(0, PITS).every((s) => s === 0);
+  return empty(0) || empty(1);
+}
+
+function sameBoard(a, b) {
+  return JSON.stringify(a) === JSON.stringify(b);
+}
+
+$('play-human').addEventListener('click', () => newMatch(''));
+$('play-bot').addEventListener('click', () => newMatch('bot'));
+
+if (location.hash.length > 1) {
+  resume(decodeURIComponent(location.hash.slice(1)));
+}
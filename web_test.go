@@ -0,0 +1,30 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestWebClientIsServed(t *testing.T) {
+	res, err := http.Get("http://localhost:8080/play")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer res.Body.Close()
+
+	bs, _ := ioutil.ReadAll(res.Body)
+	if res.StatusCode != http.StatusOK || !strings.Contains(string(bs), `<script src="app.js">`) {
+		t.Fatalf("expected the page of the web client but got %v: %v", res.StatusCode, string(bs))
+	}
+
+	res, err = http.Get("http://localhost:8080/play/app.js")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || !strings.Contains(res.Header.Get("Content-Type"), "javascript") {
+		t.Fatalf("expected the script of the web client but got %v %v", res.StatusCode, res.Header.Get("Content-Type"))
+	}
+}